@@ -0,0 +1,238 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/utils/pointer"
+	cfg "sigs.k8s.io/controller-runtime/pkg/config/v1alpha1"
+)
+
+// Names of the controllers in the configuration
+const (
+	ClusterController       = "cluster"
+	HelmComponentController = "helmcomponent"
+	KymaController          = "kyma"
+	NetworkController       = "network"
+	RolloutController       = "rollout"
+	RuntimeController       = "runtime"
+	ShardAssignerController = "shardassigner"
+)
+
+// Controllers are the names of all configurable controllers
+var Controllers = []string{
+	ClusterController,
+	HelmComponentController,
+	KymaController,
+	NetworkController,
+	RolloutController,
+	RuntimeController,
+	ShardAssignerController,
+}
+
+// ClientConfig limits the requests of the manager to the API server
+type ClientConfig struct {
+	// Queries per second. If not provided: 150
+	QPS float32 `json:"qps,omitempty"`
+	// Maximum burst of queries. If not provided: 150
+	Burst int `json:"burst,omitempty"`
+}
+
+// RateLimiterConfig is the rate limiter of a reconciliation queue: the maximum of an exponential backoff of the
+// failures of every object and a token bucket for all objects
+type RateLimiterConfig struct {
+	// Delay of the first retry. If not provided: 1s
+	BaseDelay metav1.Duration `json:"baseDelay,omitempty"`
+	// Maximum delay of the retries. If not provided: 1000s
+	MaxDelay metav1.Duration `json:"maxDelay,omitempty"`
+	// Reconciliations per second of the bucket. If not provided: 150
+	QPS float64 `json:"qps,omitempty"`
+	// Size of the bucket. If not provided: 200
+	Burst int `json:"burst,omitempty"`
+}
+
+// ControllerConfig tunes a controller
+type ControllerConfig struct {
+	// Number of concurrent reconciliations. If not provided: 10 for kyma and helmcomponent, 1 for the others
+	MaxConcurrentReconciles int `json:"maxConcurrentReconciles,omitempty"`
+	// Rate limiter of the reconciliation queue. Missing values are taken from the default rate limiter.
+	// If not provided: the default rate limiter for kyma and helmcomponent, the controller-runtime rate limiter for the others
+	// +optional
+	RateLimiter *RateLimiterConfig `json:"rateLimiter,omitempty"`
+}
+
+// ResyncConfig spreads the periodic reconciliations of the kyma and helmcomponent controllers
+type ResyncConfig struct {
+	// Period after which successfully reconciled Kymas and HelmComponents are reconciled again.
+	// Unlike syncPeriod, every object is requeued on its own. If not provided: no requeue
+	// +optional
+	Period metav1.Duration `json:"period,omitempty"`
+	// Fraction of the period the requeue varies by, e.g. 0.2 for +-20%, 0 for no variation. If not provided: 0.2
+	// +optional
+	Jitter *float64 `json:"jitter,omitempty"`
+	// Window over which the reconciliations of the objects existing when the manager starts are spread.
+	// If not provided: all existing objects are reconciled at once
+	// +optional
+	StartupWindow metav1.Duration `json:"startupWindow,omitempty"`
+}
+
+//+kubebuilder:object:root=true
+
+// ProjectConfig is the configuration file of the controller manager
+type ProjectConfig struct {
+	metav1.TypeMeta `json:",inline"`
+
+	// Metrics, health probes, webhooks, leader election and sync period of the manager
+	cfg.ControllerManagerConfigurationSpec `json:",inline"`
+
+	// Rate limits of the client of the API server
+	Client ClientConfig `json:"client,omitempty"`
+
+	// Settings of the controllers by name
+	Controllers map[string]ControllerConfig `json:"controllers,omitempty"`
+
+	// Periodic reconciliations of the kyma and helmcomponent controllers
+	Resync ResyncConfig `json:"resync,omitempty"`
+}
+
+// DefaultRateLimiter is the rate limiter of the kyma and helmcomponent controllers. It allows more reconciliations
+// than the controller-runtime rate limiter (bigger bucket) and retries after 1s instead of 5ms
+var DefaultRateLimiter = RateLimiterConfig{
+	BaseDelay: metav1.Duration{Duration: time.Second},
+	MaxDelay:  metav1.Duration{Duration: 1000 * time.Second},
+	QPS:       150,
+	Burst:     200,
+}
+
+// Default sets the values which are not provided
+func (c *ProjectConfig) Default() {
+	if c.Client.QPS == 0 {
+		c.Client.QPS = 150
+	}
+	if c.Client.Burst == 0 {
+		c.Client.Burst = 150
+	}
+	if c.Resync.Jitter == nil {
+		c.Resync.Jitter = pointer.Float64(0.2)
+	}
+	if c.Controllers == nil {
+		c.Controllers = map[string]ControllerConfig{}
+	}
+	for _, name := range Controllers {
+		controller := c.Controllers[name]
+		if name == KymaController || name == HelmComponentController {
+			if controller.MaxConcurrentReconciles == 0 {
+				controller.MaxConcurrentReconciles = 10
+			}
+			if controller.RateLimiter == nil {
+				controller.RateLimiter = &RateLimiterConfig{}
+			}
+		}
+		if controller.MaxConcurrentReconciles == 0 {
+			controller.MaxConcurrentReconciles = 1
+		}
+		if limiter := controller.RateLimiter; limiter != nil {
+			if limiter.BaseDelay.Duration == 0 {
+				limiter.BaseDelay = DefaultRateLimiter.BaseDelay
+			}
+			if limiter.MaxDelay.Duration == 0 {
+				limiter.MaxDelay = DefaultRateLimiter.MaxDelay
+			}
+			if limiter.QPS == 0 {
+				limiter.QPS = DefaultRateLimiter.QPS
+			}
+			if limiter.Burst == 0 {
+				limiter.Burst = DefaultRateLimiter.Burst
+			}
+		}
+		c.Controllers[name] = controller
+	}
+}
+
+// Validate returns an error if a value is not valid
+func (c *ProjectConfig) Validate() error {
+	if c.Client.QPS < 0 {
+		return fmt.Errorf("client qps must not be negative: %v", c.Client.QPS)
+	}
+	if c.Client.Burst < 0 {
+		return fmt.Errorf("client burst must not be negative: %d", c.Client.Burst)
+	}
+	if c.Resync.Period.Duration < 0 || c.Resync.StartupWindow.Duration < 0 {
+		return fmt.Errorf("resync period and startupWindow must not be negative: %v, %v", c.Resync.Period.Duration, c.Resync.StartupWindow.Duration)
+	}
+	if jitter := c.Resync.Jitter; jitter != nil && (*jitter < 0 || *jitter >= 1) {
+		return fmt.Errorf("resync jitter must be at least 0 and less than 1: %v", *jitter)
+	}
+	names := make([]string, 0, len(c.Controllers))
+	for name := range c.Controllers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if !isController(name) {
+			return fmt.Errorf("unknown controller %s, expected one of %v", name, Controllers)
+		}
+		controller := c.Controllers[name]
+		if controller.MaxConcurrentReconciles < 0 {
+			return fmt.Errorf("controller %s: maxConcurrentReconciles must not be negative: %d", name, controller.MaxConcurrentReconciles)
+		}
+		if limiter := controller.RateLimiter; limiter != nil {
+			if err := limiter.validate(); err != nil {
+				return fmt.Errorf("controller %s: %w", name, err)
+			}
+		}
+	}
+	return nil
+}
+
+func (l *RateLimiterConfig) validate() error {
+	if l.BaseDelay.Duration < 0 {
+		return fmt.Errorf("rateLimiter baseDelay must not be negative: %v", l.BaseDelay.Duration)
+	}
+	if l.MaxDelay.Duration < 0 || l.MaxDelay.Duration > 0 && l.MaxDelay.Duration < l.BaseDelay.Duration {
+		return fmt.Errorf("rateLimiter maxDelay must not be less than baseDelay: %v", l.MaxDelay.Duration)
+	}
+	if l.QPS < 0 {
+		return fmt.Errorf("rateLimiter qps must not be negative: %v", l.QPS)
+	}
+	if l.Burst < 0 {
+		return fmt.Errorf("rateLimiter burst must not be negative: %d", l.Burst)
+	}
+	return nil
+}
+
+func isController(name string) bool {
+	for _, c := range Controllers {
+		if c == name {
+			return true
+		}
+	}
+	return false
+}
+
+// Complete returns the configuration of the manager
+func (c *ProjectConfig) Complete() (cfg.ControllerManagerConfigurationSpec, error) {
+	return c.ControllerManagerConfigurationSpec, nil
+}
+
+func init() {
+	SchemeBuilder.Register(&ProjectConfig{})
+}
@@ -0,0 +1,121 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/utils/pointer"
+	ctrl "sigs.k8s.io/controller-runtime"
+)
+
+func TestConfigFile(t *testing.T) {
+	scheme := runtime.NewScheme()
+	if err := AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+	var config ProjectConfig
+	options, err := ctrl.Options{Scheme: scheme}.AndFrom(ctrl.ConfigFile().AtPath("../../../config/manager/controller_manager_config.yaml").OfKind(&config))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !options.LeaderElection || options.MetricsBindAddress != "127.0.0.1:8080" || *options.SyncPeriod != 10*time.Hour {
+		t.Errorf("unexpected manager options %+v", options)
+	}
+	if config.Client.QPS != 150 || config.Client.Burst != 150 {
+		t.Errorf("unexpected client config %+v", config.Client)
+	}
+	if config.Resync.Period.Duration != 5*time.Minute || config.Resync.StartupWindow.Duration != 2*time.Minute {
+		t.Errorf("unexpected resync config %+v", config.Resync)
+	}
+	kyma := config.Controllers[KymaController]
+	if kyma.MaxConcurrentReconciles != 10 || kyma.RateLimiter == nil || *kyma.RateLimiter != DefaultRateLimiter {
+		t.Errorf("unexpected kyma controller config %+v", kyma)
+	}
+	if err := config.Validate(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestConfigDefault(t *testing.T) {
+	config := ProjectConfig{Controllers: map[string]ControllerConfig{
+		KymaController:    {MaxConcurrentReconciles: 20, RateLimiter: &RateLimiterConfig{QPS: 50}},
+		RolloutController: {RateLimiter: &RateLimiterConfig{Burst: 5}},
+	}}
+	config.Default()
+
+	if config.Client.QPS != 150 || config.Client.Burst != 150 {
+		t.Errorf("expected default client config, got %+v", config.Client)
+	}
+	if c := config.Controllers[KymaController]; c.MaxConcurrentReconciles != 20 || c.RateLimiter.QPS != 50 ||
+		c.RateLimiter.Burst != DefaultRateLimiter.Burst || c.RateLimiter.BaseDelay != DefaultRateLimiter.BaseDelay {
+		t.Errorf("expected kyma config merged with the defaults, got %+v %+v", c, c.RateLimiter)
+	}
+	if c := config.Controllers[HelmComponentController]; c.MaxConcurrentReconciles != 10 || *c.RateLimiter != DefaultRateLimiter {
+		t.Errorf("expected default helmcomponent config, got %+v", c)
+	}
+	if c := config.Controllers[RolloutController]; c.MaxConcurrentReconciles != 1 || c.RateLimiter.Burst != 5 || c.RateLimiter.QPS != DefaultRateLimiter.QPS {
+		t.Errorf("expected rollout config merged with the defaults, got %+v %+v", c, c.RateLimiter)
+	}
+	if c := config.Controllers[RuntimeController]; c.MaxConcurrentReconciles != 1 || c.RateLimiter != nil {
+		t.Errorf("expected controller-runtime defaults for runtime, got %+v", c)
+	}
+	if *config.Resync.Jitter != 0.2 {
+		t.Errorf("expected default resync jitter, got %v", *config.Resync.Jitter)
+	}
+	if err := config.Validate(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestConfigKeepsExplicitZeroJitter(t *testing.T) {
+	var config ProjectConfig
+	if err := json.Unmarshal([]byte(`{"resync": {"period": "5m", "jitter": 0}}`), &config); err != nil {
+		t.Fatal(err)
+	}
+	config.Default()
+	if config.Resync.Jitter == nil || *config.Resync.Jitter != 0 {
+		t.Errorf("expected resync without jitter, got %v", config.Resync.Jitter)
+	}
+}
+
+func TestConfigValidate(t *testing.T) {
+	for _, tc := range []struct {
+		name   string
+		config ProjectConfig
+		err    string
+	}{
+		{"negative client qps", ProjectConfig{Client: ClientConfig{QPS: -1}}, "client qps"},
+		{"unknown controller", ProjectConfig{Controllers: map[string]ControllerConfig{"kymas": {}}}, "unknown controller kymas"},
+		{"negative concurrency", ProjectConfig{Controllers: map[string]ControllerConfig{KymaController: {MaxConcurrentReconciles: -1}}}, "maxConcurrentReconciles"},
+		{"max delay below base delay", ProjectConfig{Controllers: map[string]ControllerConfig{KymaController: {RateLimiter: &RateLimiterConfig{BaseDelay: DefaultRateLimiter.MaxDelay, MaxDelay: DefaultRateLimiter.BaseDelay}}}}, "maxDelay"},
+		{"jitter of the whole period", ProjectConfig{Resync: ResyncConfig{Jitter: pointer.Float64(1)}}, "resync jitter"},
+		{"negative burst", ProjectConfig{Controllers: map[string]ControllerConfig{NetworkController: {RateLimiter: &RateLimiterConfig{Burst: -1}}}}, "controller network: rateLimiter burst"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			tc.config.Default()
+			err := tc.config.Validate()
+			if err == nil || !strings.Contains(err.Error(), tc.err) {
+				t.Errorf("expected error %q, got %v", tc.err, err)
+			}
+		})
+	}
+}
@@ -20,15 +20,62 @@ import (
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
+const (
+	// ProviderLabel is set on Clusters and their Kymas, the value is the provider normalized with the region catalog
+	ProviderLabel = "inventory.kyma-project.io/provider"
+	// RegionLabel is set on Clusters and their Kymas, the value is the region normalized with the region catalog
+	RegionLabel = "inventory.kyma-project.io/region"
+)
+
+// OidcSpec configures the OIDC authentication of the API server. OIDC is disabled if the issuer URL is empty
 type OidcSpec struct {
-	ClientID       string `json:"clientID,omitempty"`
-	GroupsClaim    string `json:"groupsClaim,omitempty"`
-	IssuerURL      string `json:"issuerURL,omitempty"`
+	ClientID    string `json:"clientID,omitempty"`
+	GroupsClaim string `json:"groupsClaim,omitempty"`
+	IssuerURL   string `json:"issuerURL,omitempty"`
+	// Comma separated list of JWS signing algorithms. If not provided: RS256
 	SigningAlgs    string `json:"signingAlgs,omitempty"`
 	UsernameClaim  string `json:"usernameClaim,omitempty"`
 	UsernamePrefix string `json:"usernamePrefix,omitempty"`
 }
 
+// OidcStatus is the result of the verification of the OIDC issuer
+type OidcStatus struct {
+	// True if the OIDC settings are valid and the discovery document of the issuer was fetched
+	Verified bool `json:"verified,omitempty"`
+	// URL of the issuer's JSON Web Key Set from the discovery document
+	// +optional
+	JwksURI string `json:"jwksURI,omitempty"`
+	// Reason why the OIDC settings are not verified
+	// +optional
+	Message string `json:"message,omitempty"`
+}
+
+// DefaultKubeconfigKey is the key of the kubeconfig in the Secret if the reference doesn't provide one
+const DefaultKubeconfigKey = "kubeconfig"
+
+// KubeconfigSecretReference points to a Secret in the namespace of the Cluster which contains the kubeconfig
+type KubeconfigSecretReference struct {
+	// Name of the Secret
+	Name string `json:"name"`
+	// Key of the kubeconfig in the Secret. If not provided: kubeconfig
+	// +optional
+	Key string `json:"key,omitempty"`
+}
+
+// KeyOrDefault returns the key of the kubeconfig in the Secret
+func (r *KubeconfigSecretReference) KeyOrDefault() string {
+	if r.Key == "" {
+		return DefaultKubeconfigKey
+	}
+	return r.Key
+}
+
+// ClusterReference points to a Cluster in the same namespace
+type ClusterReference struct {
+	// Name of the Cluster
+	Name string `json:"name"`
+}
+
 // EDIT THIS FILE!  THIS IS SCAFFOLDING FOR YOU TO OWN!
 // NOTE: json tags are required.  Any new fields you add must have json tags for the fields to be serialized.
 
@@ -37,21 +84,53 @@ type ClusterSpec struct {
 	// INSERT ADDITIONAL SPEC FIELDS - desired state of cluster
 	// Important: Run "make" to regenerate code after modifying this file
 
-	// Defines the platform provider for an SKR
+	// Defines the platform provider for an SKR. Must be a provider (or alias) of the region catalog
 	Provider string `json:"provider,omitempty"`
-	// Defines the platform region
+	// Defines the platform region. Must be a region of the provider in the region catalog
 	Region string   `json:"region,omitempty"`
 	Oidc   OidcSpec `json:"oidc,omitempty"`
+
+	// Secret with the kubeconfig used to access the API server of the cluster
+	// +optional
+	KubeconfigSecretRef *KubeconfigSecretReference `json:"kubeconfigSecretRef,omitempty"`
 }
 
 // ClusterStatus defines the observed state of Cluster
 type ClusterStatus struct {
 	// INSERT ADDITIONAL STATUS FIELD - define observed state of cluster
 	// Important: Run "make" to regenerate code after modifying this file
+
+	// True if the API server of the cluster responded to the last probe
+	// +optional
+	Reachable bool `json:"reachable,omitempty"`
+
+	// Kubernetes version of the API server
+	// +optional
+	Version string `json:"version,omitempty"`
+
+	// Reason why the API server is not reachable
+	// +optional
+	Message string `json:"message,omitempty"`
+
+	// Information when was the last time the API server was probed
+	// +optional
+	LastProbeTime *metav1.Time `json:"lastProbeTime,omitempty"`
+
+	// Reason why the provider or the region is not valid
+	// +optional
+	RegionMessage string `json:"regionMessage,omitempty"`
+
+	// Verification of the OIDC settings. Empty if OIDC is disabled
+	// +optional
+	Oidc *OidcStatus `json:"oidc,omitempty"`
 }
 
 //+kubebuilder:object:root=true
 //+kubebuilder:subresource:status
+//+kubebuilder:printcolumn:name="Provider",type="string",JSONPath=".spec.provider"
+//+kubebuilder:printcolumn:name="Region",type="string",JSONPath=".spec.region"
+//+kubebuilder:printcolumn:name="Reachable",type="boolean",JSONPath=".status.reachable"
+//+kubebuilder:printcolumn:name="Version",type="string",JSONPath=".status.version"
 
 // Cluster is the Schema for the clusters API
 type Cluster struct {
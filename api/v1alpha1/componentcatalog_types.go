@@ -0,0 +1,168 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	"sort"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/kyma-incubator/kymactl/pkg/helm"
+)
+
+// DefaultComponentCatalogName is the name of the catalog seeded from the embedded components.yaml
+const DefaultComponentCatalogName = "default"
+
+// CatalogComponent describes a component which can be installed by Kyma
+type CatalogComponent struct {
+	// Name of the component
+	Name string `json:"name"`
+
+	// Name of the chart in the chart catalog. If not provided the component name is used
+	// +optional
+	Chart string `json:"chart,omitempty"`
+
+	// Available chart versions, from the newest to the oldest
+	// +optional
+	Versions []string `json:"versions,omitempty"`
+
+	// Target namespace of the component. If not provided the default namespace of the catalog is used
+	// +optional
+	DefaultNamespace string `json:"defaultNamespace,omitempty"`
+
+	// Prerequisites are components required by all other components (e.g. istio)
+	// +optional
+	Prerequisite bool `json:"prerequisite,omitempty"`
+
+	// Names of the components which have to be installed successfully before this component is installed
+	// +optional
+	Dependencies []string `json:"dependencies,omitempty"`
+
+	// Component version per release channel (e.g. stable: 1.0.0). Channels without entry install the newest version
+	// +optional
+	Channels map[string]string `json:"channels,omitempty"`
+}
+
+// ComponentCatalogSpec defines the desired state of ComponentCatalog
+type ComponentCatalogSpec struct {
+	// Namespace used for components which do not define a default namespace. If not provided: kyma-system
+	// +optional
+	DefaultNamespace string `json:"defaultNamespace,omitempty"`
+
+	// Release channel used by Kymas which do not select a channel
+	// +optional
+	DefaultChannel string `json:"defaultChannel,omitempty"`
+
+	// List of installable components
+	Components []CatalogComponent `json:"components,omitempty"`
+}
+
+// ComponentCatalogStatus defines the observed state of ComponentCatalog
+type ComponentCatalogStatus struct {
+}
+
+//+kubebuilder:object:root=true
+//+kubebuilder:subresource:status
+//+kubebuilder:resource:scope=Cluster
+
+// ComponentCatalog is the Schema for the componentcatalogs API
+type ComponentCatalog struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   ComponentCatalogSpec   `json:"spec,omitempty"`
+	Status ComponentCatalogStatus `json:"status,omitempty"`
+}
+
+//+kubebuilder:object:root=true
+
+// ComponentCatalogList contains a list of ComponentCatalog
+type ComponentCatalogList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []ComponentCatalog `json:"items"`
+}
+
+// Component returns the catalog entry with the given name or nil if the component is unknown
+func (s *ComponentCatalogSpec) Component(name string) *CatalogComponent {
+	for i := range s.Components {
+		if s.Components[i].Name == name {
+			return &s.Components[i]
+		}
+	}
+	return nil
+}
+
+// NamespaceOf returns the namespace the catalog component is installed into by default
+func (s *ComponentCatalogSpec) NamespaceOf(c *CatalogComponent) string {
+	if c.DefaultNamespace != "" {
+		return c.DefaultNamespace
+	}
+	if s.DefaultNamespace != "" {
+		return s.DefaultNamespace
+	}
+	return helm.DefaultComponentNamespace
+}
+
+// HasChannel returns true if the release channel is the default channel or a component has a version for it.
+// The empty channel selects the default channel
+func (s *ComponentCatalogSpec) HasChannel(channel string) bool {
+	if channel == "" || channel == s.DefaultChannel {
+		return true
+	}
+	for i := range s.Components {
+		if _, ok := s.Components[i].Channels[channel]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+// ChannelNames returns the sorted names of the release channels of the catalog
+func (s *ComponentCatalogSpec) ChannelNames() []string {
+	channels := map[string]bool{}
+	if s.DefaultChannel != "" {
+		channels[s.DefaultChannel] = true
+	}
+	for i := range s.Components {
+		for channel := range s.Components[i].Channels {
+			channels[channel] = true
+		}
+	}
+	names := make([]string, 0, len(channels))
+	for channel := range channels {
+		names = append(names, channel)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// VersionFor returns the component version of the release channel, or the newest version if the channel has no
+// version. Empty version means the newest chart in the chart catalog
+func (c *CatalogComponent) VersionFor(channel string) string {
+	if version := c.Channels[channel]; version != "" {
+		return version
+	}
+	if len(c.Versions) > 0 {
+		return c.Versions[0]
+	}
+	return ""
+}
+
+func init() {
+	SchemeBuilder.Register(&ComponentCatalog{}, &ComponentCatalogList{})
+}
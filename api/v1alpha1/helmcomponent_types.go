@@ -39,6 +39,10 @@ type HelmComponentSpec struct {
 
 	// Target namespace where component should be installed. If not provided: kyma-system
 	Namespace string `json:"namespace,omitempty"`
+
+	// Cluster where the component is installed. If not provided the installation is only simulated
+	// +optional
+	ClusterRef *ClusterReference `json:"clusterRef,omitempty"`
 }
 
 // HelmComponentStatus defines the observed state of HelmComponent
@@ -53,11 +57,16 @@ type HelmComponentStatus struct {
 	// Information when was the last time the job was successfully scheduled.
 	// +optional
 	LastReconciliation *metav1.Time `json:"lastReconciliation,omitempty"`
+
+	// Component version installed successfully
+	// +optional
+	Version string `json:"version,omitempty"`
 }
 
 //+kubebuilder:object:root=true
 //+kubebuilder:subresource:status
 //+kubebuilder:printcolumn:name="Status",type="string",JSONPath=".status.status"
+//+kubebuilder:printcolumn:name="Version",type="string",JSONPath=".spec.version"
 
 // HelmComponent is the Schema for the helmcomponents API
 type HelmComponent struct {
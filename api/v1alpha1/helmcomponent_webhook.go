@@ -0,0 +1,149 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	"context"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	apivalidation "k8s.io/apimachinery/pkg/api/validation"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/webhook"
+)
+
+// log is for logging in this package.
+var helmcomponentlog = logf.Log.WithName("helmcomponent-resource")
+
+var _ webhook.CustomValidator = &HelmComponentWebhook{}
+
+//+kubebuilder:object:generate=false
+
+// HelmComponentWebhook validates HelmComponents and their Kyma owners
+type HelmComponentWebhook struct {
+	// Client reads the Kyma owners. It must find every Kyma, the cache of a sharded manager only has the Kymas of its
+	// shard while the admission requests go to any replica. If not provided: the API reader of the manager
+	Client client.Reader
+}
+
+// SetupWebhookWithManager registers the validating webhook for HelmComponent.
+func (w *HelmComponentWebhook) SetupWebhookWithManager(mgr ctrl.Manager) error {
+	if w.Client == nil {
+		w.Client = mgr.GetAPIReader()
+	}
+	return ctrl.NewWebhookManagedBy(mgr).
+		For(&HelmComponent{}).
+		WithValidator(w).
+		Complete()
+}
+
+//+kubebuilder:webhook:path=/validate-inventory-kyma-project-io-v1alpha1-helmcomponent,mutating=false,failurePolicy=fail,sideEffects=None,groups=inventory.kyma-project.io,resources=helmcomponents,verbs=create;update,versions=v1alpha1,name=vhelmcomponent.kb.io,admissionReviewVersions=v1
+
+// ValidateCreate validates the chart location and the Kyma owners of the component.
+func (w *HelmComponentWebhook) ValidateCreate(ctx context.Context, obj runtime.Object) error {
+	component := obj.(*HelmComponent)
+	helmcomponentlog.V(2).Info("validate create", "name", component.Name)
+
+	errs := validateChartLocation(component)
+	ownerErrs, err := w.validateOwners(ctx, component, nil)
+	if err != nil {
+		return err
+	}
+	return helmComponentInvalid(component, append(errs, ownerErrs...))
+}
+
+// ValidateUpdate rejects changes of the component name, the target namespace and the target cluster,
+// which would orphan the resources installed before.
+func (w *HelmComponentWebhook) ValidateUpdate(ctx context.Context, oldObj, newObj runtime.Object) error {
+	component, old := newObj.(*HelmComponent), oldObj.(*HelmComponent)
+	helmcomponentlog.V(2).Info("validate update", "name", component.Name)
+
+	spec := field.NewPath("spec")
+	errs := apivalidation.ValidateImmutableField(component.Spec.ComponentName, old.Spec.ComponentName, spec.Child("componentName"))
+	errs = append(errs, apivalidation.ValidateImmutableField(component.Spec.Namespace, old.Spec.Namespace, spec.Child("namespace"))...)
+	errs = append(errs, apivalidation.ValidateImmutableField(component.Spec.ClusterRef, old.Spec.ClusterRef, spec.Child("clusterRef"))...)
+	errs = append(errs, validateChartLocation(component)...)
+	ownerErrs, err := w.validateOwners(ctx, component, old.OwnerReferences)
+	if err != nil {
+		return err
+	}
+	return helmComponentInvalid(component, append(errs, ownerErrs...))
+}
+
+// ValidateDelete allows to delete every HelmComponent.
+func (w *HelmComponentWebhook) ValidateDelete(ctx context.Context, obj runtime.Object) error {
+	return nil
+}
+
+// validateOwners rejects Kyma owners which don't exist or don't contain the component.
+// Owners already present on the old object are not validated again.
+func (w *HelmComponentWebhook) validateOwners(ctx context.Context, component *HelmComponent, existing []metav1.OwnerReference) (field.ErrorList, error) {
+	var errs field.ErrorList
+	path := field.NewPath("metadata").Child("ownerReferences")
+	for i, ref := range component.OwnerReferences {
+		if ref.Kind != "Kyma" || ref.APIVersion != GroupVersion.String() || hasOwnerReference(existing, ref) {
+			continue
+		}
+		var kyma Kyma
+		if err := w.Client.Get(ctx, client.ObjectKey{Namespace: component.Namespace, Name: ref.Name}, &kyma); err != nil {
+			if apierrors.IsNotFound(err) {
+				errs = append(errs, field.NotFound(path.Index(i).Child("name"), ref.Name))
+				continue
+			}
+			return nil, err
+		}
+		switch {
+		case kyma.UID != ref.UID:
+			errs = append(errs, field.Invalid(path.Index(i).Child("uid"), ref.UID, "does not match the Kyma"))
+		case !kyma.Spec.HasComponent(component.Spec.ComponentName):
+			errs = append(errs, field.Forbidden(path.Index(i), "component "+component.Spec.ComponentName+" does not belong to Kyma "+kyma.Name))
+		}
+	}
+	return errs, nil
+}
+
+// validateChartLocation checks that the chart location is a chart name from the catalog.
+func validateChartLocation(component *HelmComponent) field.ErrorList {
+	var errs field.ErrorList
+	if location := component.Spec.ChartLocation; location != "" {
+		for _, msg := range validation.IsDNS1123Label(location) {
+			errs = append(errs, field.Invalid(field.NewPath("spec").Child("chartLocation"), location, msg))
+		}
+	}
+	return errs
+}
+
+func hasOwnerReference(refs []metav1.OwnerReference, ref metav1.OwnerReference) bool {
+	for _, r := range refs {
+		if r.UID == ref.UID {
+			return true
+		}
+	}
+	return false
+}
+
+func helmComponentInvalid(component *HelmComponent, errs field.ErrorList) error {
+	if len(errs) > 0 {
+		return apierrors.NewInvalid(GroupVersion.WithKind("HelmComponent").GroupKind(), component.Name, errs)
+	}
+	return nil
+}
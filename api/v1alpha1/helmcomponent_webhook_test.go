@@ -0,0 +1,129 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	"context"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/cache"
+)
+
+var _ = Describe("HelmComponent webhook", func() {
+	var kyma *Kyma
+
+	BeforeEach(func() {
+		kyma = &Kyma{
+			ObjectMeta: metav1.ObjectMeta{GenerateName: "owner-", Namespace: "default"},
+			Spec:       KymaSpec{Components: []ComponentSpec{{Name: "eventing"}}},
+		}
+		Expect(k8sClient.Create(ctx, kyma)).To(Succeed())
+	})
+
+	newComponent := func(name string, owner *Kyma) *HelmComponent {
+		component := &HelmComponent{
+			ObjectMeta: metav1.ObjectMeta{GenerateName: "component-", Namespace: "default"},
+			Spec:       HelmComponentSpec{ComponentName: name, Namespace: "kyma-system"},
+		}
+		if owner != nil {
+			component.OwnerReferences = []metav1.OwnerReference{{
+				APIVersion: GroupVersion.String(),
+				Kind:       "Kyma",
+				Name:       owner.Name,
+				UID:        owner.UID,
+			}}
+		}
+		return component
+	}
+
+	It("accepts components of the Kyma owner", func() {
+		Expect(k8sClient.Create(ctx, newComponent("eventing", kyma))).To(Succeed())
+	})
+
+	It("rejects components which don't belong to the Kyma owner", func() {
+		err := k8sClient.Create(ctx, newComponent("serverless", kyma))
+		Expect(apierrors.IsInvalid(err)).To(BeTrue())
+		Expect(err.Error()).To(ContainSubstring("does not belong to Kyma"))
+	})
+
+	It("rejects unknown Kyma owners", func() {
+		component := newComponent("eventing", kyma)
+		component.OwnerReferences[0].UID = types.UID("00000000-0000-0000-0000-000000000000")
+		err := k8sClient.Create(ctx, component)
+		Expect(apierrors.IsInvalid(err)).To(BeTrue())
+		Expect(err.Error()).To(ContainSubstring("metadata.ownerReferences[0].uid"))
+
+		component = newComponent("eventing", kyma)
+		component.OwnerReferences[0].Name = "missing"
+		err = k8sClient.Create(ctx, component)
+		Expect(apierrors.IsInvalid(err)).To(BeTrue())
+		Expect(err.Error()).To(ContainSubstring("metadata.ownerReferences[0].name"))
+	})
+
+	It("rejects invalid chart locations", func() {
+		component := newComponent("eventing", nil)
+		component.Spec.ChartLocation = "../Eventing"
+		err := k8sClient.Create(ctx, component)
+		Expect(apierrors.IsInvalid(err)).To(BeTrue())
+		Expect(err.Error()).To(ContainSubstring("spec.chartLocation"))
+	})
+
+	It("makes component name and namespace immutable", func() {
+		component := newComponent("eventing", kyma)
+		Expect(k8sClient.Create(ctx, component)).To(Succeed())
+
+		component.Spec.Version = "2.0.0"
+		Expect(k8sClient.Update(ctx, component)).To(Succeed())
+
+		component.Spec.ComponentName = "serverless"
+		component.Spec.Namespace = "custom"
+		err := k8sClient.Update(ctx, component)
+		Expect(apierrors.IsInvalid(err)).To(BeTrue())
+		Expect(err.Error()).To(ContainSubstring("spec.componentName"))
+		Expect(err.Error()).To(ContainSubstring("spec.namespace"))
+	})
+
+	It("finds Kyma owners outside of the shard of a sharded manager", func() {
+		selector := labels.SelectorFromSet(labels.Set{ShardLabel: "other"})
+		mgr, err := ctrl.NewManager(cfg, ctrl.Options{
+			Scheme:             k8sClient.Scheme(),
+			MetricsBindAddress: "0",
+			NewCache: cache.BuilderWithOptions(cache.Options{
+				SelectorsByObject: cache.SelectorsByObject{&Kyma{}: {Label: selector}},
+			}),
+		})
+		Expect(err).NotTo(HaveOccurred())
+		cacheCtx, stopCache := context.WithCancel(ctx)
+		defer stopCache()
+		go func() {
+			defer GinkgoRecover()
+			Expect(mgr.GetCache().Start(cacheCtx)).To(Succeed())
+		}()
+		Expect(mgr.GetCache().WaitForCacheSync(cacheCtx)).To(BeTrue())
+		webhook := &HelmComponentWebhook{}
+		Expect(webhook.SetupWebhookWithManager(mgr)).To(Succeed())
+
+		Expect(webhook.ValidateCreate(ctx, newComponent("eventing", kyma))).To(Succeed())
+	})
+})
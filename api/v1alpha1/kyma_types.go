@@ -20,6 +20,14 @@ import (
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
+const (
+	// ShardLabel is set on Kymas and their HelmComponents when the controllers are sharded, the value is the shard
+	// reconciling them. Shard Leases have the label too
+	ShardLabel = "inventory.kyma-project.io/shard"
+	// KymaLabel is set on HelmComponents, the value is the name of the Kyma
+	KymaLabel = "inventory.kyma-project.io/kyma"
+)
+
 // EDIT THIS FILE!  THIS IS SCAFFOLDING FOR YOU TO OWN!
 // NOTE: json tags are required.  Any new fields you add must have json tags for the fields to be serialized.
 
@@ -35,6 +43,47 @@ type KymaSpec struct {
 
 	// List of components
 	Components []ComponentSpec `json:"components,omitempty"`
+
+	// Release channel (e.g. stable, fast) used to resolve component versions. If not provided the default channel of the catalog is used
+	// +optional
+	Channel string `json:"channel,omitempty"`
+
+	// Cluster where the components are installed. If not provided the installation is only simulated
+	// +optional
+	ClusterRef *ClusterReference `json:"clusterRef,omitempty"`
+}
+
+// HasComponent returns true if the component is in the list of components
+func (s *KymaSpec) HasComponent(name string) bool {
+	for _, c := range s.Components {
+		if c.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// ComponentVersion is the component version resolved from the release channel
+type ComponentVersion struct {
+	Name string `json:"name"`
+	// Empty version means the newest version available
+	Version string `json:"version,omitempty"`
+}
+
+// KymaClusterStatus is the readiness of the Cluster the Kyma is installed into
+type KymaClusterStatus struct {
+	// True if the API server of the Cluster is reachable
+	Reachable bool `json:"reachable,omitempty"`
+	// True if all Networks of the Cluster are valid and don't overlap with their peers
+	NetworkValid bool `json:"networkValid,omitempty"`
+	// Reason why the Cluster is not ready
+	// +optional
+	Message string `json:"message,omitempty"`
+}
+
+// Ready returns true if the Cluster is reachable and its Networks are valid
+func (s *KymaClusterStatus) Ready() bool {
+	return s.Reachable && s.NetworkValid
 }
 
 // KymaStatus defines the observed state of Kyma
@@ -43,12 +92,26 @@ type KymaStatus struct {
 	// Important: Run "make" to regenerate code after modifying this file
 	Status     string   `json:"status,omitempty"`
 	WaitingFor []string `json:"waitingFor,omitempty"`
+
+	// Release channel used to resolve the component versions
+	// +optional
+	Channel string `json:"channel,omitempty"`
+
+	// Component versions resolved from the release channel
+	// +optional
+	Versions []ComponentVersion `json:"versions,omitempty"`
+
+	// Readiness of the Cluster referenced by clusterRef. The Kyma is not ready while its Cluster is not ready
+	// +optional
+	Cluster *KymaClusterStatus `json:"cluster,omitempty"`
 }
 
 //+kubebuilder:object:root=true
 //+kubebuilder:subresource:status
 //+kubebuilder:printcolumn:name="Ready",type="string",JSONPath=".status.status"
 //+kubebuilder:printcolumn:name="WaitingFor",type="string",JSONPath=".status.waitingFor"
+//+kubebuilder:printcolumn:name="Cluster",type="string",JSONPath=".spec.clusterRef.name"
+//+kubebuilder:printcolumn:name="Channel",type="string",JSONPath=".status.channel"
 
 // Kyma is the Schema for the kymas API
 type Kyma struct {
@@ -0,0 +1,190 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	"context"
+	"fmt"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	apivalidation "k8s.io/apimachinery/pkg/api/validation"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/webhook"
+)
+
+// log is for logging in this package.
+var kymalog = logf.Log.WithName("kyma-resource")
+
+var _ webhook.CustomDefaulter = &KymaWebhook{}
+var _ webhook.CustomValidator = &KymaWebhook{}
+
+//+kubebuilder:object:generate=false
+
+// KymaWebhook defaults and validates Kyma components using the ComponentCatalog
+type KymaWebhook struct {
+	Client client.Reader
+	// Name of the ComponentCatalog. If not provided: default
+	CatalogName string
+	// Catalog used until the ComponentCatalog is created in the cluster
+	Fallback *ComponentCatalog
+}
+
+// SetupWebhookWithManager registers the defaulting and validating webhooks for Kyma.
+func (w *KymaWebhook) SetupWebhookWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewWebhookManagedBy(mgr).
+		For(&Kyma{}).
+		WithDefaulter(w).
+		WithValidator(w).
+		Complete()
+}
+
+//+kubebuilder:webhook:path=/mutate-inventory-kyma-project-io-v1alpha1-kyma,mutating=true,failurePolicy=fail,sideEffects=None,groups=inventory.kyma-project.io,resources=kymas,verbs=create;update,versions=v1alpha1,name=mkyma.kb.io,admissionReviewVersions=v1
+
+// Default fills the namespaces of the components from the catalog.
+func (w *KymaWebhook) Default(ctx context.Context, obj runtime.Object) error {
+	kyma := obj.(*Kyma)
+	kymalog.V(2).Info("default", "name", kyma.Name)
+
+	catalog, err := w.catalog(ctx)
+	if err != nil {
+		return err
+	}
+	for i := range kyma.Spec.Components {
+		c := &kyma.Spec.Components[i]
+		if c.Namespace != "" {
+			continue
+		}
+		if entry := catalog.Spec.Component(c.Name); entry != nil {
+			c.Namespace = catalog.Spec.NamespaceOf(entry)
+		}
+	}
+	return nil
+}
+
+//+kubebuilder:webhook:path=/validate-inventory-kyma-project-io-v1alpha1-kyma,mutating=false,failurePolicy=fail,sideEffects=None,groups=inventory.kyma-project.io,resources=kymas,verbs=create;update,versions=v1alpha1,name=vkyma.kb.io,admissionReviewVersions=v1
+
+// ValidateCreate rejects unknown channels, unknown and duplicated components and dependency cycles.
+func (w *KymaWebhook) ValidateCreate(ctx context.Context, obj runtime.Object) error {
+	return w.validate(ctx, obj.(*Kyma), nil)
+}
+
+// ValidateUpdate rejects changed channels and added components which are unknown, duplicated components, dependency
+// cycles of added components and changes of the target cluster.
+func (w *KymaWebhook) ValidateUpdate(ctx context.Context, oldObj, newObj runtime.Object) error {
+	kyma, old := newObj.(*Kyma), oldObj.(*Kyma)
+	if errs := apivalidation.ValidateImmutableField(kyma.Spec.ClusterRef, old.Spec.ClusterRef, field.NewPath("spec").Child("clusterRef")); len(errs) > 0 {
+		return apierrors.NewInvalid(GroupVersion.WithKind("Kyma").GroupKind(), kyma.Name, errs)
+	}
+	return w.validate(ctx, kyma, old)
+}
+
+// ValidateDelete allows to delete every Kyma.
+func (w *KymaWebhook) ValidateDelete(ctx context.Context, obj runtime.Object) error {
+	return nil
+}
+
+// validate validates the Kyma. The channel and the components not changed by the update are not validated again,
+// the catalog may have dropped them since and the updates of the labels and the channel by the controllers must pass
+func (w *KymaWebhook) validate(ctx context.Context, kyma *Kyma, old *Kyma) error {
+	kymalog.V(2).Info("validate", "name", kyma.Name)
+
+	catalog, err := w.catalog(ctx)
+	if err != nil {
+		return err
+	}
+	var errs field.ErrorList
+	if (old == nil || old.Spec.Channel != kyma.Spec.Channel) && !catalog.Spec.HasChannel(kyma.Spec.Channel) {
+		errs = append(errs, field.NotSupported(field.NewPath("spec").Child("channel"), kyma.Spec.Channel, catalog.Spec.ChannelNames()))
+	}
+	path := field.NewPath("spec").Child("components")
+	names := map[string]bool{}
+	for i, c := range kyma.Spec.Components {
+		if names[c.Name] {
+			errs = append(errs, field.Duplicate(path.Index(i).Child("name"), c.Name))
+			continue
+		}
+		names[c.Name] = true
+		if old != nil && old.Spec.HasComponent(c.Name) {
+			continue
+		}
+		if catalog.Spec.Component(c.Name) == nil {
+			errs = append(errs, field.NotFound(path.Index(i).Child("name"), c.Name))
+			continue
+		}
+		if cycle := dependencyCycle(&catalog.Spec, c.Name); cycle != nil {
+			errs = append(errs, field.Invalid(path.Index(i).Child("name"), c.Name, fmt.Sprintf("dependency cycle %v", cycle)))
+		}
+	}
+	if len(errs) > 0 {
+		return apierrors.NewInvalid(GroupVersion.WithKind("Kyma").GroupKind(), kyma.Name, errs)
+	}
+	return nil
+}
+
+// catalog returns the ComponentCatalog from the cluster or the fallback catalog if it is not created yet.
+func (w *KymaWebhook) catalog(ctx context.Context) (*ComponentCatalog, error) {
+	name := w.CatalogName
+	if name == "" {
+		name = DefaultComponentCatalogName
+	}
+	var catalog ComponentCatalog
+	if err := w.Client.Get(ctx, client.ObjectKey{Name: name}, &catalog); err != nil {
+		if apierrors.IsNotFound(err) && w.Fallback != nil {
+			return w.Fallback, nil
+		}
+		return nil, err
+	}
+	return &catalog, nil
+}
+
+// dependencyCycle returns the components forming a dependency cycle reachable from the component or nil.
+func dependencyCycle(catalog *ComponentCatalogSpec, name string) []string {
+	var path []string
+	visiting := map[string]bool{}
+	done := map[string]bool{}
+	var visit func(name string) []string
+	visit = func(name string) []string {
+		if done[name] {
+			return nil
+		}
+		if visiting[name] {
+			for i, n := range path {
+				if n == name {
+					return append(append([]string{}, path[i:]...), name)
+				}
+			}
+		}
+		visiting[name] = true
+		path = append(path, name)
+		if entry := catalog.Component(name); entry != nil {
+			for _, dependency := range entry.Dependencies {
+				if cycle := visit(dependency); cycle != nil {
+					return cycle
+				}
+			}
+		}
+		path = path[:len(path)-1]
+		visiting[name] = false
+		done[name] = true
+		return nil
+	}
+	return visit(name)
+}
@@ -0,0 +1,120 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+var _ = Describe("Kyma webhook", func() {
+	newKyma := func(name string, components ...ComponentSpec) *Kyma {
+		return &Kyma{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "default"},
+			Spec:       KymaSpec{Components: components},
+		}
+	}
+
+	It("defaults component namespaces from the catalog", func() {
+		kyma := newKyma("defaults",
+			ComponentSpec{Name: "istio"},
+			ComponentSpec{Name: "eventing"},
+			ComponentSpec{Name: "serverless", Namespace: "custom"})
+		Expect(k8sClient.Create(ctx, kyma)).To(Succeed())
+
+		Expect(kyma.Spec.Components[0].Namespace).To(Equal("istio-system"))
+		Expect(kyma.Spec.Components[1].Namespace).To(Equal("kyma-system"))
+		Expect(kyma.Spec.Components[2].Namespace).To(Equal("custom"))
+	})
+
+	It("rejects unknown components", func() {
+		err := k8sClient.Create(ctx, newKyma("unknown", ComponentSpec{Name: "istio"}, ComponentSpec{Name: "unknown"}))
+		Expect(apierrors.IsInvalid(err)).To(BeTrue())
+		Expect(err.Error()).To(ContainSubstring("spec.components[1].name"))
+	})
+
+	It("rejects duplicated components", func() {
+		err := k8sClient.Create(ctx, newKyma("duplicates", ComponentSpec{Name: "eventing"}, ComponentSpec{Name: "eventing"}))
+		Expect(apierrors.IsInvalid(err)).To(BeTrue())
+		Expect(err.Error()).To(ContainSubstring("Duplicate value"))
+	})
+
+	It("rejects components with dependency cycles", func() {
+		err := k8sClient.Create(ctx, newKyma("cycle", ComponentSpec{Name: "foo"}))
+		Expect(apierrors.IsInvalid(err)).To(BeTrue())
+		Expect(err.Error()).To(ContainSubstring("dependency cycle [foo bar baz foo]"))
+	})
+
+	It("rejects unknown channels", func() {
+		kyma := newKyma("channel", ComponentSpec{Name: "eventing"})
+		kyma.Spec.Channel = "fsat"
+		err := k8sClient.Create(ctx, kyma)
+		Expect(apierrors.IsInvalid(err)).To(BeTrue())
+		Expect(err.Error()).To(ContainSubstring("spec.channel"))
+
+		kyma.Spec.Channel = "fast"
+		Expect(k8sClient.Create(ctx, kyma)).To(Succeed())
+		kyma.Spec.Channel = "stabel"
+		err = k8sClient.Update(ctx, kyma)
+		Expect(apierrors.IsInvalid(err)).To(BeTrue())
+		Expect(err.Error()).To(ContainSubstring("supported values: \"fast\", \"stable\""))
+	})
+
+	It("validates updates", func() {
+		kyma := newKyma("update", ComponentSpec{Name: "eventing"})
+		Expect(k8sClient.Create(ctx, kyma)).To(Succeed())
+
+		kyma.Spec.Components = append(kyma.Spec.Components, ComponentSpec{Name: "unknown"})
+		err := k8sClient.Update(ctx, kyma)
+		Expect(apierrors.IsInvalid(err)).To(BeTrue())
+	})
+
+	It("accepts updates of Kymas with components removed from the catalog", func() {
+		var catalog ComponentCatalog
+		Expect(k8sClient.Get(ctx, client.ObjectKey{Name: DefaultComponentCatalogName}, &catalog)).To(Succeed())
+		catalog.Spec.Components = append(catalog.Spec.Components, CatalogComponent{Name: "legacy"})
+		Expect(k8sClient.Update(ctx, &catalog)).To(Succeed())
+		kyma := newKyma("legacy", ComponentSpec{Name: "eventing"}, ComponentSpec{Name: "legacy"})
+		Expect(k8sClient.Create(ctx, kyma)).To(Succeed())
+
+		catalog.Spec.Components = catalog.Spec.Components[:len(catalog.Spec.Components)-1]
+		Expect(k8sClient.Update(ctx, &catalog)).To(Succeed())
+		kyma.Labels = map[string]string{"region": "europe"}
+		kyma.Spec.Channel = "fast"
+		Expect(k8sClient.Update(ctx, kyma)).To(Succeed())
+
+		kyma.Spec.Components = append(kyma.Spec.Components, ComponentSpec{Name: "unknown"})
+		err := k8sClient.Update(ctx, kyma)
+		Expect(apierrors.IsInvalid(err)).To(BeTrue())
+		Expect(err.Error()).To(ContainSubstring("spec.components[2].name"))
+	})
+
+	It("makes the target cluster immutable", func() {
+		kyma := newKyma("cluster", ComponentSpec{Name: "eventing"})
+		kyma.Spec.ClusterRef = &ClusterReference{Name: "first"}
+		Expect(k8sClient.Create(ctx, kyma)).To(Succeed())
+
+		kyma.Spec.ClusterRef.Name = "second"
+		err := k8sClient.Update(ctx, kyma)
+		Expect(apierrors.IsInvalid(err)).To(BeTrue())
+		Expect(err.Error()).To(ContainSubstring("spec.clusterRef"))
+	})
+})
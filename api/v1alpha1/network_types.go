@@ -28,18 +28,79 @@ type NetworkSpec struct {
 	// INSERT ADDITIONAL SPEC FIELDS - desired state of cluster
 	// Important: Run "make" to regenerate code after modifying this file
 
-	// Foo is an example field of Network. Edit network_types.go to remove/update
-	Foo string `json:"foo,omitempty"`
+	// Cluster using the network
+	// +optional
+	ClusterRef *ClusterReference `json:"clusterRef,omitempty"`
+
+	// CIDR of the node network, e.g. 10.250.0.0/16
+	Nodes string `json:"nodes,omitempty"`
+	// CIDR of the pod network, e.g. 100.64.0.0/12
+	Pods string `json:"pods,omitempty"`
+	// CIDR of the service network, e.g. 100.104.0.0/13
+	Services string `json:"services,omitempty"`
+
+	// Allocate the node CIDR from a pool if it is empty
+	// +optional
+	NodesAllocation *CIDRAllocation `json:"nodesAllocation,omitempty"`
+	// Allocate the pod CIDR from a pool if it is empty
+	// +optional
+	PodsAllocation *CIDRAllocation `json:"podsAllocation,omitempty"`
+	// Allocate the service CIDR from a pool if it is empty
+	// +optional
+	ServicesAllocation *CIDRAllocation `json:"servicesAllocation,omitempty"`
+
+	// Identifier of the VPC (VNet) of the provider
+	// +optional
+	VpcID string `json:"vpcID,omitempty"`
+	// Networks in the same namespace with the same peering group are peered and must not overlap
+	// +optional
+	PeeringGroup string `json:"peeringGroup,omitempty"`
+}
+
+// CIDRAllocation requests a block from a NetworkPool in the same namespace
+type CIDRAllocation struct {
+	// Name of the NetworkPool
+	Pool string `json:"pool"`
+	// Prefix length of the block, e.g. 16
+	// +kubebuilder:validation:Minimum=0
+	// +kubebuilder:validation:Maximum=128
+	PrefixLength int `json:"prefixLength"`
+}
+
+// NetworkConflict is an overlap of a CIDR of the network with a CIDR of the same or a peered network
+type NetworkConflict struct {
+	// Field of the network, e.g. pods
+	Field string `json:"field"`
+	// Name of the overlapping network
+	Network string `json:"network"`
+	// Field of the overlapping network
+	NetworkField string `json:"networkField"`
 }
 
 // NetworkStatus defines the observed state of Network
 type NetworkStatus struct {
 	// INSERT ADDITIONAL STATUS FIELD - define observed state of cluster
 	// Important: Run "make" to regenerate code after modifying this file
+
+	// True if the CIDRs are valid and don't overlap
+	// +optional
+	Valid bool `json:"valid,omitempty"`
+
+	// Invalid CIDRs and failed allocations
+	// +optional
+	Errors []string `json:"errors,omitempty"`
+
+	// Overlapping CIDRs
+	// +optional
+	Conflicts []NetworkConflict `json:"conflicts,omitempty"`
 }
 
 //+kubebuilder:object:root=true
 //+kubebuilder:subresource:status
+//+kubebuilder:printcolumn:name="Nodes",type="string",JSONPath=".spec.nodes"
+//+kubebuilder:printcolumn:name="Pods",type="string",JSONPath=".spec.pods"
+//+kubebuilder:printcolumn:name="Services",type="string",JSONPath=".spec.services"
+//+kubebuilder:printcolumn:name="Valid",type="boolean",JSONPath=".status.valid"
 
 // Network is the Schema for the networks API
 type Network struct {
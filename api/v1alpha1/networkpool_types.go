@@ -0,0 +1,88 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// NetworkPoolFinalizer is set on Networks with CIDRs allocated from a pool until the CIDRs are released
+const NetworkPoolFinalizer = "inventory.kyma-project.io/network-pool"
+
+// NetworkPoolSpec defines the desired state of NetworkPool
+type NetworkPoolSpec struct {
+	// CIDR the blocks are allocated from, e.g. 10.0.0.0/8
+	Supernet string `json:"supernet"`
+}
+
+// NetworkPoolAllocation is a block allocated to a Network
+type NetworkPoolAllocation struct {
+	// Name of the Network
+	Network string `json:"network"`
+	// Field of the Network, e.g. nodes
+	Field string `json:"field"`
+	// Allocated block
+	CIDR string `json:"cidr"`
+}
+
+// NetworkPoolStatus defines the observed state of NetworkPool
+type NetworkPoolStatus struct {
+	// Blocks allocated to Networks. The list is updated with optimistic concurrency, so a block is never allocated twice
+	// +optional
+	Allocations []NetworkPoolAllocation `json:"allocations,omitempty"`
+
+	// Number of allocated blocks
+	// +optional
+	Allocated int `json:"allocated,omitempty"`
+}
+
+// Allocation returns the block allocated to the field of the network or nil
+func (s *NetworkPoolStatus) Allocation(network, field string) *NetworkPoolAllocation {
+	for i := range s.Allocations {
+		if a := &s.Allocations[i]; a.Network == network && a.Field == field {
+			return a
+		}
+	}
+	return nil
+}
+
+//+kubebuilder:object:root=true
+//+kubebuilder:subresource:status
+//+kubebuilder:printcolumn:name="Supernet",type="string",JSONPath=".spec.supernet"
+//+kubebuilder:printcolumn:name="Allocated",type="integer",JSONPath=".status.allocated"
+
+// NetworkPool is the Schema for the networkpools API
+type NetworkPool struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   NetworkPoolSpec   `json:"spec,omitempty"`
+	Status NetworkPoolStatus `json:"status,omitempty"`
+}
+
+//+kubebuilder:object:root=true
+
+// NetworkPoolList contains a list of NetworkPool
+type NetworkPoolList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []NetworkPool `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&NetworkPool{}, &NetworkPoolList{})
+}
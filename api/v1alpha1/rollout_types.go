@@ -0,0 +1,143 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+)
+
+const (
+	// RolloutLabel is set on Kymas updated by a rollout, the value is the rollout name
+	RolloutLabel = "inventory.kyma-project.io/rollout"
+	// RolloutWaveAnnotation is set on Kymas updated by a rollout, the value is the wave number
+	RolloutWaveAnnotation = "inventory.kyma-project.io/rollout-wave"
+)
+
+// Rollout phases
+const (
+	RolloutProgressing = "Progressing"
+	RolloutPaused      = "Paused"
+	RolloutHalted      = "Halted"
+	RolloutCompleted   = "Completed"
+)
+
+// RolloutSpec defines the desired state of Rollout
+type RolloutSpec struct {
+	// Selects the Kymas in the rollout namespace which are moved to the release channel
+	Selector metav1.LabelSelector `json:"selector"`
+
+	// Release channel the selected Kymas are moved to
+	Channel string `json:"channel"`
+
+	// Number or percentage of the selected Kymas updated in one wave. If not provided: 25%
+	// +optional
+	WaveSize *intstr.IntOrString `json:"waveSize,omitempty"`
+
+	// Number or percentage of failed Kymas which halts the rollout. If not provided: 0
+	// +optional
+	MaxFailures *intstr.IntOrString `json:"maxFailures,omitempty"`
+
+	// Time after which an updated Kyma which is not ready counts as failed. If not provided: 10m
+	// +optional
+	ProgressDeadline *metav1.Duration `json:"progressDeadline,omitempty"`
+
+	// Paused rollout does not start new waves
+	// +optional
+	Paused bool `json:"paused,omitempty"`
+}
+
+// RolloutWave is the progress of a single wave
+type RolloutWave struct {
+	// Wave number, starting with 1
+	Number int `json:"number"`
+
+	// Time when the Kymas of the wave were updated
+	StartTime metav1.Time `json:"startTime"`
+
+	// Time when all Kymas of the wave were ready
+	// +optional
+	CompletionTime *metav1.Time `json:"completionTime,omitempty"`
+
+	// Number of Kymas updated in the wave
+	Updated int `json:"updated"`
+
+	// Number of Kymas which are ready with the new channel
+	Succeeded int `json:"succeeded"`
+
+	// Number of Kymas which did not get ready within the progress deadline
+	Failed int `json:"failed"`
+}
+
+// RolloutStatus defines the observed state of Rollout
+type RolloutStatus struct {
+	// +optional
+	Phase string `json:"phase,omitempty"`
+
+	// Release channel of the started waves, the waves start again when spec.channel changes
+	// +optional
+	Channel string `json:"channel,omitempty"`
+
+	// Number of selected Kymas
+	// +optional
+	Total int `json:"total,omitempty"`
+
+	// Number of Kymas already using the release channel
+	// +optional
+	Updated int `json:"updated,omitempty"`
+
+	// Number of updated Kymas which are ready
+	// +optional
+	Succeeded int `json:"succeeded,omitempty"`
+
+	// Number of updated Kymas which did not get ready within the progress deadline
+	// +optional
+	Failed int `json:"failed,omitempty"`
+
+	// Progress of the started waves
+	// +optional
+	Waves []RolloutWave `json:"waves,omitempty"`
+}
+
+//+kubebuilder:object:root=true
+//+kubebuilder:subresource:status
+//+kubebuilder:printcolumn:name="Channel",type="string",JSONPath=".spec.channel"
+//+kubebuilder:printcolumn:name="Phase",type="string",JSONPath=".status.phase"
+//+kubebuilder:printcolumn:name="Updated",type="integer",JSONPath=".status.updated"
+//+kubebuilder:printcolumn:name="Total",type="integer",JSONPath=".status.total"
+
+// Rollout is the Schema for the rollouts API
+type Rollout struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   RolloutSpec   `json:"spec,omitempty"`
+	Status RolloutStatus `json:"status,omitempty"`
+}
+
+//+kubebuilder:object:root=true
+
+// RolloutList contains a list of Rollout
+type RolloutList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []Rollout `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&Rollout{}, &RolloutList{})
+}
@@ -0,0 +1,109 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// RuntimeFinalizer is set on Runtimes until their Kyma is deleted
+const RuntimeFinalizer = "inventory.kyma-project.io/runtime"
+
+// Runtime phases
+const (
+	RuntimeProvisioning   = "Provisioning"
+	RuntimeInstalling     = "Installing"
+	RuntimeReady          = "Ready"
+	RuntimeDeprovisioning = "Deprovisioning"
+)
+
+// NetworkReference points to a Network in the same namespace
+type NetworkReference struct {
+	// Name of the Network
+	Name string `json:"name"`
+}
+
+// KymaReference points to a Kyma in the same namespace
+type KymaReference struct {
+	// Name of the Kyma
+	Name string `json:"name"`
+}
+
+// RuntimeSpec defines the desired state of Runtime
+type RuntimeSpec struct {
+	// Cluster of the runtime
+	ClusterRef ClusterReference `json:"clusterRef"`
+
+	// Network of the cluster
+	// +optional
+	NetworkRef *NetworkReference `json:"networkRef,omitempty"`
+
+	// Kyma installed into the cluster. The Kyma is deleted with the runtime
+	KymaRef KymaReference `json:"kymaRef"`
+}
+
+// RuntimeStatus defines the observed state of Runtime
+type RuntimeStatus struct {
+	// Lifecycle phase aggregated from the referenced objects: Provisioning, Installing, Ready or Deprovisioning
+	// +optional
+	Phase string `json:"phase,omitempty"`
+
+	// True if the Cluster exists and its API server is reachable
+	// +optional
+	ClusterReady bool `json:"clusterReady,omitempty"`
+
+	// True if the Network exists and is valid, or no Network is referenced
+	// +optional
+	NetworkReady bool `json:"networkReady,omitempty"`
+
+	// True if the Kyma installed all components
+	// +optional
+	KymaReady bool `json:"kymaReady,omitempty"`
+
+	// Reason why the runtime is not ready
+	// +optional
+	Message string `json:"message,omitempty"`
+}
+
+//+kubebuilder:object:root=true
+//+kubebuilder:subresource:status
+//+kubebuilder:printcolumn:name="Phase",type="string",JSONPath=".status.phase"
+//+kubebuilder:printcolumn:name="Cluster",type="string",JSONPath=".spec.clusterRef.name"
+//+kubebuilder:printcolumn:name="Kyma",type="string",JSONPath=".spec.kymaRef.name"
+//+kubebuilder:printcolumn:name="Message",type="string",JSONPath=".status.message",priority=1
+
+// Runtime is the Schema for the runtimes API
+type Runtime struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   RuntimeSpec   `json:"spec,omitempty"`
+	Status RuntimeStatus `json:"status,omitempty"`
+}
+
+//+kubebuilder:object:root=true
+
+// RuntimeList contains a list of Runtime
+type RuntimeList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []Runtime `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&Runtime{}, &RuntimeList{})
+}
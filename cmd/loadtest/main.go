@@ -0,0 +1,105 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// loadtest creates Kymas at a target rate and waits until all their HelmComponents are installed
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	_ "k8s.io/client-go/plugin/pkg/client/auth"
+
+	"k8s.io/apimachinery/pkg/runtime"
+	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	inventoryv1alpha1 "github.com/kyma-incubator/kymactl/api/v1alpha1"
+	"github.com/kyma-incubator/kymactl/pkg/loadtest"
+)
+
+var scheme = runtime.NewScheme()
+
+func init() {
+	utilruntime.Must(clientgoscheme.AddToScheme(scheme))
+	utilruntime.Must(inventoryv1alpha1.AddToScheme(scheme))
+}
+
+func main() {
+	var config loadtest.Config
+	var mix string
+	var qps float64
+	var burst int
+	var cleanup bool
+	flag.IntVar(&config.Count, "count", 100, "Number of Kymas to create.")
+	flag.IntVar(&config.Namespaces, "namespaces", 1, "Number of namespaces the Kymas are spread over.")
+	flag.StringVar(&config.Prefix, "prefix", "loadtest", "Prefix of the names of the Kymas and the namespaces.")
+	flag.Float64Var(&config.Rate, "rate", 10, "Kymas created per second.")
+	flag.IntVar(&config.Workers, "workers", 10, "Number of concurrent creations.")
+	flag.StringVar(&mix, "mix", "full=1",
+		"Component mixes of the Kymas with their weights, e.g. full=1,minimal=3 or istio+logging=2. Predefined mixes: full, minimal.")
+	flag.StringVar(&config.Channel, "channel", "", "Release channel of the Kymas. If empty: the default channel of the catalog.")
+	flag.DurationVar(&config.Timeout, "timeout", 30*time.Minute, "Maximum duration of the test.")
+	flag.DurationVar(&config.ProgressInterval, "progress-interval", 10*time.Second, "Interval of the progress output.")
+	flag.Float64Var(&qps, "kube-api-qps", 100, "Maximum queries per second to the API server.")
+	flag.IntVar(&burst, "kube-api-burst", 200, "Maximum burst of queries to the API server.")
+	flag.BoolVar(&cleanup, "cleanup", false, "Delete the Kymas after the test.")
+	flag.Parse()
+
+	mixes, err := loadtest.ParseMixes(mix)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+	config.Mixes = mixes
+	config.Out = os.Stdout
+
+	restConfig, err := ctrl.GetConfig()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "unable to get kubeconfig:", err)
+		os.Exit(1)
+	}
+	restConfig.QPS = float32(qps)
+	restConfig.Burst = burst
+	c, err := client.NewWithWatch(restConfig, client.Options{Scheme: scheme})
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "unable to create client:", err)
+		os.Exit(1)
+	}
+
+	ctx := ctrl.SetupSignalHandler()
+	fmt.Printf("Creating %d Kymas in %d namespaces at %.1f/s\n", config.Count, config.Namespaces, config.Rate)
+	report, err := loadtest.Run(ctx, c, config)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	report.Print(os.Stdout)
+	if cleanup {
+		if err := loadtest.Cleanup(ctx, c, config); err != nil {
+			fmt.Fprintln(os.Stderr, "unable to delete the Kymas:", err)
+			os.Exit(1)
+		}
+	}
+	if !report.Complete() {
+		fmt.Fprintln(os.Stderr, "Not all Kymas are ready")
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,156 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"k8s.io/utils/pointer"
+
+	configv1alpha1 "github.com/kyma-incubator/kymactl/api/config/v1alpha1"
+)
+
+// controllerValues is a flag with values per controller, e.g. kyma=20,helmcomponent=40
+type controllerValues map[string]string
+
+func (v controllerValues) String() string {
+	var values []string
+	for name, value := range v {
+		values = append(values, name+"="+value)
+	}
+	sort.Strings(values)
+	return strings.Join(values, ",")
+}
+
+func (v controllerValues) Set(s string) error {
+	for _, pair := range strings.Split(s, ",") {
+		name, value, ok := strings.Cut(pair, "=")
+		if !ok || name == "" || value == "" {
+			return fmt.Errorf("expected controller=value, got %q", pair)
+		}
+		v[strings.TrimSpace(name)] = strings.TrimSpace(value)
+	}
+	return nil
+}
+
+// configFlags override the values of the configuration file
+type configFlags struct {
+	qps              float64
+	burst            int
+	concurrency      controllerValues
+	baseDelay        controllerValues
+	maxDelay         controllerValues
+	rateLimiterQPS   controllerValues
+	rateLimiterBurst controllerValues
+	resyncPeriod     time.Duration
+	resyncJitter     float64
+	startupWindow    time.Duration
+}
+
+func (f *configFlags) bind(flags *flag.FlagSet) {
+	f.concurrency = controllerValues{}
+	f.baseDelay = controllerValues{}
+	f.maxDelay = controllerValues{}
+	f.rateLimiterQPS = controllerValues{}
+	f.rateLimiterBurst = controllerValues{}
+	flags.Float64Var(&f.qps, "kube-api-qps", 150, "Queries per second to the API server.")
+	flags.IntVar(&f.burst, "kube-api-burst", 150, "Maximum burst of queries to the API server.")
+	flags.Var(f.concurrency, "max-concurrent-reconciles",
+		"Concurrent reconciliations per controller, e.g. kyma=10,helmcomponent=10. Controllers: "+strings.Join(configv1alpha1.Controllers, ", "))
+	flags.Var(f.baseDelay, "rate-limiter-base-delay", "Delay of the first retry of a failed reconciliation per controller, e.g. kyma=1s.")
+	flags.Var(f.maxDelay, "rate-limiter-max-delay", "Maximum delay of the retries of a failed reconciliation per controller, e.g. kyma=1000s.")
+	flags.Var(f.rateLimiterQPS, "rate-limiter-qps", "Reconciliations per second per controller, e.g. kyma=150.")
+	flags.Var(f.rateLimiterBurst, "rate-limiter-burst", "Maximum burst of reconciliations per controller, e.g. kyma=200.")
+	flags.DurationVar(&f.resyncPeriod, "resync-period", 0,
+		"Period after which successfully reconciled Kymas and HelmComponents are requeued, varied by the jitter. If not provided: no requeue")
+	flags.Float64Var(&f.resyncJitter, "resync-jitter", 0.2, "Fraction of the resync period the requeue varies by.")
+	flags.DurationVar(&f.startupWindow, "startup-window", 0,
+		"Window over which the reconciliations of the existing Kymas and HelmComponents are spread at startup. If not provided: no ramp")
+}
+
+// apply overrides the configuration with the flags set on the command line
+func (f *configFlags) apply(config *configv1alpha1.ProjectConfig, set map[string]bool) error {
+	if set["kube-api-qps"] || config.Client.QPS == 0 {
+		config.Client.QPS = float32(f.qps)
+	}
+	if set["kube-api-burst"] || config.Client.Burst == 0 {
+		config.Client.Burst = f.burst
+	}
+	if set["resync-period"] {
+		config.Resync.Period.Duration = f.resyncPeriod
+	}
+	if set["resync-jitter"] || config.Resync.Jitter == nil {
+		config.Resync.Jitter = pointer.Float64(f.resyncJitter)
+	}
+	if set["startup-window"] {
+		config.Resync.StartupWindow.Duration = f.startupWindow
+	}
+	if config.Controllers == nil {
+		config.Controllers = map[string]configv1alpha1.ControllerConfig{}
+	}
+	limiter := func(name string) *configv1alpha1.RateLimiterConfig {
+		c := config.Controllers[name]
+		if c.RateLimiter == nil {
+			c.RateLimiter = &configv1alpha1.RateLimiterConfig{}
+			config.Controllers[name] = c
+		}
+		return c.RateLimiter
+	}
+	for name, value := range f.concurrency {
+		n, err := strconv.Atoi(value)
+		if err != nil {
+			return fmt.Errorf("invalid max-concurrent-reconciles of %s: %w", name, err)
+		}
+		c := config.Controllers[name]
+		c.MaxConcurrentReconciles = n
+		config.Controllers[name] = c
+	}
+	for name, value := range f.baseDelay {
+		d, err := time.ParseDuration(value)
+		if err != nil {
+			return fmt.Errorf("invalid rate-limiter-base-delay of %s: %w", name, err)
+		}
+		limiter(name).BaseDelay.Duration = d
+	}
+	for name, value := range f.maxDelay {
+		d, err := time.ParseDuration(value)
+		if err != nil {
+			return fmt.Errorf("invalid rate-limiter-max-delay of %s: %w", name, err)
+		}
+		limiter(name).MaxDelay.Duration = d
+	}
+	for name, value := range f.rateLimiterQPS {
+		qps, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return fmt.Errorf("invalid rate-limiter-qps of %s: %w", name, err)
+		}
+		limiter(name).QPS = qps
+	}
+	for name, value := range f.rateLimiterBurst {
+		burst, err := strconv.Atoi(value)
+		if err != nil {
+			return fmt.Errorf("invalid rate-limiter-burst of %s: %w", name, err)
+		}
+		limiter(name).Burst = burst
+	}
+	return nil
+}
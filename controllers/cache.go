@@ -0,0 +1,80 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"sigs.k8s.io/controller-runtime/pkg/cache"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	inventoryv1alpha1 "github.com/kyma-incubator/kymactl/api/v1alpha1"
+)
+
+// MaxCachedAnnotationSize is the size of the largest annotation value kept in the cached Kymas and HelmComponents
+const MaxCachedAnnotationSize = 1024
+
+// CacheOptions strips the managed fields of all cached objects and the large annotations of the cached Kymas and
+// HelmComponents. The controllers never read them, and they are the biggest part of the objects.
+// Kymas and HelmComponents are modified with patches only, so the stripped annotations are not removed by updates.
+func CacheOptions() cache.Options {
+	return cache.Options{
+		DefaultTransform: StripManagedFields,
+		TransformByObject: cache.TransformByObject{
+			&inventoryv1alpha1.Kyma{}:          StripManagedFieldsAndAnnotations,
+			&inventoryv1alpha1.HelmComponent{}: StripManagedFieldsAndAnnotations,
+		},
+	}
+}
+
+// StripManagedFields removes the managed fields of the object
+func StripManagedFields(obj interface{}) (interface{}, error) {
+	accessor, err := meta.Accessor(obj)
+	if err != nil {
+		// tombstones of deleted objects are passed unchanged
+		return obj, nil
+	}
+	accessor.SetManagedFields(nil)
+	return obj, nil
+}
+
+// StripManagedFieldsAndAnnotations removes the managed fields, the last applied configuration of kubectl
+// and the annotations larger than MaxCachedAnnotationSize of the object
+func StripManagedFieldsAndAnnotations(obj interface{}) (interface{}, error) {
+	accessor, err := meta.Accessor(obj)
+	if err != nil {
+		return obj, nil
+	}
+	accessor.SetManagedFields(nil)
+	annotations := accessor.GetAnnotations()
+	for key, value := range annotations {
+		if key == corev1.LastAppliedConfigAnnotation || len(value) > MaxCachedAnnotationSize {
+			delete(annotations, key)
+		}
+	}
+	if len(annotations) == 0 {
+		annotations = nil
+	}
+	accessor.SetAnnotations(annotations)
+	return obj, nil
+}
+
+// mergeFrom returns a merge patch with the changes made to the object afterwards. Unlike an update, the patch doesn't
+// remove the fields stripped from the cached object. The resource version is checked, as with an update.
+func mergeFrom(obj client.Object) client.Patch {
+	return client.MergeFromWithOptions(obj.DeepCopyObject().(client.Object), client.MergeFromWithOptimisticLock{})
+}
@@ -0,0 +1,151 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"encoding/json"
+	"fmt"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	inventoryv1alpha1 "github.com/kyma-incubator/kymactl/api/v1alpha1"
+)
+
+// appliedKyma returns a Kyma with 18 components as stored by the API server after kubectl apply,
+// labeling by the controllers and status updates
+func appliedKyma(name string) *inventoryv1alpha1.Kyma {
+	kyma := &inventoryv1alpha1.Kyma{
+		TypeMeta: metav1.TypeMeta{APIVersion: apiGVStr, Kind: "Kyma"},
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace:       "default",
+			Name:            name,
+			UID:             "0b4e3f4e-6c1d-4b1e-9a57-2f0a4c7d2b11",
+			ResourceVersion: "123456",
+			Generation:      2,
+			Labels: map[string]string{
+				inventoryv1alpha1.ProviderLabel: "gcp",
+				inventoryv1alpha1.RegionLabel:   "europe-west1",
+			},
+			Annotations: map[string]string{inventoryv1alpha1.RolloutWaveAnnotation: "1"},
+		},
+		Spec: inventoryv1alpha1.KymaSpec{Channel: "stable"},
+	}
+	var fields []string
+	for i := 0; i < 18; i++ {
+		component := fmt.Sprintf("component-%02d", i)
+		kyma.Spec.Components = append(kyma.Spec.Components, inventoryv1alpha1.ComponentSpec{Name: component, Namespace: "kyma-system"})
+		kyma.Status.Versions = append(kyma.Status.Versions, inventoryv1alpha1.ComponentVersion{Name: component, Version: "1.0.0"})
+		fields = append(fields, fmt.Sprintf(`"k:{\"name\":\"%s\"}":{".":{},"f:name":{},"f:namespace":{}}`, component))
+	}
+	lastApplied, _ := json.Marshal(kyma)
+	kyma.Annotations[corev1.LastAppliedConfigAnnotation] = string(lastApplied)
+	now := metav1.NewTime(time.Now())
+	kyma.ManagedFields = []metav1.ManagedFieldsEntry{
+		{
+			Manager: "kubectl-client-side-apply", Operation: metav1.ManagedFieldsOperationUpdate, APIVersion: apiGVStr, Time: &now,
+			FieldsType: "FieldsV1",
+			FieldsV1: &metav1.FieldsV1{Raw: []byte(`{"f:metadata":{"f:annotations":{".":{},"f:kubectl.kubernetes.io/last-applied-configuration":{}}},` +
+				`"f:spec":{".":{},"f:channel":{},"f:components":{` + strings.Join(fields, ",") + `}}}`)},
+		},
+		{
+			Manager: "manager", Operation: metav1.ManagedFieldsOperationUpdate, APIVersion: apiGVStr, Time: &now,
+			FieldsType: "FieldsV1",
+			FieldsV1:   &metav1.FieldsV1{Raw: []byte(`{"f:metadata":{"f:labels":{".":{},"f:inventory.kyma-project.io/provider":{},"f:inventory.kyma-project.io/region":{}}}}`)},
+		},
+		{
+			Manager: "manager", Operation: metav1.ManagedFieldsOperationUpdate, APIVersion: apiGVStr, Time: &now, Subresource: "status",
+			FieldsType: "FieldsV1",
+			FieldsV1:   &metav1.FieldsV1{Raw: []byte(`{"f:status":{".":{},"f:channel":{},"f:status":{},"f:versions":{},"f:waitingFor":{}}}`)},
+		},
+	}
+	return kyma
+}
+
+func TestStripManagedFieldsAndAnnotations(t *testing.T) {
+	kyma := appliedKyma("kyma")
+	kyma.Annotations["large"] = strings.Repeat("x", MaxCachedAnnotationSize+1)
+
+	obj, err := StripManagedFieldsAndAnnotations(kyma)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stripped := obj.(*inventoryv1alpha1.Kyma)
+	if len(stripped.ManagedFields) != 0 {
+		t.Errorf("expected no managed fields, got %d", len(stripped.ManagedFields))
+	}
+	if len(stripped.Annotations) != 1 || stripped.Annotations[inventoryv1alpha1.RolloutWaveAnnotation] != "1" {
+		t.Errorf("expected only the rollout wave annotation, got %v", stripped.Annotations)
+	}
+	if len(stripped.Spec.Components) != 18 || len(stripped.Labels) != 2 {
+		t.Errorf("expected unchanged spec and labels, got %+v", stripped)
+	}
+
+	// tombstones are not objects
+	tombstone := "deleted"
+	if obj, err := StripManagedFields(tombstone); err != nil || obj != tombstone {
+		t.Errorf("expected unchanged tombstone, got %v %v", obj, err)
+	}
+}
+
+// BenchmarkCachedKymaMemory measures the heap used by a cached Kyma with and without the cache transform.
+// The Kymas are decoded from JSON like in the informers. Run with:
+//
+//	go test ./controllers -run NONE -bench CachedKymaMemory
+func BenchmarkCachedKymaMemory(b *testing.B) {
+	data, err := json.Marshal(appliedKyma("kyma"))
+	if err != nil {
+		b.Fatal(err)
+	}
+	for _, bm := range []struct {
+		name      string
+		transform func(interface{}) (interface{}, error)
+	}{
+		{"Full", func(obj interface{}) (interface{}, error) { return obj, nil }},
+		{"Stripped", StripManagedFieldsAndAnnotations},
+	} {
+		b.Run(bm.name, func(b *testing.B) {
+			const count = 1000
+			var before, after runtime.MemStats
+			var perObject int64
+			for n := 0; n < b.N; n++ {
+				runtime.GC()
+				runtime.ReadMemStats(&before)
+				cached := make([]interface{}, count)
+				for i := range cached {
+					kyma := &inventoryv1alpha1.Kyma{}
+					if err := json.Unmarshal(data, kyma); err != nil {
+						b.Fatal(err)
+					}
+					if cached[i], err = bm.transform(kyma); err != nil {
+						b.Fatal(err)
+					}
+				}
+				// the stripped fields are garbage now
+				runtime.GC()
+				runtime.ReadMemStats(&after)
+				perObject = (int64(after.HeapAlloc) - int64(before.HeapAlloc)) / count
+				runtime.KeepAlive(cached)
+			}
+			b.ReportMetric(float64(perObject), "heap-B/object")
+		})
+	}
+}
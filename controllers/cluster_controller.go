@@ -18,45 +18,220 @@ package controllers
 
 import (
 	"context"
+	"time"
 
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
 	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
 	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	"sigs.k8s.io/controller-runtime/pkg/source"
 
+	configv1alpha1 "github.com/kyma-incubator/kymactl/api/config/v1alpha1"
 	inventoryv1alpha1 "github.com/kyma-incubator/kymactl/api/v1alpha1"
+	"github.com/kyma-incubator/kymactl/pkg/inventory"
+)
+
+const (
+	defaultClusterProbeInterval = time.Minute
+	clusterUnreachableRequeue   = 10 * time.Second
 )
 
 // ClusterReconciler reconciles a Cluster object
 type ClusterReconciler struct {
 	client.Client
 	Scheme *runtime.Scheme
+
+	// Cache of the clients of the remote clusters
+	RemoteClusters *RemoteClusters
+	// Interval between the probes of reachable clusters. If not provided: 1m
+	ProbeInterval time.Duration
+	// Cache of the discovery documents of the OIDC issuers
+	OidcDiscoveries *OidcDiscoveries
+	// Catalog the provider and the region are validated and normalized with. If not provided: no inventory labels
+	Regions *inventory.RegionCatalog
+	// Reader of the kubeconfig Secrets, only their metadata is cached. If not provided: the Secrets are read with the client
+	APIReader client.Reader
+	// Concurrency and rate limiter of the controller. If not provided: the default configuration
+	Options controller.Options
 }
 
 //+kubebuilder:rbac:groups=inventory.kyma-project.io,resources=clusters,verbs=get;list;watch;create;update;patch;delete
 //+kubebuilder:rbac:groups=inventory.kyma-project.io,resources=clusters/status,verbs=get;update;patch
 //+kubebuilder:rbac:groups=inventory.kyma-project.io,resources=clusters/finalizers,verbs=update
+//+kubebuilder:rbac:groups=core,resources=secrets,verbs=get;list;watch
 
-// Reconcile is part of the main kubernetes reconciliation loop which aims to
-// move the current state of the cluster closer to the desired state.
-// TODO(user): Modify the Reconcile function to compare the state specified by
-// the Cluster object against the actual cluster state, and then
-// perform operations to make the cluster state reflect the state specified by
-// the user.
-//
-// For more details, check Reconcile and its Result here:
-// - https://pkg.go.dev/sigs.k8s.io/controller-runtime@v0.11.0/pkg/reconcile
+// Reconcile connects to the API server of the cluster using the kubeconfig from the Secret
+// and probes the server version. The OIDC settings are verified with the discovery document of the issuer.
+// The normalized provider and region are set as labels on the Cluster and its Kymas.
+// Reachable clusters are probed again after the probe interval, unreachable clusters sooner.
 func (r *ClusterReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
-	_ = log.FromContext(ctx)
+	log := log.FromContext(ctx)
+
+	var cluster inventoryv1alpha1.Cluster
+	if err := r.Get(ctx, req.NamespacedName, &cluster); err != nil {
+		r.RemoteClusters.Forget(req.NamespacedName)
+		return ctrl.Result{}, client.IgnoreNotFound(err)
+	}
+
+	status := inventoryv1alpha1.ClusterStatus{}
+	if r.Regions != nil && (cluster.Spec.Provider != "" || cluster.Spec.Region != "") {
+		provider, region, err := r.Regions.Normalize(cluster.Spec.Provider, cluster.Spec.Region)
+		if err != nil {
+			log.Info("Invalid provider or region", "reason", err.Error())
+			status.RegionMessage = err.Error()
+		}
+		if err := r.updateInventoryLabels(ctx, &cluster, provider, region); err != nil {
+			return ctrl.Result{}, err
+		}
+	}
+	if ref := cluster.Spec.KubeconfigSecretRef; ref == nil {
+		r.RemoteClusters.Forget(req.NamespacedName)
+		status.Message = "no kubeconfig secret"
+	} else if version, err := r.probe(ctx, req.NamespacedName, ref); err != nil {
+		log.Info("Cluster not reachable", "error", err.Error())
+		status.Message = err.Error()
+	} else {
+		status.Reachable = true
+		status.Version = version
+	}
 
-	// TODO(user): your logic here
+	if cluster.Spec.Oidc.IssuerURL != "" {
+		status.Oidc = r.OidcDiscoveries.verifyOidc(ctx, &cluster.Spec.Oidc)
+		if !status.Oidc.Verified {
+			log.Info("OIDC settings not verified", "issuer", cluster.Spec.Oidc.IssuerURL, "reason", status.Oidc.Message)
+		}
+	}
 
-	return ctrl.Result{}, nil
+	if cluster.Status.Reachable != status.Reachable || cluster.Status.Reachable && cluster.Status.Version != status.Version {
+		log.Info("Cluster reachability changed", "reachable", status.Reachable, "version", status.Version)
+	}
+	now := metav1.Now()
+	status.LastProbeTime = &now
+	cluster.Status = status
+	if err := r.Status().Update(ctx, &cluster); err != nil {
+		return ctrl.Result{}, IgnoreStatusUpdateConflict(err)
+	}
+
+	if !status.Reachable || status.Oidc != nil && !status.Oidc.Verified {
+		return ctrl.Result{RequeueAfter: clusterUnreachableRequeue}, nil
+	}
+	return ctrl.Result{RequeueAfter: r.probeInterval()}, nil
+}
+
+// probe returns the server version of the cluster
+func (r *ClusterReconciler) probe(ctx context.Context, cluster types.NamespacedName, ref *inventoryv1alpha1.KubeconfigSecretReference) (string, error) {
+	remote, err := r.RemoteClusters.ConnectSecret(ctx, r.Client, r.APIReader, cluster, ref)
+	if err != nil {
+		r.RemoteClusters.Forget(cluster)
+		return "", err
+	}
+	version, err := remote.Discovery.ServerVersion()
+	if err != nil {
+		return "", err
+	}
+	return version.GitVersion, nil
+}
+
+// updateInventoryLabels sets the provider and region labels on the Cluster and the Kymas installed into it.
+// Empty values remove the labels.
+func (r *ClusterReconciler) updateInventoryLabels(ctx context.Context, cluster *inventoryv1alpha1.Cluster, provider, region string) error {
+	log := log.FromContext(ctx)
+	if setInventoryLabels(cluster, provider, region) {
+		if err := r.Update(ctx, cluster); err != nil {
+			log.Error(err, "unable to update Cluster labels")
+			return err
+		}
+	}
+
+	var kymas inventoryv1alpha1.KymaList
+	if err := r.List(ctx, &kymas, client.InNamespace(cluster.Namespace), client.MatchingFields{clusterRefKey: cluster.Name}); err != nil {
+		log.Error(err, "unable to list Kymas")
+		return err
+	}
+	for i := range kymas.Items {
+		kyma := &kymas.Items[i]
+		patch := mergeFrom(kyma)
+		if setInventoryLabels(kyma, provider, region) {
+			if err := r.Patch(ctx, kyma, patch); err != nil {
+				log.Error(err, "unable to update Kyma labels", "kyma", kyma.Name)
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// setInventoryLabels returns true if the labels of the object changed
+func setInventoryLabels(o client.Object, provider, region string) bool {
+	labels := o.GetLabels()
+	if labels[inventoryv1alpha1.ProviderLabel] == provider && labels[inventoryv1alpha1.RegionLabel] == region {
+		return false
+	}
+	if labels == nil {
+		labels = map[string]string{}
+	}
+	for key, value := range map[string]string{inventoryv1alpha1.ProviderLabel: provider, inventoryv1alpha1.RegionLabel: region} {
+		if value == "" {
+			delete(labels, key)
+		} else {
+			labels[key] = value
+		}
+	}
+	o.SetLabels(labels)
+	return true
+}
+
+func (r *ClusterReconciler) probeInterval() time.Duration {
+	if r.ProbeInterval > 0 {
+		return r.ProbeInterval
+	}
+	return defaultClusterProbeInterval
 }
 
 // SetupWithManager sets up the controller with the Manager.
 func (r *ClusterReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	if r.RemoteClusters == nil {
+		r.RemoteClusters = &RemoteClusters{}
+	}
+	if r.OidcDiscoveries == nil {
+		r.OidcDiscoveries = &OidcDiscoveries{}
+	}
 	return ctrl.NewControllerManagedBy(mgr).
-		For(&inventoryv1alpha1.Cluster{}).
+		// status updates after each probe must not trigger the next probe
+		For(&inventoryv1alpha1.Cluster{}, builder.WithPredicates(predicate.GenerationChangedPredicate{})).
+		// only the metadata of the Secrets is cached, the kubeconfig is read with the API reader
+		Watches(&source.Kind{Type: &corev1.Secret{}}, handler.EnqueueRequestsFromMapFunc(r.clustersForSecret), builder.OnlyMetadata).
+		// new Kymas get the inventory labels of their cluster
+		Watches(&source.Kind{Type: &inventoryv1alpha1.Kyma{}}, handler.EnqueueRequestsFromMapFunc(func(o client.Object) []reconcile.Request {
+			ref := o.(*inventoryv1alpha1.Kyma).Spec.ClusterRef
+			if ref == nil {
+				return nil
+			}
+			return []reconcile.Request{{NamespacedName: types.NamespacedName{Namespace: o.GetNamespace(), Name: ref.Name}}}
+		}), builder.WithPredicates(predicate.GenerationChangedPredicate{})).
+		WithOptions(defaultOptions(r.Options, configv1alpha1.ClusterController)).
 		Complete(r)
 }
+
+// clustersForSecret maps a Secret to the Clusters using it as kubeconfig
+func (r *ClusterReconciler) clustersForSecret(o client.Object) []reconcile.Request {
+	var clusters inventoryv1alpha1.ClusterList
+	if err := r.List(context.Background(), &clusters, client.InNamespace(o.GetNamespace())); err != nil {
+		return nil
+	}
+	var requests []reconcile.Request
+	for _, c := range clusters.Items {
+		if ref := c.Spec.KubeconfigSecretRef; ref != nil && ref.Name == o.GetName() {
+			requests = append(requests, reconcile.Request{NamespacedName: types.NamespacedName{Namespace: c.Namespace, Name: c.Name}})
+		}
+	}
+	return requests
+}
@@ -0,0 +1,163 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/clientcmd"
+	clientcmdapi "k8s.io/client-go/tools/clientcmd/api"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/envtest"
+
+	inventoryv1alpha1 "github.com/kyma-incubator/kymactl/api/v1alpha1"
+	"github.com/kyma-incubator/kymactl/manifests"
+	"github.com/kyma-incubator/kymactl/pkg/inventory"
+)
+
+// startRemoteCluster starts an API server used as remote cluster and returns its kubeconfig
+func startRemoteCluster(t *testing.T) (*rest.Config, []byte) {
+	remote := &envtest.Environment{}
+	config, err := remote.Start()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		if err := remote.Stop(); err != nil {
+			t.Error(err)
+		}
+	})
+	kubeconfig, err := clientcmd.Write(clientcmdapi.Config{
+		Clusters:       map[string]*clientcmdapi.Cluster{"remote": {Server: config.Host, CertificateAuthorityData: config.CAData}},
+		AuthInfos:      map[string]*clientcmdapi.AuthInfo{"remote": {ClientCertificateData: config.CertData, ClientKeyData: config.KeyData}},
+		Contexts:       map[string]*clientcmdapi.Context{"remote": {Cluster: "remote", AuthInfo: "remote"}},
+		CurrentContext: "remote",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return config, kubeconfig
+}
+
+func TestClusterProbesRemoteAPIServer(t *testing.T) {
+	_, kubeconfig := startRemoteCluster(t)
+
+	key := types.NamespacedName{Namespace: "default", Name: "remote"}
+	r := &ClusterReconciler{RemoteClusters: &RemoteClusters{}, Client: newTestClient(t,
+		&corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Namespace: key.Namespace, Name: "remote-kubeconfig"},
+			Data:       map[string][]byte{inventoryv1alpha1.DefaultKubeconfigKey: kubeconfig},
+		},
+		&inventoryv1alpha1.Cluster{
+			ObjectMeta: metav1.ObjectMeta{Namespace: key.Namespace, Name: key.Name},
+			Spec:       inventoryv1alpha1.ClusterSpec{KubeconfigSecretRef: &inventoryv1alpha1.KubeconfigSecretReference{Name: "remote-kubeconfig"}},
+		})}
+
+	cluster := reconcileAndGet(t, r, key, &inventoryv1alpha1.Cluster{})
+	if !cluster.Status.Reachable || cluster.Status.Version == "" || cluster.Status.LastProbeTime == nil {
+		t.Fatalf("expected reachable cluster with version, got %+v", cluster.Status)
+	}
+
+	remote, ok := r.RemoteClusters.Get(key)
+	if !ok {
+		t.Fatal("expected cached remote cluster")
+	}
+	var namespaces corev1.NamespaceList
+	if err := remote.Client.List(context.Background(), &namespaces); err != nil || len(namespaces.Items) == 0 {
+		t.Fatalf("expected namespaces of the remote cluster, got %v", err)
+	}
+
+	// the cached clients are reused while the secret doesn't change
+	reconcileAndGet(t, r, key, &inventoryv1alpha1.Cluster{})
+	if cached, _ := r.RemoteClusters.Get(key); cached != remote {
+		t.Fatal("expected cached clients to be reused")
+	}
+}
+
+func TestClusterWithoutValidKubeconfigIsNotReachable(t *testing.T) {
+	key := types.NamespacedName{Namespace: "default", Name: "broken"}
+	r := &ClusterReconciler{RemoteClusters: &RemoteClusters{}, Client: newTestClient(t,
+		&corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Namespace: key.Namespace, Name: "broken-kubeconfig"},
+			Data:       map[string][]byte{"config": []byte("not a kubeconfig")},
+		},
+		&inventoryv1alpha1.Cluster{
+			ObjectMeta: metav1.ObjectMeta{Namespace: key.Namespace, Name: key.Name},
+			Spec:       inventoryv1alpha1.ClusterSpec{KubeconfigSecretRef: &inventoryv1alpha1.KubeconfigSecretReference{Name: "broken-kubeconfig", Key: "config"}},
+		})}
+
+	cluster := reconcileAndGet(t, r, key, &inventoryv1alpha1.Cluster{})
+	if cluster.Status.Reachable || cluster.Status.Message == "" {
+		t.Fatalf("expected unreachable cluster with message, got %+v", cluster.Status)
+	}
+	if _, ok := r.RemoteClusters.Get(key); ok {
+		t.Fatal("expected no cached remote cluster")
+	}
+}
+
+func TestClusterLabelsKymasWithNormalizedRegion(t *testing.T) {
+	regions, err := inventory.LoadRegions(manifests.FS, manifests.RegionsFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	key := types.NamespacedName{Namespace: "default", Name: "gcp"}
+	r := &ClusterReconciler{RemoteClusters: &RemoteClusters{}, Client: newIndexedTestClient(t,
+		&inventoryv1alpha1.Cluster{
+			ObjectMeta: metav1.ObjectMeta{Namespace: key.Namespace, Name: key.Name},
+			Spec:       inventoryv1alpha1.ClusterSpec{Provider: "Google", Region: "Europe-West1"},
+		},
+		&inventoryv1alpha1.Kyma{
+			ObjectMeta: metav1.ObjectMeta{Namespace: key.Namespace, Name: "installed"},
+			Spec:       inventoryv1alpha1.KymaSpec{ClusterRef: &inventoryv1alpha1.ClusterReference{Name: key.Name}},
+		},
+		&inventoryv1alpha1.Kyma{
+			ObjectMeta: metav1.ObjectMeta{Namespace: key.Namespace, Name: "other"},
+			Spec:       inventoryv1alpha1.KymaSpec{ClusterRef: &inventoryv1alpha1.ClusterReference{Name: "other"}},
+		})}
+	r.Regions = regions
+
+	cluster := reconcileAndGet(t, r, key, &inventoryv1alpha1.Cluster{})
+	if cluster.Labels[inventoryv1alpha1.ProviderLabel] != "gcp" || cluster.Labels[inventoryv1alpha1.RegionLabel] != "europe-west1" {
+		t.Fatalf("unexpected cluster labels %v", cluster.Labels)
+	}
+	selector := client.MatchingLabels{inventoryv1alpha1.ProviderLabel: "gcp", inventoryv1alpha1.RegionLabel: "europe-west1"}
+	var kymas inventoryv1alpha1.KymaList
+	if err := r.List(context.Background(), &kymas, selector); err != nil {
+		t.Fatal(err)
+	}
+	if len(kymas.Items) != 1 || kymas.Items[0].Name != "installed" {
+		t.Fatalf("expected only the installed Kyma to be labeled, got %v", kymas.Items)
+	}
+
+	// invalid regions remove the labels
+	cluster.Spec.Region = "mars-north1"
+	if err := r.Update(context.Background(), cluster); err != nil {
+		t.Fatal(err)
+	}
+	cluster = reconcileAndGet(t, r, key, &inventoryv1alpha1.Cluster{})
+	if cluster.Status.RegionMessage == "" || cluster.Labels[inventoryv1alpha1.RegionLabel] != "" {
+		t.Fatalf("expected invalid region without labels, got %v %+v", cluster.Labels, cluster.Status)
+	}
+	if err := r.List(context.Background(), &kymas, selector); err != nil || len(kymas.Items) != 0 {
+		t.Fatalf("expected no labeled Kymas, got %v %v", kymas.Items, err)
+	}
+}
@@ -0,0 +1,123 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"time"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/wait"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	inventoryv1alpha1 "github.com/kyma-incubator/kymactl/api/v1alpha1"
+	"github.com/kyma-incubator/kymactl/pkg/helm"
+)
+
+// ComponentCatalogSeeder creates the default ComponentCatalog from the embedded components.yaml on first start.
+// An existing catalog is never overwritten, so changes made in the cluster survive restarts.
+// Failed creations are retried with backoff, only an invalid catalog stops the manager.
+type ComponentCatalogSeeder struct {
+	client.Client
+	// Components from the embedded components.yaml
+	Components *helm.ComponentList
+	// Charts used to list the available versions of each component
+	Charts *helm.Catalog
+	// Backoff between the creation attempts. If not provided: from 1s up to 5m
+	Backoff *wait.Backoff
+}
+
+//+kubebuilder:rbac:groups=inventory.kyma-project.io,resources=componentcatalogs,verbs=get;list;watch;create;update;patch;delete
+//+kubebuilder:rbac:groups=inventory.kyma-project.io,resources=componentcatalogs/status,verbs=get;update;patch
+
+// Start implements manager.Runnable.
+func (s *ComponentCatalogSeeder) Start(ctx context.Context) error {
+	log := ctrl.Log.WithName("catalog-seeder")
+	backoff := wait.Backoff{Duration: time.Second, Factor: 2, Jitter: 0.1, Steps: 10, Cap: 5 * time.Minute}
+	if s.Backoff != nil {
+		backoff = *s.Backoff
+	}
+	for {
+		catalog := NewComponentCatalog(inventoryv1alpha1.DefaultComponentCatalogName, s.Components, s.Charts)
+		err := s.Create(ctx, catalog)
+		switch {
+		case err == nil:
+			log.Info("Component catalog created", "name", catalog.Name, "components", len(catalog.Spec.Components))
+			return nil
+		case apierrors.IsAlreadyExists(err):
+			log.V(2).Info("Component catalog already exists", "name", catalog.Name)
+			return nil
+		case apierrors.IsInvalid(err) || apierrors.IsBadRequest(err):
+			// the embedded catalog is rejected, retrying does not help
+			log.Error(err, "unable to create component catalog", "name", catalog.Name)
+			return err
+		}
+		delay := backoff.Step()
+		log.Error(err, "unable to create component catalog, retrying", "name", catalog.Name, "after", delay)
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(delay):
+		}
+	}
+}
+
+// seededChannels are the release channels of the seeded catalog, the first one is the default channel.
+// They select the newest chart version until the catalog is changed
+var seededChannels = []string{"stable", "fast"}
+
+// NewComponentCatalog converts the component list into a ComponentCatalog with the given name.
+func NewComponentCatalog(name string, components *helm.ComponentList, charts *helm.Catalog) *inventoryv1alpha1.ComponentCatalog {
+	catalog := &inventoryv1alpha1.ComponentCatalog{
+		ObjectMeta: metav1.ObjectMeta{Name: name},
+		Spec: inventoryv1alpha1.ComponentCatalogSpec{
+			DefaultNamespace: components.DefaultNamespace,
+			DefaultChannel:   seededChannels[0],
+		},
+	}
+	add := func(c helm.Component, prerequisite bool) {
+		versions := charts.Versions(c.Name)
+		var channels map[string]string
+		if len(versions) > 0 {
+			channels = map[string]string{}
+			for _, channel := range seededChannels {
+				channels[channel] = versions[0]
+			}
+		}
+		catalog.Spec.Components = append(catalog.Spec.Components, inventoryv1alpha1.CatalogComponent{
+			Name:             c.Name,
+			Versions:         versions,
+			DefaultNamespace: c.Namespace,
+			Prerequisite:     prerequisite,
+			Channels:         channels,
+		})
+	}
+	for _, c := range components.Prerequisites {
+		add(c, true)
+	}
+	for _, c := range components.Components {
+		add(c, false)
+	}
+	return catalog
+}
+
+// SetupWithManager adds the seeder to the Manager.
+func (s *ComponentCatalogSeeder) SetupWithManager(mgr ctrl.Manager) error {
+	return mgr.Add(s)
+}
@@ -0,0 +1,123 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	inventoryv1alpha1 "github.com/kyma-incubator/kymactl/api/v1alpha1"
+	"github.com/kyma-incubator/kymactl/manifests"
+	"github.com/kyma-incubator/kymactl/pkg/helm"
+)
+
+// failingCreateClient fails the first creations with the given errors
+type failingCreateClient struct {
+	client.Client
+	errs  []error
+	calls int
+}
+
+func (c *failingCreateClient) Create(ctx context.Context, obj client.Object, opts ...client.CreateOption) error {
+	c.calls++
+	if len(c.errs) > 0 {
+		err := c.errs[0]
+		c.errs = c.errs[1:]
+		return err
+	}
+	return c.Client.Create(ctx, obj, opts...)
+}
+
+func TestComponentCatalogSeeder(t *testing.T) {
+	scheme := runtime.NewScheme()
+	if err := inventoryv1alpha1.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+	components := &helm.ComponentList{DefaultNamespace: "kyma-system", Components: []helm.Component{{Name: "istio"}}}
+	catalogs := schema.GroupResource{Group: inventoryv1alpha1.GroupVersion.Group, Resource: "componentcatalogs"}
+	backoff := &wait.Backoff{Duration: time.Millisecond, Factor: 2, Steps: 10}
+
+	c := &failingCreateClient{Client: fake.NewClientBuilder().WithScheme(scheme).Build(), errs: []error{
+		apierrors.NewServiceUnavailable("etcd leader changed"),
+		apierrors.NewTimeoutError("request timed out", 1),
+	}}
+	seeder := &ComponentCatalogSeeder{Client: c, Components: components, Charts: &helm.Catalog{}, Backoff: backoff}
+	if err := seeder.Start(context.Background()); err != nil {
+		t.Fatalf("expected transient errors retried, got %v", err)
+	}
+	if c.calls != 3 {
+		t.Errorf("expected 3 creation attempts, got %d", c.calls)
+	}
+	catalog := &inventoryv1alpha1.ComponentCatalog{}
+	if err := c.Get(context.Background(), types.NamespacedName{Name: inventoryv1alpha1.DefaultComponentCatalogName}, catalog); err != nil {
+		t.Fatal(err)
+	}
+	if len(catalog.Spec.Components) != 1 {
+		t.Errorf("expected seeded catalog, got %+v", catalog.Spec)
+	}
+	if err := seeder.Start(context.Background()); err != nil {
+		t.Errorf("expected existing catalog ignored, got %v", err)
+	}
+
+	invalid := apierrors.NewInvalid(inventoryv1alpha1.GroupVersion.WithKind("ComponentCatalog").GroupKind(), inventoryv1alpha1.DefaultComponentCatalogName,
+		field.ErrorList{field.Required(field.NewPath("spec", "components"), "")})
+	c = &failingCreateClient{Client: fake.NewClientBuilder().WithScheme(scheme).Build(), errs: []error{invalid}}
+	seeder = &ComponentCatalogSeeder{Client: c, Components: components, Charts: &helm.Catalog{}, Backoff: backoff}
+	if err := seeder.Start(context.Background()); !apierrors.IsInvalid(err) {
+		t.Errorf("expected invalid catalog to fail, got %v", err)
+	}
+
+	c = &failingCreateClient{Client: fake.NewClientBuilder().WithScheme(scheme).Build(), errs: []error{
+		apierrors.NewForbidden(catalogs, inventoryv1alpha1.DefaultComponentCatalogName, nil),
+	}}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	seeder = &ComponentCatalogSeeder{Client: c, Components: components, Charts: &helm.Catalog{}, Backoff: &wait.Backoff{Duration: time.Hour}}
+	if err := seeder.Start(ctx); err != nil {
+		t.Errorf("expected retries stopped with the manager, got %v", err)
+	}
+}
+
+func TestNewComponentCatalogSeedsChannels(t *testing.T) {
+	charts, err := helm.NewCatalog(manifests.FS, manifests.ChartsDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	components, err := helm.LoadComponents(manifests.FS, manifests.ComponentsFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	catalog := NewComponentCatalog(inventoryv1alpha1.DefaultComponentCatalogName, components, charts)
+	if catalog.Spec.DefaultChannel != "stable" || !catalog.Spec.HasChannel("fast") || catalog.Spec.HasChannel("stabel") {
+		t.Errorf("expected the channels stable and fast, got %v", catalog.Spec.ChannelNames())
+	}
+	for _, c := range catalog.Spec.Components {
+		if c.VersionFor("stable") == "" || c.VersionFor("stable") != c.Versions[0] {
+			t.Errorf("expected %s to resolve to its newest version %v, got %q", c.Name, c.Versions, c.VersionFor("stable"))
+		}
+	}
+}
@@ -19,28 +19,57 @@ package controllers
 import (
 	"context"
 	"fmt"
+	"hash/fnv"
+	"strconv"
+	"sync"
 	"time"
 
-	"golang.org/x/time/rate"
-
+	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/runtime"
-	"k8s.io/client-go/util/workqueue"
+	"k8s.io/apimachinery/pkg/types"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/controller"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
 	"sigs.k8s.io/controller-runtime/pkg/log"
 	"sigs.k8s.io/controller-runtime/pkg/predicate"
-	"sigs.k8s.io/controller-runtime/pkg/ratelimiter"
+	"sigs.k8s.io/controller-runtime/pkg/source"
 
+	configv1alpha1 "github.com/kyma-incubator/kymactl/api/config/v1alpha1"
 	inventoryv1alpha1 "github.com/kyma-incubator/kymactl/api/v1alpha1"
-	"github.com/kyma-incubator/kymactl/manifests"
 	"github.com/kyma-incubator/kymactl/pkg/helm"
 )
 
 // HelmComponentReconciler reconciles a HelmComponent object
 type HelmComponentReconciler struct {
 	client.Client
-	Scheme    *runtime.Scheme
+	Scheme *runtime.Scheme
+	// Catalog of the charts that can be installed
+	Catalog *helm.Catalog
+	// Clients of the clusters the components are installed to
+	RemoteClusters *RemoteClusters
+	// Reader of the kubeconfig Secrets, only their metadata is cached. If not provided: the Secrets are read with the client
+	APIReader client.Reader
+	// Fence of the installations of the components of the shard. If not provided: the installations are not checked
+	Fence *ShardFence
+	// Concurrency and rate limiter of the controller. If not provided: the default configuration
+	Options controller.Options
+	// Requeue of the successfully reconciled objects. If not provided: no requeue
+	Resync Resync
+	// Window over which the reconciliations of the existing objects are spread at startup. If not provided: no ramp
+	StartupWindow time.Duration
+	// Duration of a step of the simulated installation per character of the component name
+	// (components without clusterRef). If not provided: 1s
+	SimulationStep time.Duration
+	// Key from which the seeds of the deterministic rendering are derived, every component of a Kyma gets its own seed.
+	// The generated passwords and certificates stay the same when a component is installed again.
+	// If not provided: the charts generate new values on every installation
+	RenderKey []byte
+	// Reuse the generated values of the Secrets existing in the target cluster (lookup mode)
+	ReuseSecrets bool
+
+	queue     *priorityQueue
+	mu        sync.Mutex
 	manifests map[string]string
 }
 
@@ -66,8 +95,17 @@ func (r *HelmComponentReconciler) Reconcile(ctx context.Context, req ctrl.Reques
 
 		return ctrl.Result{}, client.IgnoreNotFound(err)
 	}
+	if helmComponent.Spec.ClusterRef != nil {
+		return r.install(ctx, &helmComponent)
+	}
+
 	prevStatus := helmComponent.Status.Status
-	requeue := time.Duration(len(helmComponent.Spec.ComponentName)) * time.Second
+	resync := false
+	step := r.SimulationStep
+	if step == 0 {
+		step = time.Second
+	}
+	requeue := time.Duration(len(helmComponent.Spec.ComponentName)) * step
 	switch prevStatus {
 	case "pending":
 		helmComponent.Status.Status = "started"
@@ -77,25 +115,29 @@ func (r *HelmComponentReconciler) Reconcile(ctx context.Context, req ctrl.Reques
 		helmComponent.Status.Status = "retrying"
 	case "retrying":
 		helmComponent.Status.Status = "success"
+		helmComponent.Status.Version = helmComponent.Spec.Version
 	case "success":
 		requeue = 0 * time.Second
+		resync = true
+		if helmComponent.Status.Version != helmComponent.Spec.Version {
+			// version changed - install the new one
+			helmComponent.Status.Status = "pending"
+			requeue = step
+		}
 	default:
 		helmComponent.Status.Status = "pending"
-		requeue = 1 * time.Second
+		requeue = step
 	}
 
 	log.V(2).Info("Reconciliation", "status", helmComponent.Status.Status, "requeue", requeue)
 	if helmComponent.Status.Status != prevStatus {
-		manifest := r.manifests[helmComponent.Spec.ComponentName]
-		if manifest == "" {
-			renderer := helm.NewGenericRenderer(manifests.FS, "charts/"+helmComponent.Spec.ComponentName, helmComponent.Spec.ComponentName, helmComponent.Spec.Namespace)
-			renderer.Run()
-			manifest, err := renderer.RenderManifest("")
-			if err != nil {
-				log.Error(fmt.Errorf("Rendering error"), "Cannot render chart")
-			}
-			log.Info("New manifest rendered")
-			r.manifests[helmComponent.Spec.ComponentName] = manifest
+		chart, err := r.chartFor(&helmComponent)
+		if err != nil {
+			log.Error(err, "Chart not found in catalog")
+			return ctrl.Result{}, nil
+		}
+		if _, err := r.manifestFor(ctx, chart, helmComponent.Spec.Namespace, ""); err != nil {
+			log.Error(err, "Cannot render chart")
 		}
 		if err := r.Status().Update(ctx, &helmComponent); err != nil {
 			return ctrl.Result{}, err
@@ -104,21 +146,199 @@ func (r *HelmComponentReconciler) Reconcile(ctx context.Context, req ctrl.Reques
 	if requeue > 0*time.Second {
 		return ctrl.Result{RequeueAfter: requeue}, nil
 	}
+	if resync {
+		return r.Resync.result(r.queue, configv1alpha1.HelmComponentController, req), nil
+	}
 	return ctrl.Result{}, nil
 }
 
-func CustomRateLimiter() ratelimiter.RateLimiter {
-	return workqueue.NewMaxOfRateLimiter(
-		workqueue.NewItemExponentialFailureRateLimiter(1*time.Second, 1000*time.Second),
-		&workqueue.BucketRateLimiter{Limiter: rate.NewLimiter(rate.Limit(150), 200)})
+// chartFor resolves the chart of the component. ChartLocation overrides the chart name, by convention it is the component name.
+func (r *HelmComponentReconciler) chartFor(helmComponent *inventoryv1alpha1.HelmComponent) (*helm.ChartInfo, error) {
+	name := helmComponent.Spec.ChartLocation
+	if name == "" {
+		name = helmComponent.Spec.ComponentName
+	}
+	return r.Catalog.Get(name, helmComponent.Spec.Version)
+}
+
+// install applies the rendered manifest to the cluster of the component.
+// The component waits in the pending status until the Cluster controller connected to the cluster
+// and verified the OIDC settings needed by the component.
+func (r *HelmComponentReconciler) install(ctx context.Context, helmComponent *inventoryv1alpha1.HelmComponent) (ctrl.Result, error) {
+	log := log.FromContext(ctx)
+	if helmComponent.Status.Status == "success" && helmComponent.Status.Version == helmComponent.Spec.Version {
+		return ctrl.Result{}, nil
+	}
+
+	cluster := types.NamespacedName{Namespace: helmComponent.Namespace, Name: helmComponent.Spec.ClusterRef.Name}
+	var target inventoryv1alpha1.Cluster
+	if err := r.Get(ctx, cluster, &target); client.IgnoreNotFound(err) != nil {
+		log.Error(err, "unable to fetch Cluster", "cluster", cluster.Name)
+		return ctrl.Result{}, err
+	}
+	remote, err := r.connect(ctx, &target)
+	if err != nil || remote == nil {
+		log.Info("Cluster not connected", "cluster", cluster.Name)
+		return ctrl.Result{RequeueAfter: clusterUnreachableRequeue}, r.updateStatus(ctx, helmComponent, "pending", helmComponent.Status.Version)
+	}
+	if needsOidc(helmComponent.Spec.ComponentName, &target) {
+		log.Info("OIDC settings not verified", "cluster", cluster.Name)
+		return ctrl.Result{RequeueAfter: clusterUnreachableRequeue}, r.updateStatus(ctx, helmComponent, "pending", helmComponent.Status.Version)
+	}
+	values, err := oidcValues(helmComponent.Spec.ComponentName, &target)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+	chart, err := r.chartFor(helmComponent)
+	if err != nil {
+		log.Error(err, "Chart not found in catalog")
+		return ctrl.Result{}, nil
+	}
+	namespace := helmComponent.Spec.Namespace
+	if namespace == "" {
+		namespace = helm.DefaultComponentNamespace
+	}
+	manifest, err := r.renderFor(ctx, helmComponent, remote, chart, namespace, values)
+	if err != nil {
+		log.Error(err, "Cannot render chart")
+		return ctrl.Result{}, err
+	}
+
+	// the status updates conflict when the component moved to another shard, the installation has to be checked
+	if err := r.Fence.Check(ctx, helmComponent); err != nil {
+		return ctrl.Result{}, err
+	}
+	if err := r.updateStatus(ctx, helmComponent, "started", helmComponent.Status.Version); err != nil {
+		return ctrl.Result{}, err
+	}
+	if err := applyManifest(ctx, remote.Client, namespace, manifest); err != nil {
+		log.Error(err, "Installation failed", "cluster", cluster.Name)
+		if err := r.updateStatus(ctx, helmComponent, "failing", helmComponent.Status.Version); err != nil {
+			return ctrl.Result{}, err
+		}
+		return ctrl.Result{}, err
+	}
+	log.Info("Component installed", "cluster", cluster.Name, "version", helmComponent.Spec.Version)
+	return r.Resync.result(r.queue, configv1alpha1.HelmComponentController, ctrl.Request{NamespacedName: client.ObjectKeyFromObject(helmComponent)}),
+		r.updateStatus(ctx, helmComponent, "success", helmComponent.Spec.Version)
+}
+
+// connect returns the clients of the Cluster controller. Replicas which don't run the Cluster controller (sharding)
+// connect to the clusters reported reachable themselves. Returns nil if the cluster is not connected.
+func (r *HelmComponentReconciler) connect(ctx context.Context, cluster *inventoryv1alpha1.Cluster) (*RemoteCluster, error) {
+	key := types.NamespacedName{Namespace: cluster.Namespace, Name: cluster.Name}
+	if remote, ok := r.RemoteClusters.Get(key); ok {
+		return remote, nil
+	}
+	ref := cluster.Spec.KubeconfigSecretRef
+	if !cluster.Status.Reachable || ref == nil {
+		return nil, nil
+	}
+	return r.RemoteClusters.ConnectSecret(ctx, r.Client, r.APIReader, key, ref)
+}
+
+func (r *HelmComponentReconciler) updateStatus(ctx context.Context, helmComponent *inventoryv1alpha1.HelmComponent, status, version string) error {
+	if helmComponent.Status.Status == status && helmComponent.Status.Version == version {
+		return nil
+	}
+	helmComponent.Status.Status = status
+	helmComponent.Status.Version = version
+	return r.Status().Update(ctx, helmComponent)
+}
+
+// renderFor renders the chart of the component for its cluster. The manifests of the deterministic rendering are specific
+// to the component and those reusing the Secrets to the state of the cluster, they are not cached.
+func (r *HelmComponentReconciler) renderFor(ctx context.Context, helmComponent *inventoryv1alpha1.HelmComponent, remote *RemoteCluster,
+	chart *helm.ChartInfo, namespace, values string) (string, error) {
+	if r.RenderKey == nil && !r.ReuseSecrets {
+		return r.manifestFor(ctx, chart, namespace, values)
+	}
+	renderer, err := chart.Renderer(namespace)
+	if err != nil {
+		return "", err
+	}
+	if r.RenderKey != nil {
+		kyma, ok := helmComponent.Labels[inventoryv1alpha1.KymaLabel]
+		if !ok {
+			// component created without Kyma
+			kyma = helmComponent.Name
+		}
+		seed := helm.ComponentSeed(r.RenderKey, helmComponent.Namespace, kyma, helmComponent.Spec.ComponentName)
+		// the certificates are valid from the creation of the component
+		renderer = renderer.WithSeed(seed, helmComponent.CreationTimestamp.Time)
+	}
+	if r.ReuseSecrets {
+		renderer = renderer.WithSecretLookup(remoteSecrets(ctx, remote.Client))
+	}
+	manifest, err := renderer.RenderManifest(values)
+	if err != nil {
+		return "", fmt.Errorf("rendering %s:%s failed: %w", chart.Name, chart.Version, err)
+	}
+	return manifest, nil
+}
+
+// remoteSecrets looks up the Secrets in the cluster of the component
+func remoteSecrets(ctx context.Context, c client.Client) helm.SecretLookup {
+	return func(namespace, name string) (map[string][]byte, error) {
+		var secret corev1.Secret
+		if err := c.Get(ctx, types.NamespacedName{Namespace: namespace, Name: name}, &secret); err != nil {
+			return nil, client.IgnoreNotFound(err)
+		}
+		return secret.Data, nil
+	}
+}
+
+// manifestFor renders the chart for the namespace with the values. Rendered manifests are cached.
+func (r *HelmComponentReconciler) manifestFor(ctx context.Context, chart *helm.ChartInfo, namespace, values string) (string, error) {
+	log := log.FromContext(ctx)
+	key := chart.Name + ":" + chart.Version + ":" + namespace
+	if values != "" {
+		hash := fnv.New64a()
+		hash.Write([]byte(values))
+		key += ":" + strconv.FormatUint(hash.Sum64(), 16)
+	}
+	r.mu.Lock()
+	manifest := r.manifests[key]
+	r.mu.Unlock()
+	if manifest != "" {
+		return manifest, nil
+	}
+
+	// the workers render different charts concurrently, a chart missing in the cache may be rendered twice
+	renderer, err := chart.Renderer(namespace)
+	if err != nil {
+		return "", err
+	}
+	manifest, err = renderer.RenderManifest(values)
+	if err != nil {
+		return "", fmt.Errorf("rendering %s failed: %w", key, err)
+	}
+	log.Info("New manifest rendered", "chart", key)
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.manifests == nil {
+		r.manifests = make(map[string]string)
+	}
+	r.manifests[key] = manifest
+	return manifest, nil
 }
 
 // SetupWithManager sets up the controller with the Manager.
 func (r *HelmComponentReconciler) SetupWithManager(mgr ctrl.Manager) error {
-	r.manifests = make(map[string]string)
-	return ctrl.NewControllerManagedBy(mgr).
-		For(&inventoryv1alpha1.HelmComponent{}).
-		WithEventFilter(predicate.GenerationChangedPredicate{}).
-		WithOptions(controller.Options{MaxConcurrentReconciles: 10, RateLimiter: CustomRateLimiter()}).
-		Complete(r)
+	if r.RemoteClusters == nil {
+		r.RemoteClusters = &RemoteClusters{}
+	}
+	options := defaultOptions(r.Options, configv1alpha1.HelmComponentController)
+	r.queue = newPriorityQueue(configv1alpha1.HelmComponentController, options.MaxConcurrentReconciles)
+	ramp := newStartupRamp(configv1alpha1.HelmComponentController, r.StartupWindow)
+	return newPrioritizedController(mgr, configv1alpha1.HelmComponentController, &inventoryv1alpha1.HelmComponent{}, r, options, r.queue,
+		watch{&source.Kind{Type: &inventoryv1alpha1.HelmComponent{}}, r.queue.ForObject(&handler.EnqueueRequestForObject{}),
+			[]predicate.Predicate{predicate.GenerationChangedPredicate{}, ramp.Others()}},
+		// the existing components are queued over the startup window
+		watch{&source.Kind{Type: &inventoryv1alpha1.HelmComponent{}}, r.queue.Handler(ramp.Handler(&handler.EnqueueRequestForObject{}), priorityLow),
+			[]predicate.Predicate{ramp.Existing()}},
+		// pending components are installed as soon as their Cluster is reachable
+		watch{&source.Kind{Type: &inventoryv1alpha1.Cluster{}},
+			r.queue.Handler(handler.EnqueueRequestsFromMapFunc(referencing(mgr.GetClient(), &inventoryv1alpha1.HelmComponentList{}, clusterRefKey)), priorityNormal),
+			[]predicate.Predicate{clusterReadinessChanged}})
 }
@@ -0,0 +1,188 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"encoding/base64"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	corev1 "k8s.io/api/core/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	inventoryv1alpha1 "github.com/kyma-incubator/kymactl/api/v1alpha1"
+	"github.com/kyma-incubator/kymactl/pkg/helm"
+)
+
+var testCharts = fstest.MapFS{
+	"charts/sample/Chart.yaml":            {Data: []byte("apiVersion: v2\nname: sample\nversion: 1.0.0\n")},
+	"charts/sample/values.yaml":           {Data: []byte("message: hello\n")},
+	"charts/sample/templates/config.yaml": {Data: []byte("apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: sample\ndata:\n  message: {{ .Values.message }}\n")},
+	"charts/sample/templates/role.yaml":   {Data: []byte("apiVersion: rbac.authorization.k8s.io/v1\nkind: ClusterRole\nmetadata:\n  name: sample\nrules: []\n")},
+	"charts/generated/Chart.yaml":         {Data: []byte("apiVersion: v2\nname: generated\nversion: 1.0.0\n")},
+	"charts/generated/templates/secret.yaml": {Data: []byte("apiVersion: v1\nkind: Secret\nmetadata:\n  name: credentials\n" +
+		"data:\n  password: {{ randAlphaNum 16 | b64enc }}\n  token: {{ randAlphaNum 16 | b64enc }}\n" +
+		"  ca.crt: {{ (genCA \"generated-ca\" 365).Cert | b64enc }}\n")},
+}
+
+// testChartCatalog returns the catalog of the test charts
+func testChartCatalog(t *testing.T) *helm.Catalog {
+	catalog, err := helm.NewCatalog(testCharts, "charts")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return catalog
+}
+
+func TestHelmComponentInstallsIntoRemoteCluster(t *testing.T) {
+	_, kubeconfig := startRemoteCluster(t)
+
+	key := types.NamespacedName{Namespace: "default", Name: "kyma-sample"}
+	r := &HelmComponentReconciler{Catalog: testChartCatalog(t), RemoteClusters: &RemoteClusters{}, Client: newTestClient(t, &inventoryv1alpha1.HelmComponent{
+		ObjectMeta: metav1.ObjectMeta{Namespace: key.Namespace, Name: key.Name},
+		Spec: inventoryv1alpha1.HelmComponentSpec{
+			ComponentName: "sample",
+			Version:       "1.0.0",
+			Namespace:     "sample-system",
+			ClusterRef:    &inventoryv1alpha1.ClusterReference{Name: "remote"},
+		},
+	}, &inventoryv1alpha1.Cluster{
+		ObjectMeta: metav1.ObjectMeta{Namespace: key.Namespace, Name: "remote"},
+	})}
+
+	// waits until the cluster is connected
+	if component := reconcileAndGet(t, r, key, &inventoryv1alpha1.HelmComponent{}); component.Status.Status != "pending" {
+		t.Fatalf("expected pending component, got %+v", component.Status)
+	}
+
+	cluster := types.NamespacedName{Namespace: key.Namespace, Name: "remote"}
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Namespace: key.Namespace, Name: "remote-kubeconfig", ResourceVersion: "1"},
+		Data:       map[string][]byte{inventoryv1alpha1.DefaultKubeconfigKey: kubeconfig},
+	}
+	remote, err := r.RemoteClusters.Connect(cluster, secret, inventoryv1alpha1.DefaultKubeconfigKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if component := reconcileAndGet(t, r, key, &inventoryv1alpha1.HelmComponent{}); component.Status.Status != "success" || component.Status.Version != "1.0.0" {
+		t.Fatalf("expected installed component, got %+v", component.Status)
+	}
+	var config corev1.ConfigMap
+	if err := remote.Client.Get(context.Background(), types.NamespacedName{Namespace: "sample-system", Name: "sample"}, &config); err != nil {
+		t.Fatal(err)
+	}
+	if config.Data["message"] != "hello" {
+		t.Errorf("unexpected config map data %v", config.Data)
+	}
+	var role rbacv1.ClusterRole
+	if err := remote.Client.Get(context.Background(), types.NamespacedName{Name: "sample"}, &role); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestHelmComponentRendersDeterministicallyAndReusesSecrets(t *testing.T) {
+	config, kubeconfig := startRemoteCluster(t)
+	remoteClient, err := client.New(config, client.Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	if err := remoteClient.Create(ctx, &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "generated-system"}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := remoteClient.Create(ctx, &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "generated-system", Name: "credentials"},
+		Data:       map[string][]byte{"password": []byte("existing")},
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	key := types.NamespacedName{Namespace: "default", Name: "kyma-generated"}
+	r := &HelmComponentReconciler{Catalog: testChartCatalog(t), RemoteClusters: &RemoteClusters{}, Client: newTestClient(t, &inventoryv1alpha1.HelmComponent{
+		ObjectMeta: metav1.ObjectMeta{Namespace: key.Namespace, Name: key.Name, Labels: map[string]string{inventoryv1alpha1.KymaLabel: "kyma"}},
+		Spec: inventoryv1alpha1.HelmComponentSpec{
+			ComponentName: "generated",
+			Version:       "1.0.0",
+			Namespace:     "generated-system",
+			ClusterRef:    &inventoryv1alpha1.ClusterReference{Name: "remote"},
+		},
+	}, &inventoryv1alpha1.Cluster{
+		ObjectMeta: metav1.ObjectMeta{Namespace: key.Namespace, Name: "remote"},
+	})}
+	r.RenderKey = []byte("key")
+	r.ReuseSecrets = true
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Namespace: key.Namespace, Name: "remote-kubeconfig", ResourceVersion: "1"},
+		Data:       map[string][]byte{inventoryv1alpha1.DefaultKubeconfigKey: kubeconfig},
+	}
+	if _, err := r.RemoteClusters.Connect(types.NamespacedName{Namespace: key.Namespace, Name: "remote"}, secret, inventoryv1alpha1.DefaultKubeconfigKey); err != nil {
+		t.Fatal(err)
+	}
+
+	component := reconcileAndGet(t, r, key, &inventoryv1alpha1.HelmComponent{})
+	if component.Status.Status != "success" {
+		t.Fatalf("expected installed component, got %+v", component.Status)
+	}
+
+	var installed corev1.Secret
+	if err := remoteClient.Get(ctx, types.NamespacedName{Namespace: "generated-system", Name: "credentials"}, &installed); err != nil {
+		t.Fatal(err)
+	}
+	if password := string(installed.Data["password"]); password != "existing" {
+		t.Errorf("expected the existing password, got %q", password)
+	}
+
+	// the generated values are derived from the Kyma and the component
+	chart, err := r.Catalog.Get("generated", "1.0.0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	renderer, err := chart.Renderer("generated-system")
+	if err != nil {
+		t.Fatal(err)
+	}
+	seed := helm.ComponentSeed(r.RenderKey, key.Namespace, "kyma", "generated")
+	manifest, err := renderer.WithSeed(seed, component.CreationTimestamp.Time).RenderManifest("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"token", "ca.crt"} {
+		if encoded := base64.StdEncoding.EncodeToString(installed.Data[name]); !strings.Contains(manifest, name+": "+encoded+"\n") {
+			t.Errorf("expected the %s of the seeded rendering, got %q", name, installed.Data[name])
+		}
+	}
+}
+
+func TestParseManifestOrdersDependenciesFirst(t *testing.T) {
+	objs, err := parseManifest("kind: ConfigMap\nmetadata:\n  name: a\n---\n---\nkind: Namespace\nmetadata:\n  name: b\n---\nkind: CustomResourceDefinition\nmetadata:\n  name: c\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var kinds []string
+	for _, obj := range objs {
+		kinds = append(kinds, obj.GetKind())
+	}
+	if len(kinds) != 3 || kinds[0] != "CustomResourceDefinition" || kinds[1] != "Namespace" || kinds[2] != "ConfigMap" {
+		t.Errorf("unexpected order %v", kinds)
+	}
+}
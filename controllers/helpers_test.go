@@ -0,0 +1,114 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	inventoryv1alpha1 "github.com/kyma-incubator/kymactl/api/v1alpha1"
+)
+
+// testReconciler is a reconciler embedding the client it writes with
+type testReconciler interface {
+	reconcile.Reconciler
+	client.Reader
+}
+
+// newTestClient returns a fake client serving the objects, with the client-go and the inventory types in its scheme
+func newTestClient(t *testing.T, objs ...client.Object) client.Client {
+	scheme := runtime.NewScheme()
+	if err := clientgoscheme.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+	if err := inventoryv1alpha1.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+	return fake.NewClientBuilder().WithScheme(scheme).WithObjects(objs...).Build()
+}
+
+// indexedClient filters the lists of the fake client, which ignores field selectors, with the reference indexes
+type indexedClient struct {
+	client.Client
+	indexes recordingIndexer
+}
+
+// newIndexedTestClient returns a fake client serving the objects, whose lists match the fields of the reference indexes
+func newIndexedTestClient(t *testing.T, objs ...client.Object) client.Client {
+	indexes := recordingIndexer{}
+	if err := SetupReferenceIndexes(context.Background(), indexes); err != nil {
+		t.Fatal(err)
+	}
+	return indexedClient{Client: newTestClient(t, objs...), indexes: indexes}
+}
+
+func (c indexedClient) List(ctx context.Context, list client.ObjectList, opts ...client.ListOption) error {
+	listOpts := (&client.ListOptions{}).ApplyOptions(opts)
+	selector := listOpts.FieldSelector
+	listOpts.FieldSelector = nil
+	if err := c.Client.List(ctx, list, listOpts); err != nil || selector == nil {
+		return err
+	}
+	items, err := meta.ExtractList(list)
+	if err != nil {
+		return err
+	}
+	var matching []runtime.Object
+	for _, item := range items {
+		obj := item.(client.Object)
+		matches := true
+		for _, requirement := range selector.Requirements() {
+			extract, ok := c.indexes[fmt.Sprintf("%T%s", obj, requirement.Field)]
+			if !ok {
+				return fmt.Errorf("%T not indexed by %s", obj, requirement.Field)
+			}
+			values := extract(obj)
+			matches = matches && len(values) == 1 && values[0] == requirement.Value
+		}
+		if matches {
+			matching = append(matching, item)
+		}
+	}
+	return meta.SetList(list, matching)
+}
+
+// testKey returns the key of the object with the name in the default namespace
+func testKey(name string) types.NamespacedName {
+	return types.NamespacedName{Namespace: "default", Name: name}
+}
+
+// reconcileAndGet reconciles the object with the key and returns it as stored afterwards
+func reconcileAndGet[T client.Object](t *testing.T, r testReconciler, key types.NamespacedName, obj T) T {
+	t.Helper()
+	if _, err := r.Reconcile(context.Background(), ctrl.Request{NamespacedName: key}); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Get(context.Background(), key, obj); err != nil {
+		t.Fatal(err)
+	}
+	return obj
+}
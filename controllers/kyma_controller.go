@@ -19,16 +19,24 @@ package controllers
 import (
 	"context"
 	"fmt"
+	"strings"
 	"time"
 
+	"k8s.io/apimachinery/pkg/api/equality"
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/controller"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
 	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	"sigs.k8s.io/controller-runtime/pkg/source"
 
+	configv1alpha1 "github.com/kyma-incubator/kymactl/api/config/v1alpha1"
 	inventoryv1alpha1 "github.com/kyma-incubator/kymactl/api/v1alpha1"
 )
 
@@ -36,6 +44,20 @@ import (
 type KymaReconciler struct {
 	client.Client
 	Scheme *runtime.Scheme
+	// Name of the ComponentCatalog with installable components. If not provided: default
+	CatalogName string
+	// Shard of the replica. If provided only the Kymas labeled with the shard are reconciled
+	Shard string
+	// Fence of the writes to the Kymas of the shard. If not provided: the writes are not checked
+	Fence *ShardFence
+	// Concurrency and rate limiter of the controller. If not provided: the default configuration
+	Options controller.Options
+	// Requeue of the successfully reconciled objects. If not provided: no requeue
+	Resync Resync
+	// Window over which the reconciliations of the existing objects are spread at startup. If not provided: no ramp
+	StartupWindow time.Duration
+
+	queue *priorityQueue
 }
 
 func IgnoreAlreadyExists(err error) error {
@@ -55,6 +77,9 @@ func IgnoreStatusUpdateConflict(err error) error {
 //+kubebuilder:rbac:groups=inventory.kyma-project.io,resources=kymas,verbs=get;list;watch;create;update;patch;delete
 //+kubebuilder:rbac:groups=inventory.kyma-project.io,resources=kymas/status,verbs=get;update;patch
 //+kubebuilder:rbac:groups=inventory.kyma-project.io,resources=kymas/finalizers,verbs=update
+//+kubebuilder:rbac:groups=inventory.kyma-project.io,resources=componentcatalogs,verbs=get;list;watch
+//+kubebuilder:rbac:groups=inventory.kyma-project.io,resources=clusters,verbs=get;list;watch
+//+kubebuilder:rbac:groups=inventory.kyma-project.io,resources=networks,verbs=get;list;watch
 
 // Reconcile is part of the main kubernetes reconciliation loop which aims to
 // move the current state of the cluster closer to the desired state.
@@ -79,23 +104,74 @@ func (r *KymaReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.
 	var kyma inventoryv1alpha1.Kyma
 	if err := r.Get(ctx, req.NamespacedName, &kyma); err != nil {
 		if apierrors.IsNotFound(err) {
-			// Kyma not found - delete all components
+			// Kyma not found - delete all components, unless the Kyma moved to another shard
+			if err := r.Fence.Check(ctx, &inventoryv1alpha1.Kyma{ObjectMeta: metav1.ObjectMeta{Namespace: req.Namespace, Name: req.Name}}); err != nil {
+				return ctrl.Result{}, IgnoreNotShardOwner(err)
+			}
 			for _, c := range components.Items {
 				r.Delete(ctx, &c)
 			}
 		}
 		return ctrl.Result{}, client.IgnoreNotFound(err)
 	}
+	if r.Shard != "" && kyma.Labels[inventoryv1alpha1.ShardLabel] != r.Shard {
+		// reconciled by another shard
+		return ctrl.Result{}, nil
+	}
+
+	var catalog inventoryv1alpha1.ComponentCatalog
+	if err := r.Get(ctx, client.ObjectKey{Name: r.catalogName()}, &catalog); err != nil {
+		if apierrors.IsNotFound(err) {
+			log.Info("Component catalog not found", "name", r.catalogName())
+			return ctrl.Result{RequeueAfter: 5 * time.Second}, nil
+		}
+		return ctrl.Result{}, err
+	}
+
+	// the writes fail if the replica may no longer own the Kyma
+	writer := r.Fence.Client(r.Client, &kyma)
+	original := kyma.DeepCopy()
+	clusterStatus, err := r.clusterStatus(ctx, &kyma)
+	if err != nil {
+		log.Error(err, "unable to fetch Cluster")
+		return ctrl.Result{}, err
+	}
+	kyma.Status.Cluster = clusterStatus
+
+	// Resolve component versions from the release channel
+	kyma.Status.Channel = kyma.Spec.Channel
+	if kyma.Status.Channel == "" {
+		kyma.Status.Channel = catalog.Spec.DefaultChannel
+	}
+	kyma.Status.Versions = nil
+	versions := map[string]string{}
+	for _, m := range kyma.Spec.Components {
+		if entry := catalog.Spec.Component(m.Name); entry != nil {
+			versions[m.Name] = entry.VersionFor(kyma.Status.Channel)
+		}
+		kyma.Status.Versions = append(kyma.Status.Versions, inventoryv1alpha1.ComponentVersion{Name: m.Name, Version: versions[m.Name]})
+	}
 
-	constructComponentForKyma := func(kyma *inventoryv1alpha1.Kyma, module inventoryv1alpha1.ComponentSpec) (*inventoryv1alpha1.HelmComponent, error) {
+	constructComponentForKyma := func(kyma *inventoryv1alpha1.Kyma, module inventoryv1alpha1.ComponentSpec, entry *inventoryv1alpha1.CatalogComponent) (*inventoryv1alpha1.HelmComponent, error) {
 		name := fmt.Sprintf("%s-%s", kyma.Name, module.Name)
+		namespace := module.Namespace
+		if namespace == "" {
+			namespace = catalog.Spec.NamespaceOf(entry)
+		}
 
 		component := &inventoryv1alpha1.HelmComponent{
 			ObjectMeta: metav1.ObjectMeta{
 				Name:      name,
 				Namespace: kyma.Namespace,
+				Labels:    componentLabels(kyma, nil),
+			},
+			Spec: inventoryv1alpha1.HelmComponentSpec{
+				ComponentName: module.Name,
+				ChartLocation: entry.Chart,
+				Version:       versions[module.Name],
+				Namespace:     namespace,
+				ClusterRef:    kyma.Spec.ClusterRef,
 			},
-			Spec: inventoryv1alpha1.HelmComponentSpec{ComponentName: module.Name},
 		}
 
 		if err := ctrl.SetControllerReference(kyma, component, r.Scheme); err != nil {
@@ -109,10 +185,28 @@ func (r *KymaReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.
 	kyma.Status.WaitingFor = []string{}
 	for _, m := range kyma.Spec.Components {
 		found := false
-		for _, c := range components.Items {
+		for i := range components.Items {
+			c := &components.Items[i]
 			if c.Spec.ComponentName == m.Name {
 				found = true
-				if c.Status.Status != "success" {
+				if labels := componentLabels(&kyma, c.Labels); !equality.Semantic.DeepEqual(labels, c.Labels) {
+					patch := mergeFrom(c)
+					c.Labels = labels
+					if err := writer.Patch(ctx, c, patch); err != nil {
+						log.Error(err, "unable to update component labels", "component", c.Name)
+						return ctrl.Result{}, err
+					}
+				}
+				if c.Spec.Version != versions[m.Name] {
+					log.Info("Update module version", "name", m.Name, "from", c.Spec.Version, "to", versions[m.Name])
+					patch := mergeFrom(c)
+					c.Spec.Version = versions[m.Name]
+					if err := writer.Patch(ctx, c, patch); err != nil {
+						log.Error(err, "unable to update component version", "component", c.Name)
+						return ctrl.Result{}, err
+					}
+				}
+				if !componentInstalled(c) {
 					kyma.Status.WaitingFor = append(kyma.Status.WaitingFor, m.Name)
 				}
 				break
@@ -120,33 +214,43 @@ func (r *KymaReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.
 		}
 		if !found {
 			kyma.Status.WaitingFor = append(kyma.Status.WaitingFor, m.Name)
+			entry := catalog.Spec.Component(m.Name)
+			if entry == nil {
+				log.Info("Component not found in catalog", "name", m.Name, "catalog", catalog.Name)
+				continue
+			}
+			if dependency := pendingDependency(entry, kyma.Spec.Components, components.Items); dependency != "" {
+				log.V(2).Info("Waiting for dependency", "name", m.Name, "dependency", dependency)
+				continue
+			}
 			log.Info("Create module", "name", m.Name)
-			component, err := constructComponentForKyma(&kyma, m)
+			component, err := constructComponentForKyma(&kyma, m, entry)
 			if err != nil {
 				log.Error(err, "unable to construct component")
 				// don't bother requeuing until we get a change to the spec
 				return ctrl.Result{}, nil
 			}
 
-			if err := r.Create(ctx, component); err != nil {
+			if err := writer.Create(ctx, component); err != nil {
 				log.Error(err, "unable to create Helm component", "component", component)
 				return ctrl.Result{RequeueAfter: 5 * time.Second}, IgnoreAlreadyExists(err)
 			}
 		}
 	}
 
-	oldStatus := kyma.Status.Status
 	// Update status
-	if len(kyma.Status.WaitingFor) == 0 {
+	if len(kyma.Status.WaitingFor) == 0 && (clusterStatus == nil || clusterStatus.Ready()) {
 		kyma.Status.Status = "success"
 	} else {
 		kyma.Status.Status = "reconciling"
 	}
 
-	// Do not update status if it was success before
-	if oldStatus != kyma.Status.Status || kyma.Status.Status == "reconciling" {
-		if err := r.Status().Update(ctx, &kyma); err != nil {
-			return ctrl.Result{}, IgnoreStatusUpdateConflict(err)
+	// Write the status only if it changed. The patch doesn't conflict with the writes of other replicas or
+	// of the previous reconciliation still missing in the cache: the controller owns the whole status
+	if !equality.Semantic.DeepEqual(original.Status, kyma.Status) {
+		if err := writer.Status().Patch(ctx, &kyma, client.MergeFrom(original)); err != nil {
+			log.Error(err, "unable to patch Kyma status")
+			return ctrl.Result{}, client.IgnoreNotFound(err)
 		}
 	}
 	log.V(2).Info("Status update", "count", len(components.Items), "waiting for", len(kyma.Status.WaitingFor))
@@ -162,16 +266,130 @@ func (r *KymaReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.
 		}
 		if !found {
 			log.Info("Delete module", "name", c.Name)
-			if err := r.Delete(ctx, &c); err != nil {
+			if err := writer.Delete(ctx, &c); err != nil {
 				log.Error(err, "unable to delete component", "component", c.Name)
 				return ctrl.Result{}, err
 			}
 		}
 	}
 
+	if kyma.Status.Status == "success" {
+		return r.Resync.result(r.queue, configv1alpha1.KymaController, req), nil
+	}
 	return ctrl.Result{}, nil
 }
 
+// clusterStatus returns the readiness of the Cluster referenced by the Kyma and its Networks, or nil without clusterRef
+func (r *KymaReconciler) clusterStatus(ctx context.Context, kyma *inventoryv1alpha1.Kyma) (*inventoryv1alpha1.KymaClusterStatus, error) {
+	ref := kyma.Spec.ClusterRef
+	if ref == nil {
+		return nil, nil
+	}
+	status := &inventoryv1alpha1.KymaClusterStatus{}
+	var cluster inventoryv1alpha1.Cluster
+	if err := r.Get(ctx, client.ObjectKey{Namespace: kyma.Namespace, Name: ref.Name}, &cluster); err != nil {
+		if apierrors.IsNotFound(err) {
+			status.Message = fmt.Sprintf("Cluster %s not found", ref.Name)
+			return status, nil
+		}
+		return nil, err
+	}
+	status.Reachable = cluster.Status.Reachable
+
+	var networks inventoryv1alpha1.NetworkList
+	if err := r.List(ctx, &networks, client.InNamespace(kyma.Namespace), client.MatchingFields{clusterRefKey: ref.Name}); err != nil {
+		return nil, err
+	}
+	var invalid []string
+	for _, n := range networks.Items {
+		if !n.Status.Valid {
+			invalid = append(invalid, n.Name)
+		}
+	}
+	status.NetworkValid = len(invalid) == 0
+
+	switch {
+	case !status.Reachable:
+		status.Message = fmt.Sprintf("Cluster %s is not reachable", ref.Name)
+	case !status.NetworkValid:
+		status.Message = fmt.Sprintf("Networks %s of cluster %s are not valid", strings.Join(invalid, ","), ref.Name)
+	}
+	return status, nil
+}
+
+func (r *KymaReconciler) catalogName() string {
+	if r.CatalogName != "" {
+		return r.CatalogName
+	}
+	return inventoryv1alpha1.DefaultComponentCatalogName
+}
+
+// componentLabels returns the labels of a component with the name and the shard of the Kyma
+func componentLabels(kyma *inventoryv1alpha1.Kyma, labels map[string]string) map[string]string {
+	result := map[string]string{}
+	for k, v := range labels {
+		result[k] = v
+	}
+	result[inventoryv1alpha1.KymaLabel] = kyma.Name
+	if shard := kyma.Labels[inventoryv1alpha1.ShardLabel]; shard != "" {
+		result[inventoryv1alpha1.ShardLabel] = shard
+	}
+	return result
+}
+
+// pendingDependency returns the first dependency of the catalog entry which is part of the Kyma and not installed yet.
+func pendingDependency(entry *inventoryv1alpha1.CatalogComponent, modules []inventoryv1alpha1.ComponentSpec, components []inventoryv1alpha1.HelmComponent) string {
+	for _, dependency := range entry.Dependencies {
+		required := false
+		for _, m := range modules {
+			if m.Name == dependency {
+				required = true
+				break
+			}
+		}
+		if !required {
+			continue
+		}
+		installed := false
+		for _, c := range components {
+			if c.Spec.ComponentName == dependency && c.Status.Status == "success" {
+				installed = true
+				break
+			}
+		}
+		if !installed {
+			return dependency
+		}
+	}
+	return ""
+}
+
+// componentEventWindow is the window the events of the components of a Kyma are coalesced in
+const componentEventWindow = time.Second
+
+// componentStateChanged passes updates of HelmComponents which change the state read by the Kyma reconciliation:
+// the spec, the labels, the deletion, and whether the component is installed in the version of its spec.
+// The intermediate statuses of an installation don't change the Kyma status
+var componentStateChanged = predicate.Funcs{
+	UpdateFunc: func(e event.UpdateEvent) bool {
+		old, ok := e.ObjectOld.(*inventoryv1alpha1.HelmComponent)
+		if !ok {
+			return true
+		}
+		component := e.ObjectNew.(*inventoryv1alpha1.HelmComponent)
+		return old.Generation != component.Generation ||
+			!equality.Semantic.DeepEqual(old.Labels, component.Labels) ||
+			!component.DeletionTimestamp.Equal(old.DeletionTimestamp) ||
+			componentInstalled(old) != componentInstalled(component) ||
+			(old.Status.Status == "success") != (component.Status.Status == "success")
+	},
+}
+
+// componentInstalled returns true if the component is installed in the version of its spec
+func componentInstalled(c *inventoryv1alpha1.HelmComponent) bool {
+	return c.Status.Status == "success" && c.Status.Version == c.Spec.Version
+}
+
 var (
 	componentOwnerKey = ".metadata.controller"
 	apiGVStr          = inventoryv1alpha1.GroupVersion.String()
@@ -181,28 +399,34 @@ var (
 func (r *KymaReconciler) SetupWithManager(mgr ctrl.Manager) error {
 	// set up a real clock, since we're not in a test
 
-	if err := mgr.GetFieldIndexer().IndexField(context.Background(), &inventoryv1alpha1.HelmComponent{}, componentOwnerKey, func(rawObj client.Object) []string {
-		// grab the job object, extract the owner...
-		helmComponent := rawObj.(*inventoryv1alpha1.HelmComponent)
-		owner := metav1.GetControllerOf(helmComponent)
-		if owner == nil {
-			return nil
-		}
-		// ...make sure it's a CronJob...
-		if owner.APIVersion != apiGVStr || owner.Kind != "Kyma" {
-			return nil
-		}
-
-		// ...and if so, return it
-		return []string{owner.Name}
-	}); err != nil {
-		return err
-	}
 
-	return ctrl.NewControllerManagedBy(mgr).
-		For(&inventoryv1alpha1.Kyma{}).
-		Owns(&inventoryv1alpha1.HelmComponent{}).
-		//		WithEventFilter(predicate.GenerationChangedPredicate{}).
-		WithOptions(controller.Options{MaxConcurrentReconciles: 10, RateLimiter: CustomRateLimiter()}).
-		Complete(r)
+	options := defaultOptions(r.Options, configv1alpha1.KymaController)
+	r.queue = newPriorityQueue(configv1alpha1.KymaController, options.MaxConcurrentReconciles)
+	ramp := newStartupRamp(configv1alpha1.KymaController, r.StartupWindow)
+	enqueueOwner := &handler.EnqueueRequestForOwner{OwnerType: &inventoryv1alpha1.Kyma{}, IsController: true}
+	return newPrioritizedController(mgr, configv1alpha1.KymaController, &inventoryv1alpha1.Kyma{}, r, options, r.queue,
+		// spec changes and deletions of the Kymas outrank the changes of the components and the resync
+		watch{&source.Kind{Type: &inventoryv1alpha1.Kyma{}}, r.queue.ForObject(&handler.EnqueueRequestForObject{}),
+			[]predicate.Predicate{ramp.Others()}},
+		// the status changes of the components of a Kyma are coalesced, they usually come in bursts
+		watch{&source.Kind{Type: &inventoryv1alpha1.HelmComponent{}}, r.queue.Coalesce(enqueueOwner, priorityNormal, componentEventWindow),
+			[]predicate.Predicate{ramp.Others(), componentStateChanged}},
+		// the existing Kymas and components are queued over the startup window
+		watch{&source.Kind{Type: &inventoryv1alpha1.Kyma{}}, r.queue.Handler(ramp.Handler(&handler.EnqueueRequestForObject{}), priorityLow),
+			[]predicate.Predicate{ramp.Existing()}},
+		watch{&source.Kind{Type: &inventoryv1alpha1.HelmComponent{}}, r.queue.Handler(ramp.Handler(enqueueOwner), priorityLow),
+			[]predicate.Predicate{ramp.Existing()}},
+		// changes of the reachability of a Cluster or the conflicts of its Networks change the status of its Kymas
+		watch{&source.Kind{Type: &inventoryv1alpha1.Cluster{}},
+			r.queue.Handler(handler.EnqueueRequestsFromMapFunc(referencing(mgr.GetClient(), &inventoryv1alpha1.KymaList{}, clusterRefKey)), priorityNormal),
+			[]predicate.Predicate{clusterReadinessChanged}},
+		watch{&source.Kind{Type: &inventoryv1alpha1.Network{}},
+			r.queue.Handler(handler.EnqueueRequestsFromMapFunc(func(o client.Object) []reconcile.Request {
+				ref := o.(*inventoryv1alpha1.Network).Spec.ClusterRef
+				if ref == nil {
+					return nil
+				}
+				return referencingName(mgr.GetClient(), &inventoryv1alpha1.KymaList{}, clusterRefKey, o.GetNamespace(), ref.Name)
+			}), priorityNormal),
+			[]predicate.Predicate{networkValidityChanged}})
 }
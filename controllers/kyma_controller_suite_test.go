@@ -0,0 +1,122 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"sort"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	inventoryv1alpha1 "github.com/kyma-incubator/kymactl/api/v1alpha1"
+)
+
+var _ = Describe("Kyma controller", func() {
+	const (
+		timeout  = 30 * time.Second
+		interval = 100 * time.Millisecond
+	)
+
+	newKyma := func(name string, components ...string) *inventoryv1alpha1.Kyma {
+		kyma := &inventoryv1alpha1.Kyma{ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "default"}}
+		for _, c := range components {
+			kyma.Spec.Components = append(kyma.Spec.Components, inventoryv1alpha1.ComponentSpec{Name: c})
+		}
+		return kyma
+	}
+
+	// componentNames returns the sorted names of the HelmComponents of the Kyma
+	componentNames := func(kyma *inventoryv1alpha1.Kyma) func() ([]string, error) {
+		return func() ([]string, error) {
+			var components inventoryv1alpha1.HelmComponentList
+			if err := k8sClient.List(ctx, &components, client.InNamespace(kyma.Namespace),
+				client.MatchingLabels{inventoryv1alpha1.KymaLabel: kyma.Name}); err != nil {
+				return nil, err
+			}
+			names := []string{}
+			for _, c := range components.Items {
+				names = append(names, c.Name)
+			}
+			sort.Strings(names)
+			return names, nil
+		}
+	}
+
+	It("creates the HelmComponents of the components", func() {
+		kyma := newKyma("create", "istio", "ory")
+		Expect(k8sClient.Create(ctx, kyma)).To(Succeed())
+
+		Eventually(componentNames(kyma), timeout, interval).Should(Equal([]string{"create-istio", "create-ory"}))
+
+		var component inventoryv1alpha1.HelmComponent
+		Expect(k8sClient.Get(ctx, types.NamespacedName{Namespace: "default", Name: "create-istio"}, &component)).To(Succeed())
+		Expect(component.Spec.ComponentName).To(Equal("istio"))
+		Expect(component.Spec.Namespace).To(Equal("istio-system"))
+		Expect(metav1.IsControlledBy(&component, kyma)).To(BeTrue())
+	})
+
+	It("reaches success when all components are installed", func() {
+		kyma := newKyma("success", "cluster-essentials", "istio", "ory")
+		Expect(k8sClient.Create(ctx, kyma)).To(Succeed())
+
+		key := client.ObjectKeyFromObject(kyma)
+		Eventually(func() (string, error) {
+			err := k8sClient.Get(ctx, key, kyma)
+			return kyma.Status.Status, err
+		}, timeout, interval).Should(Equal("success"))
+		Expect(kyma.Status.WaitingFor).To(BeEmpty())
+		Expect(kyma.Status.Versions).To(HaveLen(3))
+
+		var components inventoryv1alpha1.HelmComponentList
+		Expect(k8sClient.List(ctx, &components, client.InNamespace(kyma.Namespace),
+			client.MatchingLabels{inventoryv1alpha1.KymaLabel: kyma.Name})).To(Succeed())
+		Expect(components.Items).To(HaveLen(3))
+		for _, c := range components.Items {
+			Expect(c.Status.Status).To(Equal("success"), c.Name)
+		}
+	})
+
+	It("deletes the HelmComponent of a removed component", func() {
+		kyma := newKyma("remove", "istio", "ory")
+		Expect(k8sClient.Create(ctx, kyma)).To(Succeed())
+		Eventually(componentNames(kyma), timeout, interval).Should(Equal([]string{"remove-istio", "remove-ory"}))
+
+		patch := client.MergeFrom(kyma.DeepCopy())
+		kyma.Spec.Components = kyma.Spec.Components[:1]
+		Expect(k8sClient.Patch(ctx, kyma, patch)).To(Succeed())
+
+		Eventually(componentNames(kyma), timeout, interval).Should(Equal([]string{"remove-istio"}))
+	})
+
+	It("deletes the HelmComponents of a deleted Kyma", func() {
+		kyma := newKyma("delete", "istio", "ory")
+		Expect(k8sClient.Create(ctx, kyma)).To(Succeed())
+		Eventually(componentNames(kyma), timeout, interval).Should(HaveLen(2))
+
+		// envtest runs no garbage collector, the controller deletes the components
+		Expect(k8sClient.Delete(ctx, kyma)).To(Succeed())
+
+		Eventually(componentNames(kyma), timeout, interval).Should(BeEmpty())
+		err := k8sClient.Get(ctx, client.ObjectKeyFromObject(kyma), kyma)
+		Expect(apierrors.IsNotFound(err)).To(BeTrue())
+	})
+})
@@ -0,0 +1,183 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+
+	inventoryv1alpha1 "github.com/kyma-incubator/kymactl/api/v1alpha1"
+)
+
+// newKymaTestReconciler returns a reconciler with the default ComponentCatalog next to the objects
+func newKymaTestReconciler(t *testing.T, objs ...client.Object) *KymaReconciler {
+	c := newTestClient(t, append(objs, &inventoryv1alpha1.ComponentCatalog{ObjectMeta: metav1.ObjectMeta{Name: inventoryv1alpha1.DefaultComponentCatalogName}})...)
+	return &KymaReconciler{Client: c, Scheme: c.Scheme()}
+}
+
+func TestKymaReportsClusterReadiness(t *testing.T) {
+	cluster := &inventoryv1alpha1.Cluster{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "cluster"}}
+	network := testNetwork("network", "", "10.250.0.0/16", "100.64.0.0/12", "100.104.0.0/13")
+	network.Spec.ClusterRef = &inventoryv1alpha1.ClusterReference{Name: "cluster"}
+	r := newKymaTestReconciler(t, cluster, network, &inventoryv1alpha1.Kyma{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "kyma"},
+		Spec:       inventoryv1alpha1.KymaSpec{ClusterRef: &inventoryv1alpha1.ClusterReference{Name: "cluster"}},
+	})
+	setStatus := func(obj client.Object, update func()) {
+		if err := r.Get(context.Background(), client.ObjectKeyFromObject(obj), obj); err != nil {
+			t.Fatal(err)
+		}
+		update()
+		if err := r.Status().Update(context.Background(), obj); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	kyma := reconcileAndGet(t, r, testKey("kyma"), &inventoryv1alpha1.Kyma{})
+	if kyma.Status.Status == "success" || kyma.Status.Cluster == nil || kyma.Status.Cluster.Message != "Cluster cluster is not reachable" {
+		t.Errorf("expected Kyma waiting for the cluster, got %+v", kyma.Status)
+	}
+
+	setStatus(cluster, func() { cluster.Status.Reachable = true })
+	kyma = reconcileAndGet(t, r, testKey("kyma"), &inventoryv1alpha1.Kyma{})
+	if kyma.Status.Status == "success" || !kyma.Status.Cluster.Reachable || kyma.Status.Cluster.NetworkValid {
+		t.Errorf("expected Kyma waiting for the network, got %+v", kyma.Status.Cluster)
+	}
+
+	setStatus(network, func() { network.Status.Valid = true })
+	kyma = reconcileAndGet(t, r, testKey("kyma"), &inventoryv1alpha1.Kyma{})
+	if kyma.Status.Status != "success" || !kyma.Status.Cluster.Ready() || kyma.Status.Cluster.Message != "" {
+		t.Errorf("expected ready Kyma, got %s %+v", kyma.Status.Status, kyma.Status.Cluster)
+	}
+
+	// conflicts of the network make the Kyma not ready again
+	setStatus(network, func() { network.Status.Valid = false })
+	kyma = reconcileAndGet(t, r, testKey("kyma"), &inventoryv1alpha1.Kyma{})
+	if kyma.Status.Status == "success" || kyma.Status.Cluster.Message != "Networks network of cluster cluster are not valid" {
+		t.Errorf("expected Kyma with invalid network, got %+v", kyma.Status.Cluster)
+	}
+}
+
+func TestKymaSkipsUnchangedStatus(t *testing.T) {
+	r := newKymaTestReconciler(t, &inventoryv1alpha1.Kyma{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "kyma"},
+		Spec:       inventoryv1alpha1.KymaSpec{ClusterRef: &inventoryv1alpha1.ClusterReference{Name: "missing"}},
+	})
+	kyma := reconcileAndGet(t, r, testKey("kyma"), &inventoryv1alpha1.Kyma{})
+	if kyma.Status.Status != "reconciling" {
+		t.Fatalf("expected reconciling Kyma, got %+v", kyma.Status)
+	}
+	// reconciling without changes doesn't write the status
+	if again := reconcileAndGet(t, r, testKey("kyma"), &inventoryv1alpha1.Kyma{}); again.ResourceVersion != kyma.ResourceVersion {
+		t.Errorf("expected unchanged resource version %s, got %s", kyma.ResourceVersion, again.ResourceVersion)
+	}
+}
+
+func TestComponentStateChanged(t *testing.T) {
+	component := &inventoryv1alpha1.HelmComponent{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "kyma-istio", Generation: 1},
+		Spec:       inventoryv1alpha1.HelmComponentSpec{ComponentName: "istio", Version: "1.0.0"},
+		Status:     inventoryv1alpha1.HelmComponentStatus{Status: "started"},
+	}
+	with := func(update func(c *inventoryv1alpha1.HelmComponent)) *inventoryv1alpha1.HelmComponent {
+		c := component.DeepCopy()
+		update(c)
+		return c
+	}
+	for _, tc := range []struct {
+		name     string
+		new      *inventoryv1alpha1.HelmComponent
+		expected bool
+	}{
+		{"intermediate status", with(func(c *inventoryv1alpha1.HelmComponent) { c.Status.Status = "failing" }), false},
+		{"installed", with(func(c *inventoryv1alpha1.HelmComponent) { c.Status.Status, c.Status.Version = "success", "1.0.0" }), true},
+		{"installed in another version", with(func(c *inventoryv1alpha1.HelmComponent) { c.Status.Status, c.Status.Version = "success", "0.9.0" }), true},
+		{"spec", with(func(c *inventoryv1alpha1.HelmComponent) { c.Spec.Version, c.Generation = "1.1.0", 2 }), true},
+		{"labels", with(func(c *inventoryv1alpha1.HelmComponent) { c.Labels = map[string]string{"shard": "1"} }), true},
+		{"deletion", with(func(c *inventoryv1alpha1.HelmComponent) { c.DeletionTimestamp = &metav1.Time{Time: time.Now()} }), true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			if changed := componentStateChanged.Update(event.UpdateEvent{ObjectOld: component, ObjectNew: tc.new}); changed != tc.expected {
+				t.Errorf("expected %v, got %v", tc.expected, changed)
+			}
+		})
+	}
+}
+
+func TestKymaResolvesChannelVersions(t *testing.T) {
+	c := newTestClient(t,
+		&inventoryv1alpha1.ComponentCatalog{
+			ObjectMeta: metav1.ObjectMeta{Name: inventoryv1alpha1.DefaultComponentCatalogName},
+			Spec: inventoryv1alpha1.ComponentCatalogSpec{
+				DefaultChannel: "stable",
+				Components: []inventoryv1alpha1.CatalogComponent{
+					{Name: "istio", Versions: []string{"2.0.0", "1.0.0"}, Channels: map[string]string{"stable": "1.0.0"}},
+					{Name: "eventing", Versions: []string{"3.0.0"}},
+				},
+			},
+		},
+		&inventoryv1alpha1.Kyma{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "kyma"},
+			Spec: inventoryv1alpha1.KymaSpec{Components: []inventoryv1alpha1.ComponentSpec{
+				{Name: "istio"},
+				{Name: "eventing"},
+			}},
+		})
+	r := &KymaReconciler{Client: c, Scheme: c.Scheme()}
+	expectVersions := func(channel string, expected map[string]string) {
+		t.Helper()
+		kyma := reconcileAndGet(t, r, testKey("kyma"), &inventoryv1alpha1.Kyma{})
+		if kyma.Status.Channel != channel {
+			t.Errorf("expected channel %q, got %q", channel, kyma.Status.Channel)
+		}
+		if len(kyma.Status.Versions) != len(expected) {
+			t.Errorf("expected the versions of %d components, got %+v", len(expected), kyma.Status.Versions)
+		}
+		for _, v := range kyma.Status.Versions {
+			if v.Version != expected[v.Name] {
+				t.Errorf("expected %s version %q in the status, got %q", v.Name, expected[v.Name], v.Version)
+			}
+		}
+		for name, version := range expected {
+			var component inventoryv1alpha1.HelmComponent
+			if err := r.Get(context.Background(), testKey("kyma-"+name), &component); err != nil {
+				t.Fatal(err)
+			}
+			if component.Spec.Version != version {
+				t.Errorf("expected %s version %q, got %q", name, version, component.Spec.Version)
+			}
+		}
+	}
+
+	// the default channel selects its version, components without version for the channel get the newest one
+	expectVersions("stable", map[string]string{"istio": "1.0.0", "eventing": "3.0.0"})
+
+	var kyma inventoryv1alpha1.Kyma
+	if err := r.Get(context.Background(), testKey("kyma"), &kyma); err != nil {
+		t.Fatal(err)
+	}
+	kyma.Spec.Channel = "fast"
+	if err := r.Update(context.Background(), &kyma); err != nil {
+		t.Fatal(err)
+	}
+	expectVersions("fast", map[string]string{"istio": "2.0.0", "eventing": "3.0.0"})
+}
@@ -0,0 +1,108 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/util/yaml"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// fieldManager is the owner of the fields applied to the remote clusters
+const fieldManager = "kymactl"
+
+// applyOrder installs the kinds other resources depend on first
+var applyOrder = map[string]int{
+	"CustomResourceDefinition": 0,
+	"Namespace":                1,
+	"ServiceAccount":           2,
+	"ClusterRole":              3,
+	"Role":                     3,
+	"ClusterRoleBinding":       4,
+	"RoleBinding":              4,
+}
+
+// parseManifest splits the rendered multi-document manifest into objects
+func parseManifest(manifest string) ([]*unstructured.Unstructured, error) {
+	var objs []*unstructured.Unstructured
+	decoder := yaml.NewYAMLOrJSONDecoder(strings.NewReader(manifest), 4096)
+	for {
+		obj := &unstructured.Unstructured{}
+		if err := decoder.Decode(&obj.Object); err != nil {
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			return nil, err
+		}
+		if len(obj.Object) == 0 {
+			continue
+		}
+		objs = append(objs, obj)
+	}
+	sort.SliceStable(objs, func(i, j int) bool {
+		return kindOrder(objs[i].GetKind()) < kindOrder(objs[j].GetKind())
+	})
+	return objs, nil
+}
+
+func kindOrder(kind string) int {
+	if order, ok := applyOrder[kind]; ok {
+		return order
+	}
+	return len(applyOrder)
+}
+
+// applyManifest creates the namespace and applies all objects of the manifest using server-side apply.
+// Namespaced objects without namespace are applied to the namespace.
+func applyManifest(ctx context.Context, c client.Client, namespace, manifest string) error {
+	objs, err := parseManifest(manifest)
+	if err != nil {
+		return fmt.Errorf("invalid manifest: %w", err)
+	}
+	ns := &corev1.Namespace{
+		TypeMeta:   metav1.TypeMeta{APIVersion: "v1", Kind: "Namespace"},
+		ObjectMeta: metav1.ObjectMeta{Name: namespace},
+	}
+	if err := c.Patch(ctx, ns, client.Apply, client.FieldOwner(fieldManager), client.ForceOwnership); err != nil {
+		return err
+	}
+	for _, obj := range objs {
+		if obj.GetNamespace() == "" {
+			mapping, err := c.RESTMapper().RESTMapping(obj.GroupVersionKind().GroupKind(), obj.GroupVersionKind().Version)
+			if err != nil {
+				return fmt.Errorf("unable to map %s %s: %w", obj.GetKind(), obj.GetName(), err)
+			}
+			if mapping.Scope.Name() == meta.RESTScopeNameNamespace {
+				obj.SetNamespace(namespace)
+			}
+		}
+		if err := c.Patch(ctx, obj, client.Apply, client.FieldOwner(fieldManager), client.ForceOwnership); err != nil {
+			return fmt.Errorf("unable to apply %s %s: %w", obj.GetKind(), obj.GetName(), err)
+		}
+	}
+	return nil
+}
@@ -18,45 +18,333 @@ package controllers
 
 import (
 	"context"
+	"fmt"
+	"net"
+	"sort"
+	"time"
 
+	"k8s.io/apimachinery/pkg/api/equality"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/util/retry"
 	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
 	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	"sigs.k8s.io/controller-runtime/pkg/source"
 
+	configv1alpha1 "github.com/kyma-incubator/kymactl/api/config/v1alpha1"
 	inventoryv1alpha1 "github.com/kyma-incubator/kymactl/api/v1alpha1"
+	"github.com/kyma-incubator/kymactl/pkg/ipam"
 )
 
+// networkAllocationRequeue is the time to retry failed allocations
+const networkAllocationRequeue = 30 * time.Second
+
 // NetworkReconciler reconciles a Network object
 type NetworkReconciler struct {
 	client.Client
 	Scheme *runtime.Scheme
+	// Concurrency and rate limiter of the controller. If not provided: the default configuration
+	Options controller.Options
 }
 
 //+kubebuilder:rbac:groups=inventory.kyma-project.io,resources=networks,verbs=get;list;watch;create;update;patch;delete
 //+kubebuilder:rbac:groups=inventory.kyma-project.io,resources=networks/status,verbs=get;update;patch
 //+kubebuilder:rbac:groups=inventory.kyma-project.io,resources=networks/finalizers,verbs=update
+//+kubebuilder:rbac:groups=inventory.kyma-project.io,resources=networkpools,verbs=get;list;watch
+//+kubebuilder:rbac:groups=inventory.kyma-project.io,resources=networkpools/status,verbs=get;update;patch
 
-// Reconcile is part of the main kubernetes reconciliation loop which aims to
-// move the current state of the cluster closer to the desired state.
-// TODO(user): Modify the Reconcile function to compare the state specified by
-// the Network object against the actual cluster state, and then
-// perform operations to make the cluster state reflect the state specified by
-// the user.
-//
-// For more details, check Reconcile and its Result here:
-// - https://pkg.go.dev/sigs.k8s.io/controller-runtime@v0.11.0/pkg/reconcile
+// Reconcile allocates the requested CIDRs from the pools, validates the CIDRs of the network and reports
+// overlaps with each other and with the CIDRs of the networks in the same peering group.
+// The allocated CIDRs are released when the network is deleted.
 func (r *NetworkReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
-	_ = log.FromContext(ctx)
+	log := log.FromContext(ctx)
+
+	var network inventoryv1alpha1.Network
+	if err := r.Get(ctx, req.NamespacedName, &network); err != nil {
+		return ctrl.Result{}, client.IgnoreNotFound(err)
+	}
+
+	if !network.DeletionTimestamp.IsZero() {
+		if controllerutil.ContainsFinalizer(&network, inventoryv1alpha1.NetworkPoolFinalizer) {
+			if err := r.release(ctx, &network); err != nil {
+				log.Error(err, "unable to release CIDRs")
+				return ctrl.Result{}, err
+			}
+			log.Info("CIDRs released")
+			controllerutil.RemoveFinalizer(&network, inventoryv1alpha1.NetworkPoolFinalizer)
+			if err := r.Update(ctx, &network); err != nil {
+				return ctrl.Result{}, err
+			}
+		}
+		return ctrl.Result{}, nil
+	}
+
+	allocationErrs, err := r.allocate(ctx, &network)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
 
-	// TODO(user): your logic here
+	cidrs, errs := networkCIDRs(&network)
+	status := inventoryv1alpha1.NetworkStatus{Errors: append(allocationErrs, errs...)}
+	status.Conflicts = overlaps(network.Name, cidrs, network.Name, cidrs)
 
+	if network.Spec.PeeringGroup != "" {
+		peers, err := r.peers(ctx, &network)
+		if err != nil {
+			log.Error(err, "unable to list Networks")
+			return ctrl.Result{}, err
+		}
+		for i := range peers {
+			peer := &peers[i]
+			if peer.Name == network.Name {
+				continue
+			}
+			peerCIDRs, _ := networkCIDRs(peer)
+			status.Conflicts = append(status.Conflicts, overlaps(network.Name, cidrs, peer.Name, peerCIDRs)...)
+		}
+	}
+	status.Valid = len(status.Errors) == 0 && len(status.Conflicts) == 0
+
+	if !equality.Semantic.DeepEqual(network.Status, status) {
+		if !status.Valid {
+			log.Info("Invalid network", "errors", status.Errors, "conflicts", len(status.Conflicts))
+		}
+		network.Status = status
+		if err := r.Status().Update(ctx, &network); err != nil {
+			return ctrl.Result{}, IgnoreStatusUpdateConflict(err)
+		}
+	}
+	if len(allocationErrs) > 0 {
+		// the pool can be created or extended later
+		return ctrl.Result{RequeueAfter: networkAllocationRequeue}, nil
+	}
 	return ctrl.Result{}, nil
 }
 
+// allocationRequests returns the fields of the network which are empty and requested from a pool
+func allocationRequests(network *inventoryv1alpha1.Network) map[string]*inventoryv1alpha1.CIDRAllocation {
+	requests := map[string]*inventoryv1alpha1.CIDRAllocation{}
+	for field, f := range networkFields(network) {
+		if *f.value == "" && f.allocation != nil {
+			requests[field] = f.allocation
+		}
+	}
+	return requests
+}
+
+// allocate sets the empty CIDRs of the network to blocks allocated from the pools.
+// Failed allocations are returned as errors for the status.
+func (r *NetworkReconciler) allocate(ctx context.Context, network *inventoryv1alpha1.Network) ([]string, error) {
+	log := log.FromContext(ctx)
+	requests := allocationRequests(network)
+	if len(requests) == 0 {
+		return nil, nil
+	}
+	// the finalizer is set before the allocation, so the blocks are released even if the network is deleted meanwhile
+	if !controllerutil.ContainsFinalizer(network, inventoryv1alpha1.NetworkPoolFinalizer) {
+		controllerutil.AddFinalizer(network, inventoryv1alpha1.NetworkPoolFinalizer)
+		if err := r.Update(ctx, network); err != nil {
+			return nil, err
+		}
+	}
+
+	var errs []string
+	fields := networkFields(network)
+	for _, field := range []string{"nodes", "pods", "services"} {
+		request, ok := requests[field]
+		if !ok {
+			continue
+		}
+		cidr, err := r.allocateFromPool(ctx, network, field, request)
+		if err != nil {
+			log.Info("CIDR allocation failed", "field", field, "pool", request.Pool, "reason", err.Error())
+			errs = append(errs, fmt.Sprintf("%s: allocation from pool %s failed: %v", field, request.Pool, err))
+			continue
+		}
+		log.Info("CIDR allocated", "field", field, "pool", request.Pool, "cidr", cidr)
+		*fields[field].value = cidr
+	}
+	if len(errs) < len(requests) {
+		if err := r.Update(ctx, network); err != nil {
+			return nil, err
+		}
+	}
+	return errs, nil
+}
+
+// allocateFromPool returns the block allocated to the field of the network. New blocks are added to the
+// allocations in the pool status, the update fails if the pool was changed concurrently and is retried.
+func (r *NetworkReconciler) allocateFromPool(ctx context.Context, network *inventoryv1alpha1.Network, field string, request *inventoryv1alpha1.CIDRAllocation) (string, error) {
+	var cidr string
+	err := retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		var pool inventoryv1alpha1.NetworkPool
+		if err := r.Get(ctx, types.NamespacedName{Namespace: network.Namespace, Name: request.Pool}, &pool); err != nil {
+			return err
+		}
+		if allocation := pool.Status.Allocation(network.Name, field); allocation != nil {
+			cidr = allocation.CIDR
+			return nil
+		}
+		supernet, err := ipam.ParseCIDR(pool.Spec.Supernet)
+		if err != nil {
+			return fmt.Errorf("invalid supernet: %w", err)
+		}
+		var used []*net.IPNet
+		for _, a := range pool.Status.Allocations {
+			if block, err := ipam.ParseCIDR(a.CIDR); err == nil {
+				used = append(used, block)
+			}
+		}
+		block, err := ipam.NextFree(supernet, request.PrefixLength, used)
+		if err != nil {
+			return err
+		}
+		pool.Status.Allocations = append(pool.Status.Allocations, inventoryv1alpha1.NetworkPoolAllocation{Network: network.Name, Field: field, CIDR: block.String()})
+		pool.Status.Allocated = len(pool.Status.Allocations)
+		if err := r.Status().Update(ctx, &pool); err != nil {
+			return err
+		}
+		cidr = block.String()
+		return nil
+	})
+	return cidr, err
+}
+
+// release removes the allocations of the network from all pools in the namespace
+func (r *NetworkReconciler) release(ctx context.Context, network *inventoryv1alpha1.Network) error {
+	var pools inventoryv1alpha1.NetworkPoolList
+	if err := r.List(ctx, &pools, client.InNamespace(network.Namespace)); err != nil {
+		return err
+	}
+	for _, p := range pools.Items {
+		key := types.NamespacedName{Namespace: p.Namespace, Name: p.Name}
+		err := retry.RetryOnConflict(retry.DefaultRetry, func() error {
+			var pool inventoryv1alpha1.NetworkPool
+			if err := r.Get(ctx, key, &pool); err != nil {
+				return client.IgnoreNotFound(err)
+			}
+			var allocations []inventoryv1alpha1.NetworkPoolAllocation
+			for _, a := range pool.Status.Allocations {
+				if a.Network != network.Name {
+					allocations = append(allocations, a)
+				}
+			}
+			if len(allocations) == len(pool.Status.Allocations) {
+				return nil
+			}
+			pool.Status.Allocations = allocations
+			pool.Status.Allocated = len(allocations)
+			return r.Status().Update(ctx, &pool)
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// peers returns the networks of the peering group sorted by name
+func (r *NetworkReconciler) peers(ctx context.Context, network *inventoryv1alpha1.Network) ([]inventoryv1alpha1.Network, error) {
+	var networks inventoryv1alpha1.NetworkList
+	if err := r.List(ctx, &networks, client.InNamespace(network.Namespace)); err != nil {
+		return nil, err
+	}
+	var peers []inventoryv1alpha1.Network
+	for _, n := range networks.Items {
+		if n.Spec.PeeringGroup == network.Spec.PeeringGroup {
+			peers = append(peers, n)
+		}
+	}
+	sort.Slice(peers, func(i, j int) bool { return peers[i].Name < peers[j].Name })
+	return peers, nil
+}
+
+type networkField struct {
+	value      *string
+	allocation *inventoryv1alpha1.CIDRAllocation
+}
+
+func networkFields(network *inventoryv1alpha1.Network) map[string]networkField {
+	return map[string]networkField{
+		"nodes":    {value: &network.Spec.Nodes, allocation: network.Spec.NodesAllocation},
+		"pods":     {value: &network.Spec.Pods, allocation: network.Spec.PodsAllocation},
+		"services": {value: &network.Spec.Services, allocation: network.Spec.ServicesAllocation},
+	}
+}
+
+type networkCIDR struct {
+	field string
+	cidr  *net.IPNet
+}
+
+// networkCIDRs returns the valid CIDRs of the network and the errors of the invalid ones
+func networkCIDRs(network *inventoryv1alpha1.Network) ([]networkCIDR, []string) {
+	var cidrs []networkCIDR
+	var errs []string
+	for _, f := range []struct{ field, value string }{
+		{"nodes", network.Spec.Nodes},
+		{"pods", network.Spec.Pods},
+		{"services", network.Spec.Services},
+	} {
+		if f.value == "" {
+			continue
+		}
+		cidr, err := ipam.ParseCIDR(f.value)
+		if err != nil {
+			errs = append(errs, fmt.Sprintf("%s: %v", f.field, err))
+			continue
+		}
+		cidrs = append(cidrs, networkCIDR{field: f.field, cidr: cidr})
+	}
+	return cidrs, errs
+}
+
+// overlaps returns the conflicts of the CIDRs of a network with the CIDRs of the other network.
+// The CIDRs of the same network are compared with each other once.
+func overlaps(name string, cidrs []networkCIDR, otherName string, otherCIDRs []networkCIDR) []inventoryv1alpha1.NetworkConflict {
+	var conflicts []inventoryv1alpha1.NetworkConflict
+	for i, a := range cidrs {
+		for j, b := range otherCIDRs {
+			if name == otherName && j <= i {
+				continue
+			}
+			if ipam.Overlap(a.cidr, b.cidr) {
+				conflicts = append(conflicts, inventoryv1alpha1.NetworkConflict{Field: a.field, Network: otherName, NetworkField: b.field})
+			}
+		}
+	}
+	return conflicts
+}
+
 // SetupWithManager sets up the controller with the Manager.
 func (r *NetworkReconciler) SetupWithManager(mgr ctrl.Manager) error {
 	return ctrl.NewControllerManagedBy(mgr).
-		For(&inventoryv1alpha1.Network{}).
+		For(&inventoryv1alpha1.Network{}, builder.WithPredicates(predicate.GenerationChangedPredicate{})).
+		// changes of a network can solve or cause conflicts of its peers
+		Watches(&source.Kind{Type: &inventoryv1alpha1.Network{}}, handler.EnqueueRequestsFromMapFunc(func(o client.Object) []reconcile.Request {
+			network := o.(*inventoryv1alpha1.Network)
+			if network.Spec.PeeringGroup == "" {
+				return nil
+			}
+			peers, err := r.peers(context.Background(), network)
+			if err != nil {
+				return nil
+			}
+			var requests []reconcile.Request
+			for _, peer := range peers {
+				if peer.Name != network.Name {
+					requests = append(requests, reconcile.Request{NamespacedName: types.NamespacedName{Namespace: peer.Namespace, Name: peer.Name}})
+				}
+			}
+			return requests
+		}), builder.WithPredicates(predicate.GenerationChangedPredicate{})).
+		WithOptions(defaultOptions(r.Options, configv1alpha1.NetworkController)).
 		Complete(r)
 }
@@ -0,0 +1,169 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+
+	inventoryv1alpha1 "github.com/kyma-incubator/kymactl/api/v1alpha1"
+)
+
+func testNetwork(name, group, nodes, pods, services string) *inventoryv1alpha1.Network {
+	return &inventoryv1alpha1.Network{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: name},
+		Spec:       inventoryv1alpha1.NetworkSpec{PeeringGroup: group, Nodes: nodes, Pods: pods, Services: services},
+	}
+}
+
+func TestNetworkValidatesCIDRs(t *testing.T) {
+	r := &NetworkReconciler{Client: newTestClient(t,
+		testNetwork("valid", "", "10.250.0.0/16", "100.64.0.0/12", "100.104.0.0/13"),
+		testNetwork("invalid", "", "10.250.0.1/16", "100.64.0.0", "100.104.0.0/13"),
+		testNetwork("overlapping", "", "10.0.0.0/8", "10.96.0.0/12", "100.104.0.0/13"))}
+
+	if status := reconcileAndGet(t, r, testKey("valid"), &inventoryv1alpha1.Network{}).Status; !status.Valid {
+		t.Errorf("expected valid network, got %+v", status)
+	}
+	if status := reconcileAndGet(t, r, testKey("invalid"), &inventoryv1alpha1.Network{}).Status; status.Valid || len(status.Errors) != 2 || !strings.HasPrefix(status.Errors[0], "nodes:") {
+		t.Errorf("expected invalid nodes and pods, got %+v", status)
+	}
+	status := reconcileAndGet(t, r, testKey("overlapping"), &inventoryv1alpha1.Network{}).Status
+	expected := inventoryv1alpha1.NetworkConflict{Field: "nodes", Network: "overlapping", NetworkField: "pods"}
+	if status.Valid || len(status.Conflicts) != 1 || status.Conflicts[0] != expected {
+		t.Errorf("expected nodes overlapping pods, got %+v", status)
+	}
+}
+
+func TestNetworkDetectsOverlapsWithPeers(t *testing.T) {
+	r := &NetworkReconciler{Client: newTestClient(t,
+		testNetwork("a", "europe", "10.250.0.0/16", "100.64.0.0/12", "100.104.0.0/13"),
+		testNetwork("b", "europe", "10.251.0.0/16", "100.64.0.0/12", "100.112.0.0/13"),
+		testNetwork("c", "us", "10.250.0.0/16", "100.64.0.0/12", "100.104.0.0/13"))}
+
+	status := reconcileAndGet(t, r, testKey("a"), &inventoryv1alpha1.Network{}).Status
+	expected := inventoryv1alpha1.NetworkConflict{Field: "pods", Network: "b", NetworkField: "pods"}
+	if status.Valid || len(status.Conflicts) != 1 || status.Conflicts[0] != expected {
+		t.Errorf("expected pods overlapping peer b, got %+v", status)
+	}
+	// same CIDRs in another peering group are fine
+	if status := reconcileAndGet(t, r, testKey("c"), &inventoryv1alpha1.Network{}).Status; !status.Valid {
+		t.Errorf("expected valid network, got %+v", status)
+	}
+}
+
+func testNetworkPool(name, supernet string) *inventoryv1alpha1.NetworkPool {
+	return &inventoryv1alpha1.NetworkPool{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: name},
+		Spec:       inventoryv1alpha1.NetworkPoolSpec{Supernet: supernet},
+	}
+}
+
+func allocatedNetwork(name, pool string, prefixLength int) *inventoryv1alpha1.Network {
+	network := testNetwork(name, "", "", "100.64.0.0/12", "100.104.0.0/13")
+	network.Spec.NodesAllocation = &inventoryv1alpha1.CIDRAllocation{Pool: pool, PrefixLength: prefixLength}
+	return network
+}
+
+func getNetworkPool(t *testing.T, r *NetworkReconciler, name string) *inventoryv1alpha1.NetworkPool {
+	var pool inventoryv1alpha1.NetworkPool
+	if err := r.Get(context.Background(), types.NamespacedName{Namespace: "default", Name: name}, &pool); err != nil {
+		t.Fatal(err)
+	}
+	return &pool
+}
+
+func getNetwork(t *testing.T, r *NetworkReconciler, name string) *inventoryv1alpha1.Network {
+	var network inventoryv1alpha1.Network
+	if err := r.Get(context.Background(), types.NamespacedName{Namespace: "default", Name: name}, &network); err != nil {
+		t.Fatal(err)
+	}
+	return &network
+}
+
+func TestNetworkAllocatesCIDRsFromPool(t *testing.T) {
+	r := &NetworkReconciler{Client: newTestClient(t,
+		testNetworkPool("nodes", "10.250.0.0/16"),
+		allocatedNetwork("first", "nodes", 17),
+		allocatedNetwork("second", "nodes", 17),
+		allocatedNetwork("third", "nodes", 17))}
+
+	for _, tc := range []struct{ name, expected string }{{"first", "10.250.0.0/17"}, {"second", "10.250.128.0/17"}} {
+		name, expected := tc.name, tc.expected
+		if status := reconcileAndGet(t, r, testKey(name), &inventoryv1alpha1.Network{}).Status; !status.Valid {
+			t.Errorf("expected valid network %s, got %+v", name, status)
+		}
+		network := getNetwork(t, r, name)
+		if network.Spec.Nodes != expected || !controllerutil.ContainsFinalizer(network, inventoryv1alpha1.NetworkPoolFinalizer) {
+			t.Errorf("expected %s with nodes %s and finalizer, got %s %v", name, expected, network.Spec.Nodes, network.Finalizers)
+		}
+	}
+
+	// the pool is exhausted
+	if status := reconcileAndGet(t, r, testKey("third"), &inventoryv1alpha1.Network{}).Status; status.Valid || len(status.Errors) != 1 || !strings.HasPrefix(status.Errors[0], "nodes:") {
+		t.Errorf("expected failed allocation, got %+v", status)
+	}
+	if pool := getNetworkPool(t, r, "nodes"); pool.Status.Allocated != 2 {
+		t.Errorf("expected 2 allocations, got %+v", pool.Status)
+	}
+
+	// deleting a network releases its block, which is allocated to the next network
+	first := getNetwork(t, r, "first")
+	if err := r.Delete(context.Background(), first); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := r.Reconcile(context.Background(), ctrl.Request{NamespacedName: client.ObjectKeyFromObject(first)}); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Get(context.Background(), client.ObjectKeyFromObject(first), first); !apierrors.IsNotFound(err) {
+		t.Errorf("expected deleted network, got %v", err)
+	}
+	if pool := getNetworkPool(t, r, "nodes"); pool.Status.Allocation("first", "nodes") != nil || pool.Status.Allocated != 1 {
+		t.Errorf("expected released block, got %+v", pool.Status)
+	}
+	if status := reconcileAndGet(t, r, testKey("third"), &inventoryv1alpha1.Network{}).Status; !status.Valid {
+		t.Errorf("expected valid network, got %+v", status)
+	}
+	if third := getNetwork(t, r, "third"); third.Spec.Nodes != "10.250.0.0/17" {
+		t.Errorf("expected released block to be reused, got %s", third.Spec.Nodes)
+	}
+}
+
+func TestNetworkReusesAllocatedCIDR(t *testing.T) {
+	pool := testNetworkPool("nodes", "10.250.0.0/16")
+	pool.Status.Allocations = []inventoryv1alpha1.NetworkPoolAllocation{{Network: "network", Field: "nodes", CIDR: "10.250.64.0/18"}}
+	pool.Status.Allocated = 1
+	r := &NetworkReconciler{Client: newTestClient(t, pool, allocatedNetwork("network", "nodes", 18))}
+
+	if status := reconcileAndGet(t, r, testKey("network"), &inventoryv1alpha1.Network{}).Status; !status.Valid {
+		t.Errorf("expected valid network, got %+v", status)
+	}
+	if network := getNetwork(t, r, "network"); network.Spec.Nodes != "10.250.64.0/18" {
+		t.Errorf("expected allocated block to be reused, got %s", network.Spec.Nodes)
+	}
+	if pool := getNetworkPool(t, r, "nodes"); pool.Status.Allocated != 1 {
+		t.Errorf("expected a single allocation, got %+v", pool.Status)
+	}
+}
@@ -0,0 +1,210 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"sigs.k8s.io/yaml"
+
+	inventoryv1alpha1 "github.com/kyma-incubator/kymactl/api/v1alpha1"
+)
+
+const (
+	defaultOidcSigningAlg    = "RS256"
+	defaultOidcDiscoveryTTL  = time.Hour
+	oidcDiscoveryTimeout     = 10 * time.Second
+	oidcDiscoveryWellKnown   = "/.well-known/openid-configuration"
+	oidcDiscoveryMaxBodySize = 1 << 20
+)
+
+// oidcSigningAlgs are the signing algorithms supported by the API server
+var oidcSigningAlgs = map[string]bool{
+	"RS256": true, "RS384": true, "RS512": true,
+	"ES256": true, "ES384": true, "ES512": true,
+	"PS256": true, "PS384": true, "PS512": true,
+}
+
+// oidcComponents render the OIDC settings of the cluster into the values of the charts which template them.
+// The API gateway validates the JWTs with the keys of the issuer
+var oidcComponents = map[string]func(status *inventoryv1alpha1.OidcStatus) map[string]interface{}{
+	"api-gateway": func(status *inventoryv1alpha1.OidcStatus) map[string]interface{} {
+		return map[string]interface{}{"config": map[string]interface{}{"jwksURI": status.JwksURI}}
+	},
+}
+
+// oidcValues returns the values YAML with the OIDC settings for the component.
+// It is empty if the component doesn't need the settings or OIDC is disabled.
+func oidcValues(component string, cluster *inventoryv1alpha1.Cluster) (string, error) {
+	values, ok := oidcComponents[component]
+	if !ok || cluster.Spec.Oidc.IssuerURL == "" || cluster.Status.Oidc == nil {
+		return "", nil
+	}
+	out, err := yaml.Marshal(values(cluster.Status.Oidc))
+	if err != nil {
+		return "", err
+	}
+	return string(out), nil
+}
+
+// needsOidc returns true if the component can't be installed before the OIDC settings of the cluster are verified
+func needsOidc(component string, cluster *inventoryv1alpha1.Cluster) bool {
+	_, ok := oidcComponents[component]
+	return ok && cluster.Spec.Oidc.IssuerURL != "" && (cluster.Status.Oidc == nil || !cluster.Status.Oidc.Verified)
+}
+
+func signingAlgs(oidc *inventoryv1alpha1.OidcSpec) []string {
+	var algs []string
+	for _, alg := range strings.Split(oidc.SigningAlgs, ",") {
+		if alg = strings.TrimSpace(alg); alg != "" {
+			algs = append(algs, alg)
+		}
+	}
+	if len(algs) == 0 {
+		return []string{defaultOidcSigningAlg}
+	}
+	return algs
+}
+
+// validateOidc checks that the issuer uses HTTPS and the signing algorithms are supported by the API server
+func validateOidc(oidc *inventoryv1alpha1.OidcSpec) error {
+	issuer, err := url.Parse(oidc.IssuerURL)
+	if err != nil {
+		return fmt.Errorf("invalid issuer URL: %w", err)
+	}
+	if issuer.Scheme != "https" || issuer.Host == "" {
+		return fmt.Errorf("issuer URL %s must use https", oidc.IssuerURL)
+	}
+	if issuer.RawQuery != "" || issuer.Fragment != "" {
+		return fmt.Errorf("issuer URL %s must not contain query or fragment", oidc.IssuerURL)
+	}
+	if oidc.ClientID == "" {
+		return fmt.Errorf("client ID is required")
+	}
+	for _, alg := range signingAlgs(oidc) {
+		if !oidcSigningAlgs[alg] {
+			return fmt.Errorf("unknown signing algorithm %s", alg)
+		}
+	}
+	return nil
+}
+
+// OidcDiscovery is the part of the OpenID Provider metadata used by the controller
+type OidcDiscovery struct {
+	Issuer      string   `json:"issuer"`
+	JwksURI     string   `json:"jwks_uri"`
+	SigningAlgs []string `json:"id_token_signing_alg_values_supported"`
+}
+
+type oidcDiscoveryEntry struct {
+	discovery *OidcDiscovery
+	fetched   time.Time
+}
+
+// OidcDiscoveries fetches and caches the discovery documents of the OIDC issuers
+type OidcDiscoveries struct {
+	// HTTP client used to fetch the documents. If not provided: client with 10s timeout
+	Client *http.Client
+	// Time the documents are cached. If not provided: 1h
+	TTL time.Duration
+
+	mu      sync.Mutex
+	entries map[string]oidcDiscoveryEntry
+}
+
+// Get returns the discovery document of the issuer. Failed requests are not cached.
+func (d *OidcDiscoveries) Get(ctx context.Context, issuer string) (*OidcDiscovery, error) {
+	ttl := d.TTL
+	if ttl == 0 {
+		ttl = defaultOidcDiscoveryTTL
+	}
+	d.mu.Lock()
+	entry, ok := d.entries[issuer]
+	d.mu.Unlock()
+	if ok && time.Since(entry.fetched) < ttl {
+		return entry.discovery, nil
+	}
+
+	discovery, err := d.fetch(ctx, issuer)
+	if err != nil {
+		return nil, err
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.entries == nil {
+		d.entries = map[string]oidcDiscoveryEntry{}
+	}
+	d.entries[issuer] = oidcDiscoveryEntry{discovery: discovery, fetched: time.Now()}
+	return discovery, nil
+}
+
+func (d *OidcDiscoveries) fetch(ctx context.Context, issuer string) (*OidcDiscovery, error) {
+	client := d.Client
+	if client == nil {
+		client = &http.Client{Timeout: oidcDiscoveryTimeout}
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, strings.TrimSuffix(issuer, "/")+oidcDiscoveryWellKnown, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("unable to fetch discovery document: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unable to fetch discovery document: %s", resp.Status)
+	}
+	var discovery OidcDiscovery
+	if err := json.NewDecoder(http.MaxBytesReader(nil, resp.Body, oidcDiscoveryMaxBodySize)).Decode(&discovery); err != nil {
+		return nil, fmt.Errorf("invalid discovery document: %w", err)
+	}
+	if discovery.Issuer != issuer {
+		return nil, fmt.Errorf("discovery document is for issuer %s", discovery.Issuer)
+	}
+	return &discovery, nil
+}
+
+// verifyOidc validates the OIDC settings and checks them against the discovery document of the issuer
+func (d *OidcDiscoveries) verifyOidc(ctx context.Context, oidc *inventoryv1alpha1.OidcSpec) *inventoryv1alpha1.OidcStatus {
+	if err := validateOidc(oidc); err != nil {
+		return &inventoryv1alpha1.OidcStatus{Message: err.Error()}
+	}
+	discovery, err := d.Get(ctx, oidc.IssuerURL)
+	if err != nil {
+		return &inventoryv1alpha1.OidcStatus{Message: err.Error()}
+	}
+	if len(discovery.SigningAlgs) > 0 {
+		supported := map[string]bool{}
+		for _, alg := range discovery.SigningAlgs {
+			supported[alg] = true
+		}
+		for _, alg := range signingAlgs(oidc) {
+			if !supported[alg] {
+				return &inventoryv1alpha1.OidcStatus{JwksURI: discovery.JwksURI, Message: fmt.Sprintf("signing algorithm %s is not supported by the issuer", alg)}
+			}
+		}
+	}
+	return &inventoryv1alpha1.OidcStatus{Verified: true, JwksURI: discovery.JwksURI}
+}
@@ -0,0 +1,160 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+
+	inventoryv1alpha1 "github.com/kyma-incubator/kymactl/api/v1alpha1"
+	"github.com/kyma-incubator/kymactl/manifests"
+	"github.com/kyma-incubator/kymactl/pkg/helm"
+)
+
+// startIssuer starts an OIDC issuer serving the discovery document and counts the requests
+func startIssuer(t *testing.T, algs ...string) (*httptest.Server, *int32) {
+	var requests int32
+	var issuer *httptest.Server
+	issuer = httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.URL.Path != oidcDiscoveryWellKnown {
+			http.NotFound(w, req)
+			return
+		}
+		atomic.AddInt32(&requests, 1)
+		_ = json.NewEncoder(w).Encode(OidcDiscovery{Issuer: issuer.URL, JwksURI: issuer.URL + "/keys", SigningAlgs: algs})
+	}))
+	t.Cleanup(issuer.Close)
+	return issuer, &requests
+}
+
+func TestValidateOidc(t *testing.T) {
+	for _, tc := range []struct {
+		oidc inventoryv1alpha1.OidcSpec
+		err  string
+	}{
+		{oidc: inventoryv1alpha1.OidcSpec{IssuerURL: "https://issuer.example.com", ClientID: "kyma"}},
+		{oidc: inventoryv1alpha1.OidcSpec{IssuerURL: "https://issuer.example.com/tenant", ClientID: "kyma", SigningAlgs: "RS256, ES256"}},
+		{oidc: inventoryv1alpha1.OidcSpec{IssuerURL: "http://issuer.example.com", ClientID: "kyma"}, err: "must use https"},
+		{oidc: inventoryv1alpha1.OidcSpec{IssuerURL: "https://issuer.example.com?tenant=kyma", ClientID: "kyma"}, err: "must not contain query"},
+		{oidc: inventoryv1alpha1.OidcSpec{IssuerURL: "https://issuer.example.com"}, err: "client ID is required"},
+		{oidc: inventoryv1alpha1.OidcSpec{IssuerURL: "https://issuer.example.com", ClientID: "kyma", SigningAlgs: "HS256"}, err: "unknown signing algorithm HS256"},
+	} {
+		err := validateOidc(&tc.oidc)
+		switch {
+		case tc.err == "" && err != nil:
+			t.Errorf("%+v: unexpected error %v", tc.oidc, err)
+		case tc.err != "" && (err == nil || !strings.Contains(err.Error(), tc.err)):
+			t.Errorf("%+v: expected error %q, got %v", tc.oidc, tc.err, err)
+		}
+	}
+}
+
+func TestOidcDiscoveriesAreCached(t *testing.T) {
+	issuer, requests := startIssuer(t, "RS256")
+	discoveries := &OidcDiscoveries{Client: issuer.Client()}
+
+	for i := 0; i < 3; i++ {
+		discovery, err := discoveries.Get(context.Background(), issuer.URL)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if discovery.JwksURI != issuer.URL+"/keys" {
+			t.Errorf("unexpected JWKS URI %s", discovery.JwksURI)
+		}
+	}
+	if *requests != 1 {
+		t.Errorf("expected 1 request, got %d", *requests)
+	}
+
+	if _, err := discoveries.Get(context.Background(), issuer.URL+"/unknown"); err == nil {
+		t.Error("expected error for unknown issuer")
+	}
+}
+
+func TestClusterVerifiesOidcAndRendersValues(t *testing.T) {
+	issuer, _ := startIssuer(t, "RS256")
+
+	key := types.NamespacedName{Namespace: "default", Name: "oidc"}
+	r := &ClusterReconciler{RemoteClusters: &RemoteClusters{}, Client: newTestClient(t, &inventoryv1alpha1.Cluster{
+		ObjectMeta: metav1.ObjectMeta{Namespace: key.Namespace, Name: key.Name},
+		Spec: inventoryv1alpha1.ClusterSpec{Oidc: inventoryv1alpha1.OidcSpec{
+			IssuerURL:   issuer.URL,
+			ClientID:    "kyma",
+			GroupsClaim: "groups",
+		}},
+	})}
+	r.OidcDiscoveries = &OidcDiscoveries{Client: issuer.Client()}
+
+	cluster := reconcileAndGet(t, r, key, &inventoryv1alpha1.Cluster{})
+	if cluster.Status.Oidc == nil || !cluster.Status.Oidc.Verified || cluster.Status.Oidc.JwksURI != issuer.URL+"/keys" {
+		t.Fatalf("expected verified OIDC settings, got %+v", cluster.Status.Oidc)
+	}
+	if needsOidc("api-gateway", cluster) {
+		t.Error("expected api-gateway not to wait for OIDC settings")
+	}
+
+	values, err := oidcValues("api-gateway", cluster)
+	if err != nil {
+		t.Fatal(err)
+	}
+	charts, err := helm.NewCatalog(manifests.FS, manifests.ChartsDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	chart, err := charts.Get("api-gateway", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	renderer, err := chart.Renderer("kyma-system")
+	if err != nil {
+		t.Fatal(err)
+	}
+	manifest, err := renderer.RenderManifest(values)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := "--jwks-uri=" + issuer.URL + "/keys"; !strings.Contains(manifest, expected) {
+		t.Errorf("expected %q in the api-gateway manifest", expected)
+	}
+	if values, _ := oidcValues("eventing", cluster); values != "" {
+		t.Errorf("expected no values for eventing, got %s", values)
+	}
+
+	// signing algorithms not supported by the issuer
+	cluster.Spec.Oidc.SigningAlgs = "ES256"
+	if err := r.Update(context.Background(), cluster); err != nil {
+		t.Fatal(err)
+	}
+	cluster = reconcileAndGet(t, r, key, &inventoryv1alpha1.Cluster{})
+	if cluster.Status.Oidc.Verified || !strings.Contains(cluster.Status.Oidc.Message, "ES256") {
+		t.Fatalf("expected unverified OIDC settings, got %+v", cluster.Status.Oidc)
+	}
+	if !needsOidc("api-gateway", cluster) {
+		t.Error("expected api-gateway to wait for OIDC settings")
+	}
+	if needsOidc("cluster-users", cluster) {
+		t.Error("expected cluster-users not to wait for OIDC settings it doesn't use")
+	}
+}
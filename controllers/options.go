@@ -0,0 +1,60 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"golang.org/x/time/rate"
+
+	"k8s.io/client-go/util/workqueue"
+	"sigs.k8s.io/controller-runtime/pkg/controller"
+	"sigs.k8s.io/controller-runtime/pkg/ratelimiter"
+
+	configv1alpha1 "github.com/kyma-incubator/kymactl/api/config/v1alpha1"
+)
+
+// CustomRateLimiter is the default rate limiter of the kyma and helmcomponent controllers
+func CustomRateLimiter() ratelimiter.RateLimiter {
+	return RateLimiter(configv1alpha1.DefaultRateLimiter)
+}
+
+// RateLimiter returns the rate limiter of a reconciliation queue: the maximum of the exponential backoff of the failures
+// of every object and the token bucket for all objects
+func RateLimiter(c configv1alpha1.RateLimiterConfig) ratelimiter.RateLimiter {
+	return workqueue.NewMaxOfRateLimiter(
+		workqueue.NewItemExponentialFailureRateLimiter(c.BaseDelay.Duration, c.MaxDelay.Duration),
+		&workqueue.BucketRateLimiter{Limiter: rate.NewLimiter(rate.Limit(c.QPS), c.Burst)})
+}
+
+// ControllerOptions returns the options of a controller from its configuration.
+// Without rate limiter configuration the controller uses the controller-runtime rate limiter
+func ControllerOptions(c configv1alpha1.ControllerConfig) controller.Options {
+	options := controller.Options{MaxConcurrentReconciles: c.MaxConcurrentReconciles}
+	if c.RateLimiter != nil {
+		options.RateLimiter = RateLimiter(*c.RateLimiter)
+	}
+	return options
+}
+
+// defaultOptions returns the options of the controller in the default configuration if no options are provided
+func defaultOptions(options controller.Options, name string) controller.Options {
+	if options.MaxConcurrentReconciles != 0 || options.RateLimiter != nil {
+		return options
+	}
+	var config configv1alpha1.ProjectConfig
+	config.Default()
+	return ControllerOptions(config.Controllers[name])
+}
@@ -0,0 +1,379 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/prometheus/client_golang/prometheus"
+	"k8s.io/client-go/util/workqueue"
+	"k8s.io/klog/v2"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/apiutil"
+	"sigs.k8s.io/controller-runtime/pkg/controller"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	"sigs.k8s.io/controller-runtime/pkg/runtime/inject"
+	"sigs.k8s.io/controller-runtime/pkg/source"
+)
+
+// priority of the events queued in a priorityQueue
+type priority int
+
+const (
+	// priorityLow for the resync and the startup ramp
+	priorityLow priority = iota
+	// priorityNormal for the status and metadata changes and the events of the watched kinds
+	priorityNormal
+	// priorityHigh for the creations, spec changes and deletions
+	priorityHigh
+
+	priorities = 3
+)
+
+func (p priority) String() string {
+	return [priorities]string{"low", "normal", "high"}[p]
+}
+
+// priorityQueuePollInterval is the interval the controller queue is checked for free capacity
+const priorityQueuePollInterval = 10 * time.Millisecond
+
+var (
+	priorityQueueDepth = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "kymactl_priority_queue_depth",
+		Help: "Number of objects waiting in the priority queue of a controller",
+	}, []string{"controller", "priority"})
+	priorityQueueAdds = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "kymactl_priority_queue_adds_total",
+		Help: "Number of objects added to the priority queue of a controller",
+	}, []string{"controller", "priority"})
+	priorityQueueCoalesced = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "kymactl_priority_queue_coalesced_total",
+		Help: "Number of objects not added to the priority queue of a controller, because they are added at the end of the coalescing window",
+	}, []string{"controller", "priority"})
+	priorityQueueWait = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "kymactl_priority_queue_wait_seconds",
+		Help:    "How long an object waits in the priority queue before it is passed to the controller queue",
+		Buckets: prometheus.ExponentialBuckets(0.001, 4, 10),
+	}, []string{"controller", "priority"})
+)
+
+func init() {
+	metrics.Registry.MustRegister(priorityQueueDepth, priorityQueueAdds, priorityQueueCoalesced, priorityQueueWait)
+}
+
+// priorityQueue orders the requests of a controller by priority before they enter the queue of the controller.
+// The controller queue is FIFO: a change of one Kyma would wait behind the resyncs of thousands of others.
+// The priority queue passes requests to the controller queue only while it holds less requests than the controller
+// has workers, so a new request waits at most for the requests already passed and the ones with higher priority.
+// Failed reconciliations are requeued by the controller queue with its rate limiter, as before.
+type priorityQueue struct {
+	controller string
+	limit      int
+
+	mu      sync.Mutex
+	queues  [priorities][]queuedRequest
+	waiting map[interface{}]priority
+	// items added at the end of the coalescing window
+	coalescing map[interface{}]bool
+	// pending delayed add per item, a new delay replaces it
+	delayed map[interface{}]*time.Timer
+	added   chan struct{}
+}
+
+type queuedRequest struct {
+	item  interface{}
+	added time.Time
+}
+
+func newPriorityQueue(controller string, workers int) *priorityQueue {
+	if workers < 1 {
+		workers = 1
+	}
+	return &priorityQueue{
+		controller: controller,
+		limit:      workers,
+		waiting:    make(map[interface{}]priority),
+		coalescing: make(map[interface{}]bool),
+		delayed:    make(map[interface{}]*time.Timer),
+		added:      make(chan struct{}, 1),
+	}
+}
+
+// add queues the item with the priority. An item already waiting is queued once, with the higher priority
+func (pq *priorityQueue) add(item interface{}, p priority) {
+	pq.mu.Lock()
+	defer pq.mu.Unlock()
+	priorityQueueAdds.WithLabelValues(pq.controller, p.String()).Inc()
+	if current, ok := pq.waiting[item]; ok {
+		if current >= p {
+			return
+		}
+		// the entry in the lower queue is skipped by next
+		priorityQueueDepth.WithLabelValues(pq.controller, current.String()).Dec()
+	}
+	pq.waiting[item] = p
+	pq.queues[p] = append(pq.queues[p], queuedRequest{item: item, added: time.Now()})
+	priorityQueueDepth.WithLabelValues(pq.controller, p.String()).Inc()
+	select {
+	case pq.added <- struct{}{}:
+	default:
+	}
+}
+
+// addAfter queues the item with the priority after the delay. The item has one pending delayed add, it replaces
+// the previous one, so every reconciliation of an object requeuing it doesn't start another chain of resyncs
+func (pq *priorityQueue) addAfter(item interface{}, delay time.Duration, p priority) {
+	if delay <= 0 {
+		pq.add(item, p)
+		return
+	}
+	pq.mu.Lock()
+	defer pq.mu.Unlock()
+	if pending, ok := pq.delayed[item]; ok {
+		pending.Stop()
+	}
+	var timer *time.Timer
+	timer = time.AfterFunc(delay, func() {
+		pq.mu.Lock()
+		if pq.delayed[item] != timer {
+			// replaced after the timer fired
+			pq.mu.Unlock()
+			return
+		}
+		delete(pq.delayed, item)
+		pq.mu.Unlock()
+		pq.add(item, p)
+	})
+	pq.delayed[item] = timer
+}
+
+// coalesce queues the item with the priority at the end of the window. The item is added once per window
+func (pq *priorityQueue) coalesce(item interface{}, window time.Duration, p priority) {
+	pq.mu.Lock()
+	defer pq.mu.Unlock()
+	if pq.coalescing[item] {
+		priorityQueueCoalesced.WithLabelValues(pq.controller, p.String()).Inc()
+		return
+	}
+	pq.coalescing[item] = true
+	time.AfterFunc(window, func() {
+		pq.mu.Lock()
+		delete(pq.coalescing, item)
+		pq.mu.Unlock()
+		pq.add(item, p)
+	})
+}
+
+// next removes the waiting item with the highest priority, the oldest one first
+func (pq *priorityQueue) next() (interface{}, bool) {
+	pq.mu.Lock()
+	defer pq.mu.Unlock()
+	for p := priorityHigh; p >= priorityLow; p-- {
+		for len(pq.queues[p]) > 0 {
+			queued := pq.queues[p][0]
+			pq.queues[p][0] = queuedRequest{}
+			pq.queues[p] = pq.queues[p][1:]
+			if current, ok := pq.waiting[queued.item]; !ok || current != p {
+				// moved to a higher priority or already passed
+				continue
+			}
+			delete(pq.waiting, queued.item)
+			priorityQueueDepth.WithLabelValues(pq.controller, p.String()).Dec()
+			priorityQueueWait.WithLabelValues(pq.controller, p.String()).Observe(time.Since(queued.added).Seconds())
+			return queued.item, true
+		}
+	}
+	return nil, false
+}
+
+// len returns the number of waiting items
+func (pq *priorityQueue) len() int {
+	pq.mu.Lock()
+	defer pq.mu.Unlock()
+	return len(pq.waiting)
+}
+
+// Start passes the requests to the queue of the controller until the context is done.
+// The priority queue is a source of the controller, which provides its queue.
+func (pq *priorityQueue) Start(ctx context.Context, _ handler.EventHandler, q workqueue.RateLimitingInterface, _ ...predicate.Predicate) error {
+	go pq.run(ctx, q)
+	return nil
+}
+
+func (pq *priorityQueue) run(ctx context.Context, q workqueue.RateLimitingInterface) {
+	// the controller queue doesn't notify when its workers take requests
+	ticker := time.NewTicker(priorityQueuePollInterval)
+	defer ticker.Stop()
+	for {
+		for q.Len() < pq.limit {
+			item, ok := pq.next()
+			if !ok {
+				break
+			}
+			q.Add(item)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-pq.added:
+		case <-ticker.C:
+		}
+	}
+}
+
+func (pq *priorityQueue) String() string {
+	return "priority queue of " + pq.controller
+}
+
+// Handler queues the requests of the inner handler with the priority
+func (pq *priorityQueue) Handler(inner handler.EventHandler, p priority) handler.EventHandler {
+	return priorityHandler{inner: inner, queue: pq, priority: func(interface{}) priority { return p }}
+}
+
+// Coalesce queues the requests of the inner handler with the priority at the end of the window, so the bursts of events
+// of an object, e.g. of the status changes of its components, cause one reconciliation
+func (pq *priorityQueue) Coalesce(inner handler.EventHandler, p priority, window time.Duration) handler.EventHandler {
+	return priorityHandler{inner: inner, queue: pq, priority: func(interface{}) priority { return p }, window: window}
+}
+
+// ForObject queues the requests of the inner handler of the reconciled kind with the high priority for creations,
+// spec changes and deletions, the low priority for the informer resyncs and the normal priority for the other changes
+func (pq *priorityQueue) ForObject(inner handler.EventHandler) handler.EventHandler {
+	return priorityHandler{inner: inner, queue: pq, priority: eventPriority}
+}
+
+func eventPriority(e interface{}) priority {
+	switch e := e.(type) {
+	case event.CreateEvent, event.DeleteEvent:
+		return priorityHigh
+	case event.UpdateEvent:
+		// the informer resyncs update the objects with themselves
+		if e.ObjectOld.GetResourceVersion() == e.ObjectNew.GetResourceVersion() {
+			return priorityLow
+		}
+		if e.ObjectOld.GetGeneration() != e.ObjectNew.GetGeneration() ||
+			e.ObjectOld.GetDeletionTimestamp() == nil && e.ObjectNew.GetDeletionTimestamp() != nil {
+			return priorityHigh
+		}
+	}
+	return priorityNormal
+}
+
+type priorityHandler struct {
+	inner    handler.EventHandler
+	queue    *priorityQueue
+	priority func(e interface{}) priority
+	window   time.Duration
+}
+
+func (h priorityHandler) Create(e event.CreateEvent, q workqueue.RateLimitingInterface) {
+	h.inner.Create(e, h.adder(q, e))
+}
+
+func (h priorityHandler) Update(e event.UpdateEvent, q workqueue.RateLimitingInterface) {
+	h.inner.Update(e, h.adder(q, e))
+}
+
+func (h priorityHandler) Delete(e event.DeleteEvent, q workqueue.RateLimitingInterface) {
+	h.inner.Delete(e, h.adder(q, e))
+}
+
+func (h priorityHandler) Generic(e event.GenericEvent, q workqueue.RateLimitingInterface) {
+	h.inner.Generic(e, h.adder(q, e))
+}
+
+// InjectFunc passes the scheme and the mapper needed by handler.EnqueueRequestForOwner to the inner handler
+func (h priorityHandler) InjectFunc(f inject.Func) error {
+	return f(h.inner)
+}
+
+func (h priorityHandler) adder(q workqueue.RateLimitingInterface, e interface{}) workqueue.RateLimitingInterface {
+	return priorityAdder{RateLimitingInterface: q, queue: h.queue, priority: h.priority(e), window: h.window}
+}
+
+// priorityAdder adds the items of a handler to the priority queue instead of the controller queue
+type priorityAdder struct {
+	workqueue.RateLimitingInterface
+	queue    *priorityQueue
+	priority priority
+	window   time.Duration
+}
+
+func (a priorityAdder) Add(item interface{}) {
+	if a.window > 0 {
+		a.queue.coalesce(item, a.window, a.priority)
+		return
+	}
+	a.queue.add(item, a.priority)
+}
+
+func (a priorityAdder) AddAfter(item interface{}, delay time.Duration) {
+	a.queue.addAfter(item, delay, a.priority)
+}
+
+// AddRateLimited adds the item without delay, the handlers don't rate limit
+func (a priorityAdder) AddRateLimited(item interface{}) {
+	a.queue.add(item, a.priority)
+}
+
+// watch of a prioritized controller
+type watch struct {
+	source     source.Source
+	handler    handler.EventHandler
+	predicates []predicate.Predicate
+}
+
+// newPrioritizedController sets up a controller of the kind with the watches, which are queued by the priority queue.
+// The builder can't be used, it queues the events of the reconciled and owned kinds directly.
+// The controller logs like one of the builder.
+func newPrioritizedController(mgr ctrl.Manager, name string, kind client.Object, r reconcile.Reconciler, options controller.Options,
+	pq *priorityQueue, watches ...watch) error {
+	gvk, err := apiutil.GVKForObject(kind, mgr.GetScheme())
+	if err != nil {
+		return err
+	}
+	options.Reconciler = r
+	if options.LogConstructor == nil {
+		log := mgr.GetLogger().WithValues("controller", name, "controllerGroup", gvk.Group, "controllerKind", gvk.Kind)
+		lowerCamelCaseKind := strings.ToLower(gvk.Kind[:1]) + gvk.Kind[1:]
+		options.LogConstructor = func(req *reconcile.Request) logr.Logger {
+			if req != nil {
+				return log.WithValues(lowerCamelCaseKind, klog.KRef(req.Namespace, req.Name), "namespace", req.Namespace, "name", req.Name)
+			}
+			return log
+		}
+	}
+	c, err := controller.New(name, mgr, options)
+	if err != nil {
+		return err
+	}
+	for _, w := range watches {
+		if err := c.Watch(w.source, w.handler, w.predicates...); err != nil {
+			return err
+		}
+	}
+	return c.Watch(pq, &handler.Funcs{})
+}
@@ -0,0 +1,237 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/util/workqueue"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+
+	inventoryv1alpha1 "github.com/kyma-incubator/kymactl/api/v1alpha1"
+)
+
+func request(name string) ctrl.Request {
+	return ctrl.Request{NamespacedName: types.NamespacedName{Namespace: "default", Name: name}}
+}
+
+func TestPriorityQueueOrder(t *testing.T) {
+	pq := newPriorityQueue("test-order", 1)
+	adds := testutil.ToFloat64(priorityQueueAdds.WithLabelValues("test-order", "high"))
+	pq.add(request("resync-1"), priorityLow)
+	pq.add(request("status"), priorityNormal)
+	pq.add(request("resync-2"), priorityLow)
+	pq.add(request("spec"), priorityHigh)
+	// a queued object is moved to the higher priority
+	pq.add(request("resync-1"), priorityHigh)
+	// and not moved back
+	pq.add(request("spec"), priorityLow)
+	if pq.len() != 4 {
+		t.Errorf("expected 4 waiting requests, got %d", pq.len())
+	}
+	if depth := testutil.ToFloat64(priorityQueueDepth.WithLabelValues("test-order", "low")); depth != 1 {
+		t.Errorf("expected 1 low priority request, got %v", depth)
+	}
+
+	var order []string
+	for item, ok := pq.next(); ok; item, ok = pq.next() {
+		order = append(order, item.(ctrl.Request).Name)
+	}
+	expected := []string{"spec", "resync-1", "status", "resync-2"}
+	if len(order) != len(expected) {
+		t.Fatalf("expected %v, got %v", expected, order)
+	}
+	for i := range expected {
+		if order[i] != expected[i] {
+			t.Fatalf("expected %v, got %v", expected, order)
+		}
+	}
+	for _, p := range []string{"low", "normal", "high"} {
+		if depth := testutil.ToFloat64(priorityQueueDepth.WithLabelValues("test-order", p)); depth != 0 {
+			t.Errorf("expected empty %s priority queue, got %v", p, depth)
+		}
+	}
+	if added := testutil.ToFloat64(priorityQueueAdds.WithLabelValues("test-order", "high")) - adds; added != 2 {
+		t.Errorf("expected 2 high priority adds, got %v", added)
+	}
+}
+
+func TestPriorityQueueRun(t *testing.T) {
+	pq := newPriorityQueue("test-run", 1)
+	q := workqueue.NewRateLimitingQueue(CustomRateLimiter())
+	defer q.ShutDown()
+	for _, name := range []string{"resync-1", "resync-2", "resync-3"} {
+		pq.add(request(name), priorityLow)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	if err := pq.Start(ctx, nil, q); err != nil {
+		t.Fatal(err)
+	}
+
+	// one worker: the priority queue passes one request at a time
+	deadline := time.Now().Add(time.Second)
+	for q.Len() == 0 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	if q.Len() != 1 || pq.len() != 2 {
+		t.Fatalf("expected one request in the controller queue, got %d", q.Len())
+	}
+	pq.add(request("spec"), priorityHigh)
+
+	var names []string
+	for len(names) < 4 {
+		item, _ := q.Get()
+		names = append(names, item.(ctrl.Request).Name)
+		q.Done(item)
+	}
+	// the spec change overtakes the resyncs still waiting
+	expected := []string{"resync-1", "spec", "resync-2", "resync-3"}
+	for i := range expected {
+		if names[i] != expected[i] {
+			t.Fatalf("expected %v, got %v", expected, names)
+		}
+	}
+}
+
+func TestPriorityQueueCoalesce(t *testing.T) {
+	pq := newPriorityQueue("test-coalesce", 1)
+	coalesced := testutil.ToFloat64(priorityQueueCoalesced.WithLabelValues("test-coalesce", "normal"))
+	h := pq.Coalesce(&handler.EnqueueRequestForObject{}, priorityNormal, 50*time.Millisecond)
+	kyma := &inventoryv1alpha1.Kyma{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "kyma"}}
+	for i := 0; i < 5; i++ {
+		h.Generic(event.GenericEvent{Object: kyma}, nil)
+	}
+	if pq.len() != 0 {
+		t.Errorf("expected no request before the end of the window, got %d", pq.len())
+	}
+	if c := testutil.ToFloat64(priorityQueueCoalesced.WithLabelValues("test-coalesce", "normal")) - coalesced; c != 4 {
+		t.Errorf("expected 4 coalesced events, got %v", c)
+	}
+	time.Sleep(100 * time.Millisecond)
+	if item, ok := pq.next(); !ok || item != request("kyma") || pq.len() != 0 {
+		t.Errorf("expected one request at the end of the window, got %v and %d more", item, pq.len())
+	}
+
+	// the next event starts a new window
+	h.Generic(event.GenericEvent{Object: kyma}, nil)
+	time.Sleep(100 * time.Millisecond)
+	if pq.len() != 1 {
+		t.Errorf("expected a request for the next window, got %d", pq.len())
+	}
+}
+
+func TestEventPriority(t *testing.T) {
+	kyma := &inventoryv1alpha1.Kyma{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "kyma", Generation: 1, ResourceVersion: "1"}}
+	specChanged := kyma.DeepCopy()
+	specChanged.Generation = 2
+	specChanged.ResourceVersion = "2"
+	deleting := kyma.DeepCopy()
+	deleting.DeletionTimestamp = &metav1.Time{Time: time.Now()}
+	deleting.ResourceVersion = "2"
+	statusChanged := kyma.DeepCopy()
+	statusChanged.Status.Status = "success"
+	statusChanged.ResourceVersion = "2"
+
+	for _, tc := range []struct {
+		name     string
+		event    interface{}
+		expected priority
+	}{
+		{"create", event.CreateEvent{Object: kyma}, priorityHigh},
+		{"spec change", event.UpdateEvent{ObjectOld: kyma, ObjectNew: specChanged}, priorityHigh},
+		{"deletion", event.UpdateEvent{ObjectOld: kyma, ObjectNew: deleting}, priorityHigh},
+		{"delete", event.DeleteEvent{Object: kyma}, priorityHigh},
+		{"status change", event.UpdateEvent{ObjectOld: kyma, ObjectNew: statusChanged}, priorityNormal},
+		{"resync", event.UpdateEvent{ObjectOld: kyma, ObjectNew: kyma.DeepCopy()}, priorityLow},
+		{"generic", event.GenericEvent{Object: kyma}, priorityNormal},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			if p := eventPriority(tc.event); p != tc.expected {
+				t.Errorf("expected %s priority, got %s", tc.expected, p)
+			}
+		})
+	}
+
+	// the handler adds to the priority queue instead of the controller queue
+	pq := newPriorityQueue("test-handler", 1)
+	q := workqueue.NewRateLimitingQueue(CustomRateLimiter())
+	defer q.ShutDown()
+	pq.ForObject(&handler.EnqueueRequestForObject{}).Update(event.UpdateEvent{ObjectOld: kyma, ObjectNew: statusChanged}, q)
+	pq.ForObject(&handler.EnqueueRequestForObject{}).Create(event.CreateEvent{Object: specChanged}, q)
+	if q.Len() != 0 || pq.len() != 1 {
+		t.Errorf("expected one request in the priority queue, got %d and %d in the controller queue", pq.len(), q.Len())
+	}
+	if p := pq.waiting[request("kyma")]; p != priorityHigh {
+		t.Errorf("expected high priority, got %s", p)
+	}
+}
+
+func TestKymaResyncPriority(t *testing.T) {
+	r := newKymaTestReconciler(t, &inventoryv1alpha1.Kyma{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "kyma"}})
+	r.Resync = Resync{Period: 10 * time.Millisecond}
+	r.queue = newPriorityQueue("test-resync", 1)
+	result, err := r.Reconcile(context.Background(), request("kyma"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.RequeueAfter != 0 || result.Requeue {
+		t.Errorf("expected the resync in the priority queue, got %+v", result)
+	}
+	deadline := time.Now().Add(time.Second)
+	for pq := r.queue; pq.len() == 0 && time.Now().Before(deadline); {
+		time.Sleep(time.Millisecond)
+	}
+	r.queue.mu.Lock()
+	p, ok := r.queue.waiting[request("kyma")]
+	r.queue.mu.Unlock()
+	if !ok || p != priorityLow {
+		t.Errorf("expected the resync with low priority, got %v %s", ok, p)
+	}
+}
+
+func TestKymaResyncKeepsOnePendingAdd(t *testing.T) {
+	r := newKymaTestReconciler(t, &inventoryv1alpha1.Kyma{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "kyma"}})
+	r.Resync = Resync{Period: 50 * time.Millisecond}
+	r.queue = newPriorityQueue("test-resync-pending", 1)
+	for i := 0; i < 5; i++ {
+		if _, err := r.Reconcile(context.Background(), request("kyma")); err != nil {
+			t.Fatal(err)
+		}
+	}
+	r.queue.mu.Lock()
+	pending := len(r.queue.delayed)
+	r.queue.mu.Unlock()
+	if pending != 1 {
+		t.Errorf("expected one pending resync, got %d", pending)
+	}
+
+	time.Sleep(200 * time.Millisecond)
+	if adds := testutil.ToFloat64(priorityQueueAdds.WithLabelValues("test-resync-pending", priorityLow.String())); adds != 1 {
+		t.Errorf("expected exactly one delayed add, got %v", adds)
+	}
+	if r.queue.len() != 1 {
+		t.Errorf("expected the Kyma queued once, got %d", r.queue.len())
+	}
+}
@@ -0,0 +1,160 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	inventoryv1alpha1 "github.com/kyma-incubator/kymactl/api/v1alpha1"
+)
+
+// Field indexes of the references between the inventory kinds. The referenced objects are in the same namespace
+const (
+	clusterRefKey = ".spec.clusterRef.name"
+	networkRefKey = ".spec.networkRef.name"
+	kymaRefKey    = ".spec.kymaRef.name"
+)
+
+type referenceIndex struct {
+	obj     client.Object
+	key     string
+	extract func(client.Object) string
+}
+
+var referenceIndexes = []referenceIndex{
+	{&inventoryv1alpha1.Kyma{}, clusterRefKey, func(o client.Object) string {
+		return clusterRefName(o.(*inventoryv1alpha1.Kyma).Spec.ClusterRef)
+	}},
+	{&inventoryv1alpha1.HelmComponent{}, clusterRefKey, func(o client.Object) string {
+		return clusterRefName(o.(*inventoryv1alpha1.HelmComponent).Spec.ClusterRef)
+	}},
+	{&inventoryv1alpha1.Network{}, clusterRefKey, func(o client.Object) string {
+		return clusterRefName(o.(*inventoryv1alpha1.Network).Spec.ClusterRef)
+	}},
+	{&inventoryv1alpha1.Runtime{}, clusterRefKey, func(o client.Object) string {
+		return o.(*inventoryv1alpha1.Runtime).Spec.ClusterRef.Name
+	}},
+	{&inventoryv1alpha1.Runtime{}, networkRefKey, func(o client.Object) string {
+		if ref := o.(*inventoryv1alpha1.Runtime).Spec.NetworkRef; ref != nil {
+			return ref.Name
+		}
+		return ""
+	}},
+	{&inventoryv1alpha1.Runtime{}, kymaRefKey, func(o client.Object) string {
+		return o.(*inventoryv1alpha1.Runtime).Spec.KymaRef.Name
+	}},
+	// the owner index needs only the metadata of the components, but the reconciliation reads their status and the
+	// HelmComponent controller caches the full objects anyway; a metadata informer would cache every component twice
+	{&inventoryv1alpha1.HelmComponent{}, componentOwnerKey, func(o client.Object) string {
+		if owner := metav1.GetControllerOf(o); owner != nil && owner.APIVersion == apiGVStr && owner.Kind == "Kyma" {
+			return owner.Name
+		}
+		return ""
+	}},
+}
+
+// SetupReferenceIndexes indexes the inventory kinds by the names of the objects they reference and the HelmComponents
+// by their Kyma owner.
+// It must be called once before the controllers are set up.
+func SetupReferenceIndexes(ctx context.Context, indexer client.FieldIndexer) error {
+	for _, index := range referenceIndexes {
+		extract := index.extract
+		if err := indexer.IndexField(ctx, index.obj, index.key, func(o client.Object) []string {
+			if name := extract(o); name != "" {
+				return []string{name}
+			}
+			return nil
+		}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func clusterRefName(ref *inventoryv1alpha1.ClusterReference) string {
+	if ref == nil {
+		return ""
+	}
+	return ref.Name
+}
+
+// referencing maps an object to the objects in its namespace which reference it with the index key
+func referencing(c client.Reader, list client.ObjectList, key string) handler.MapFunc {
+	return func(o client.Object) []reconcile.Request {
+		return referencingName(c, list.DeepCopyObject().(client.ObjectList), key, o.GetNamespace(), o.GetName())
+	}
+}
+
+// referencingName returns requests for the objects in the namespace which reference the name with the index key
+func referencingName(c client.Reader, list client.ObjectList, key, namespace, name string) []reconcile.Request {
+	if name == "" {
+		return nil
+	}
+	if err := c.List(context.Background(), list, client.InNamespace(namespace), client.MatchingFields{key: name}); err != nil {
+		return nil
+	}
+	items, err := meta.ExtractList(list)
+	if err != nil {
+		return nil
+	}
+	var requests []reconcile.Request
+	for _, item := range items {
+		if o, ok := item.(client.Object); ok {
+			requests = append(requests, reconcile.Request{NamespacedName: types.NamespacedName{Namespace: o.GetNamespace(), Name: o.GetName()}})
+		}
+	}
+	return requests
+}
+
+// clusterReadinessChanged passes updates of Clusters which change the reachability or the OIDC verification,
+// the periodic probes are filtered out
+var clusterReadinessChanged = predicate.Funcs{
+	UpdateFunc: func(e event.UpdateEvent) bool {
+		old, ok := e.ObjectOld.(*inventoryv1alpha1.Cluster)
+		if !ok {
+			return true
+		}
+		cluster := e.ObjectNew.(*inventoryv1alpha1.Cluster)
+		return old.Status.Reachable != cluster.Status.Reachable ||
+			!equality.Semantic.DeepEqual(old.Status.Oidc, cluster.Status.Oidc) ||
+			!cluster.DeletionTimestamp.Equal(old.DeletionTimestamp)
+	},
+}
+
+// networkValidityChanged passes updates of Networks which change the errors or conflicts
+var networkValidityChanged = predicate.Funcs{
+	UpdateFunc: func(e event.UpdateEvent) bool {
+		old, ok := e.ObjectOld.(*inventoryv1alpha1.Network)
+		if !ok {
+			return true
+		}
+		network := e.ObjectNew.(*inventoryv1alpha1.Network)
+		return !equality.Semantic.DeepEqual(old.Status, network.Status) ||
+			clusterRefName(old.Spec.ClusterRef) != clusterRefName(network.Spec.ClusterRef) ||
+			!network.DeletionTimestamp.Equal(old.DeletionTimestamp)
+	},
+}
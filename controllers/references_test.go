@@ -0,0 +1,78 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/utils/pointer"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	inventoryv1alpha1 "github.com/kyma-incubator/kymactl/api/v1alpha1"
+)
+
+// recordingIndexer records the index functions by object type and field
+type recordingIndexer map[string]client.IndexerFunc
+
+func (i recordingIndexer) IndexField(_ context.Context, obj client.Object, field string, extract client.IndexerFunc) error {
+	i[fmt.Sprintf("%T%s", obj, field)] = extract
+	return nil
+}
+
+func TestReferenceIndexes(t *testing.T) {
+	indexer := recordingIndexer{}
+	if err := SetupReferenceIndexes(context.Background(), indexer); err != nil {
+		t.Fatal(err)
+	}
+	cluster := &inventoryv1alpha1.ClusterReference{Name: "cluster"}
+	runtime := &inventoryv1alpha1.Runtime{Spec: inventoryv1alpha1.RuntimeSpec{
+		ClusterRef: *cluster,
+		KymaRef:    inventoryv1alpha1.KymaReference{Name: "kyma"},
+	}}
+	for _, tc := range []struct {
+		obj      client.Object
+		key      string
+		expected []string
+	}{
+		{&inventoryv1alpha1.Kyma{Spec: inventoryv1alpha1.KymaSpec{ClusterRef: cluster}}, clusterRefKey, []string{"cluster"}},
+		{&inventoryv1alpha1.Kyma{}, clusterRefKey, nil},
+		{&inventoryv1alpha1.HelmComponent{Spec: inventoryv1alpha1.HelmComponentSpec{ClusterRef: cluster}}, clusterRefKey, []string{"cluster"}},
+		{&inventoryv1alpha1.Network{Spec: inventoryv1alpha1.NetworkSpec{ClusterRef: cluster}}, clusterRefKey, []string{"cluster"}},
+		{runtime, clusterRefKey, []string{"cluster"}},
+		{runtime, networkRefKey, nil},
+		{runtime, kymaRefKey, []string{"kyma"}},
+		{&inventoryv1alpha1.HelmComponent{ObjectMeta: metav1.ObjectMeta{OwnerReferences: []metav1.OwnerReference{
+			{APIVersion: apiGVStr, Kind: "Kyma", Name: "kyma", Controller: pointer.Bool(true)},
+		}}}, componentOwnerKey, []string{"kyma"}},
+		{&inventoryv1alpha1.HelmComponent{ObjectMeta: metav1.ObjectMeta{OwnerReferences: []metav1.OwnerReference{
+			{APIVersion: apiGVStr, Kind: "Kyma", Name: "kyma"},
+		}}}, componentOwnerKey, nil},
+	} {
+		extract, ok := indexer[fmt.Sprintf("%T%s", tc.obj, tc.key)]
+		if !ok {
+			t.Errorf("%T not indexed by %s", tc.obj, tc.key)
+			continue
+		}
+		if values := extract(tc.obj); !reflect.DeepEqual(values, tc.expected) {
+			t.Errorf("%T %s: expected %v, got %v", tc.obj, tc.key, tc.expected, values)
+		}
+	}
+}
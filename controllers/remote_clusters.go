@@ -0,0 +1,138 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/discovery"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/clientcmd"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/apiutil"
+
+	inventoryv1alpha1 "github.com/kyma-incubator/kymactl/api/v1alpha1"
+)
+
+// remoteClusterTimeout limits the requests to remote API servers
+const remoteClusterTimeout = 10 * time.Second
+
+// RemoteCluster is the access to the API server of a Cluster
+type RemoteCluster struct {
+	Config    *rest.Config
+	Client    client.Client
+	Discovery discovery.DiscoveryInterface
+
+	// resource version of the kubeconfig Secret the clients are built from
+	secretVersion string
+}
+
+// RemoteClusters caches the clients of the remote clusters by Cluster.
+// The clients are rebuilt when the kubeconfig Secret changes.
+type RemoteClusters struct {
+	// Scheme of the remote clients. If not provided: scheme of client-go
+	Scheme *runtime.Scheme
+
+	mu       sync.RWMutex
+	clusters map[types.NamespacedName]*RemoteCluster
+}
+
+// Get returns the cached access to the cluster
+func (c *RemoteClusters) Get(cluster types.NamespacedName) (*RemoteCluster, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	remote, ok := c.clusters[cluster]
+	return remote, ok
+}
+
+// Connect returns the access to the cluster using the kubeconfig from the Secret.
+// The cached clients are reused as long as the Secret doesn't change.
+func (c *RemoteClusters) Connect(cluster types.NamespacedName, secret *corev1.Secret, key string) (*RemoteCluster, error) {
+	if remote, ok := c.Get(cluster); ok && remote.secretVersion == secret.ResourceVersion {
+		return remote, nil
+	}
+
+	kubeconfig, ok := secret.Data[key]
+	if !ok {
+		return nil, fmt.Errorf("secret %s has no key %s", secret.Name, key)
+	}
+	config, err := clientcmd.RESTConfigFromKubeConfig(kubeconfig)
+	if err != nil {
+		return nil, fmt.Errorf("invalid kubeconfig in secret %s: %w", secret.Name, err)
+	}
+	config.Timeout = remoteClusterTimeout
+	discoveryClient, err := discovery.NewDiscoveryClientForConfig(config)
+	if err != nil {
+		return nil, err
+	}
+	// lazy discovery, so the clients can be built while the cluster is not reachable
+	mapper, err := apiutil.NewDynamicRESTMapper(config, apiutil.WithLazyDiscovery)
+	if err != nil {
+		return nil, err
+	}
+	remoteClient, err := client.New(config, client.Options{Scheme: c.Scheme, Mapper: mapper})
+	if err != nil {
+		return nil, err
+	}
+	remote := &RemoteCluster{Config: config, Client: remoteClient, Discovery: discoveryClient, secretVersion: secret.ResourceVersion}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.clusters == nil {
+		c.clusters = map[types.NamespacedName]*RemoteCluster{}
+	}
+	c.clusters[cluster] = remote
+	return remote, nil
+}
+
+// ConnectSecret returns the access to the cluster using the kubeconfig Secret of the reference.
+// Only the metadata of Secrets is cached: the cached clients are reused as long as the resource version of the Secret
+// doesn't change, otherwise the Secret is read with the API reader. Without API reader the Secret is read with the client.
+func (c *RemoteClusters) ConnectSecret(ctx context.Context, cached client.Reader, apiReader client.Reader, cluster types.NamespacedName, ref *inventoryv1alpha1.KubeconfigSecretReference) (*RemoteCluster, error) {
+	key := types.NamespacedName{Namespace: cluster.Namespace, Name: ref.Name}
+	if apiReader == nil {
+		apiReader = cached
+	} else {
+		secretMeta := &metav1.PartialObjectMetadata{}
+		secretMeta.SetGroupVersionKind(corev1.SchemeGroupVersion.WithKind("Secret"))
+		if err := cached.Get(ctx, key, secretMeta); err != nil {
+			return nil, err
+		}
+		if remote, ok := c.Get(cluster); ok && remote.secretVersion == secretMeta.ResourceVersion {
+			return remote, nil
+		}
+	}
+	var secret corev1.Secret
+	if err := apiReader.Get(ctx, key, &secret); err != nil {
+		return nil, err
+	}
+	return c.Connect(cluster, &secret, ref.KeyOrDefault())
+}
+
+// Forget removes the cached access to the cluster
+func (c *RemoteClusters) Forget(cluster types.NamespacedName) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.clusters, cluster)
+}
@@ -0,0 +1,152 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"math/rand"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"k8s.io/client-go/util/workqueue"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+	"sigs.k8s.io/controller-runtime/pkg/runtime/inject"
+)
+
+var (
+	resyncRequeues = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "kymactl_resync_requeues_total",
+		Help: "Number of jittered requeues of successfully reconciled objects",
+	}, []string{"controller"})
+	startupRampPending = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "kymactl_startup_ramp_pending",
+		Help: "Number of existing objects delayed by the startup ramp which are not queued yet",
+	}, []string{"controller"})
+)
+
+func init() {
+	metrics.Registry.MustRegister(resyncRequeues, startupRampPending)
+}
+
+// Resync requeues the successfully reconciled objects after the period varied by the jitter, so the periodic
+// reconciliations are spread over time instead of happening for all objects at the same moment
+type Resync struct {
+	// Period between the reconciliations of an object. If not provided: no requeue
+	Period time.Duration
+	// Fraction of the period the requeue varies by, e.g. 0.2 for +-20%
+	Jitter float64
+}
+
+// After returns the jittered period, 0 if the period is not provided
+func (r Resync) After() time.Duration {
+	if r.Period <= 0 {
+		return 0
+	}
+	return time.Duration(float64(r.Period) * (1 + r.Jitter*(2*rand.Float64()-1)))
+}
+
+// result requeues the object of the controller after the jittered period. With a priority queue the object is
+// queued with the low priority, otherwise the controller queue requeues it
+func (r Resync) result(queue *priorityQueue, controller string, req ctrl.Request) ctrl.Result {
+	after := r.After()
+	if after <= 0 {
+		return ctrl.Result{}
+	}
+	resyncRequeues.WithLabelValues(controller).Inc()
+	if queue != nil {
+		queue.addAfter(req, after, priorityLow)
+		return ctrl.Result{}
+	}
+	return ctrl.Result{RequeueAfter: after}
+}
+
+// startupRamp spreads the reconciliations of the objects created before the controller was set up over the window.
+// Without it the initial list of the cache queues all existing objects at once.
+// The create events of these objects are filtered from the regular watches and queued with a random delay.
+type startupRamp struct {
+	controller string
+	window     time.Duration
+	start      time.Time
+}
+
+func newStartupRamp(controller string, window time.Duration) *startupRamp {
+	return &startupRamp{controller: controller, window: window, start: time.Now()}
+}
+
+// existing returns true for the objects created before the controller was set up, if the ramp is enabled
+func (r *startupRamp) existing(obj client.Object) bool {
+	return r.window > 0 && obj.GetCreationTimestamp().Time.Before(r.start)
+}
+
+// Existing selects the create events of the existing objects
+func (r *startupRamp) Existing() predicate.Predicate {
+	return predicate.Funcs{
+		CreateFunc:  func(e event.CreateEvent) bool { return r.existing(e.Object) },
+		UpdateFunc:  func(event.UpdateEvent) bool { return false },
+		DeleteFunc:  func(event.DeleteEvent) bool { return false },
+		GenericFunc: func(event.GenericEvent) bool { return false },
+	}
+}
+
+// Others selects all events but the create events of the existing objects
+func (r *startupRamp) Others() predicate.Predicate {
+	return predicate.Funcs{
+		CreateFunc: func(e event.CreateEvent) bool { return !r.existing(e.Object) },
+	}
+}
+
+// Handler queues the requests of the inner handler with a random delay within the remaining window
+func (r *startupRamp) Handler(inner handler.EventHandler) handler.EventHandler {
+	return rampHandler{EventHandler: inner, ramp: r}
+}
+
+type rampHandler struct {
+	handler.EventHandler
+	ramp *startupRamp
+}
+
+func (h rampHandler) Create(e event.CreateEvent, q workqueue.RateLimitingInterface) {
+	remaining := h.ramp.window - time.Since(h.ramp.start)
+	if remaining <= 0 {
+		h.EventHandler.Create(e, q)
+		return
+	}
+	h.EventHandler.Create(e, delayingQueue{RateLimitingInterface: q, delay: time.Duration(rand.Int63n(int64(remaining))), controller: h.ramp.controller})
+}
+
+// InjectFunc passes the scheme and the mapper needed by handler.EnqueueRequestForOwner to the inner handler
+func (h rampHandler) InjectFunc(f inject.Func) error {
+	return f(h.EventHandler)
+}
+
+// delayingQueue adds the items after the delay
+type delayingQueue struct {
+	workqueue.RateLimitingInterface
+	delay      time.Duration
+	controller string
+}
+
+func (q delayingQueue) Add(item interface{}) {
+	pending := startupRampPending.WithLabelValues(q.controller)
+	pending.Inc()
+	time.AfterFunc(q.delay, pending.Dec)
+	q.AddAfter(item, q.delay)
+}
@@ -0,0 +1,152 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/util/workqueue"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/runtime/inject"
+
+	inventoryv1alpha1 "github.com/kyma-incubator/kymactl/api/v1alpha1"
+)
+
+func TestResyncAfter(t *testing.T) {
+	if after := (Resync{}).After(); after != 0 {
+		t.Errorf("expected no requeue without period, got %v", after)
+	}
+	resync := Resync{Period: 10 * time.Minute, Jitter: 0.2}
+	min, max := resync.Period, resync.Period
+	for i := 0; i < 1000; i++ {
+		after := resync.After()
+		if after < min {
+			min = after
+		}
+		if after > max {
+			max = after
+		}
+	}
+	if min < 8*time.Minute || max > 12*time.Minute || max-min < 2*time.Minute {
+		t.Errorf("expected requeues spread between 8m and 12m, got %v - %v", min, max)
+	}
+}
+
+func TestStartupRamp(t *testing.T) {
+	ramp := newStartupRamp("test", time.Hour)
+	existing := &inventoryv1alpha1.Kyma{ObjectMeta: metav1.ObjectMeta{
+		Namespace: "default", Name: "existing", CreationTimestamp: metav1.NewTime(ramp.start.Add(-time.Hour)),
+	}}
+	created := &inventoryv1alpha1.Kyma{ObjectMeta: metav1.ObjectMeta{
+		Namespace: "default", Name: "created", CreationTimestamp: metav1.NewTime(ramp.start.Add(time.Second)),
+	}}
+	if !ramp.Existing().Create(event.CreateEvent{Object: existing}) || ramp.Others().Create(event.CreateEvent{Object: existing}) {
+		t.Error("expected existing Kyma handled by the ramp only")
+	}
+	if ramp.Existing().Create(event.CreateEvent{Object: created}) || !ramp.Others().Create(event.CreateEvent{Object: created}) {
+		t.Error("expected created Kyma not handled by the ramp")
+	}
+	if ramp.Existing().Update(event.UpdateEvent{ObjectOld: existing, ObjectNew: existing}) || !ramp.Others().Update(event.UpdateEvent{ObjectOld: existing, ObjectNew: existing}) {
+		t.Error("expected updates not handled by the ramp")
+	}
+	if disabled := newStartupRamp("test", 0); disabled.Existing().Create(event.CreateEvent{Object: existing}) {
+		t.Error("expected no ramp without window")
+	}
+
+	q := workqueue.NewRateLimitingQueue(workqueue.DefaultControllerRateLimiter())
+	defer q.ShutDown()
+	pending := testutil.ToFloat64(startupRampPending.WithLabelValues("test"))
+	ramp.Handler(&handler.EnqueueRequestForObject{}).Create(event.CreateEvent{Object: existing}, q)
+	if q.Len() != 0 || testutil.ToFloat64(startupRampPending.WithLabelValues("test")) != pending+1 {
+		t.Errorf("expected delayed request, got queue length %d", q.Len())
+	}
+
+	// the delay is within the remaining window
+	ramp.start = time.Now().Add(-time.Hour + 50*time.Millisecond)
+	ramp.Handler(&handler.EnqueueRequestForObject{}).Create(event.CreateEvent{Object: existing}, q)
+	time.Sleep(200 * time.Millisecond)
+	if q.Len() != 1 {
+		t.Errorf("expected request queued at the end of the window, got queue length %d", q.Len())
+	}
+}
+
+func TestStartupRampEnqueuesOwner(t *testing.T) {
+	scheme := runtime.NewScheme()
+	if err := inventoryv1alpha1.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+	mapper := meta.NewDefaultRESTMapper(nil)
+	mapper.Add(inventoryv1alpha1.GroupVersion.WithKind("Kyma"), meta.RESTScopeNamespace)
+	// same injection as the controller does for the handlers of its watches
+	var setFields inject.Func
+	setFields = func(i interface{}) error {
+		if _, err := inject.SchemeInto(scheme, i); err != nil {
+			return err
+		}
+		if _, err := inject.MapperInto(mapper, i); err != nil {
+			return err
+		}
+		_, err := inject.InjectorInto(setFields, i)
+		return err
+	}
+
+	ramp := newStartupRamp("test-owner", 100*time.Millisecond)
+	h := ramp.Handler(&handler.EnqueueRequestForOwner{OwnerType: &inventoryv1alpha1.Kyma{}, IsController: true})
+	if err := setFields(h); err != nil {
+		t.Fatal(err)
+	}
+	kyma := &inventoryv1alpha1.Kyma{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "kyma", UID: "kyma-uid"}}
+	helmComponent := &inventoryv1alpha1.HelmComponent{ObjectMeta: metav1.ObjectMeta{
+		Namespace: "default", Name: "kyma-istio", CreationTimestamp: metav1.NewTime(ramp.start.Add(-time.Hour)),
+	}}
+	if err := ctrl.SetControllerReference(kyma, helmComponent, scheme); err != nil {
+		t.Fatal(err)
+	}
+
+	q := workqueue.NewRateLimitingQueue(workqueue.DefaultControllerRateLimiter())
+	defer q.ShutDown()
+	h.Create(event.CreateEvent{Object: helmComponent}, q)
+	time.Sleep(300 * time.Millisecond)
+	if q.Len() != 1 {
+		t.Fatalf("expected owning Kyma queued, got queue length %d", q.Len())
+	}
+	item, _ := q.Get()
+	if item != (ctrl.Request{NamespacedName: types.NamespacedName{Namespace: "default", Name: "kyma"}}) {
+		t.Errorf("expected request for the owning Kyma, got %v", item)
+	}
+}
+
+func TestKymaResync(t *testing.T) {
+	r := newKymaTestReconciler(t, &inventoryv1alpha1.Kyma{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "kyma"}})
+	r.Resync = Resync{Period: time.Minute, Jitter: 0.2}
+	result, err := r.Reconcile(context.Background(), ctrl.Request{NamespacedName: types.NamespacedName{Namespace: "default", Name: "kyma"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.RequeueAfter < 48*time.Second || result.RequeueAfter > 72*time.Second {
+		t.Errorf("expected jittered requeue of the ready Kyma, got %v", result.RequeueAfter)
+	}
+}
@@ -0,0 +1,265 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"sort"
+	"strconv"
+	"time"
+
+	"k8s.io/apimachinery/pkg/api/equality"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	"sigs.k8s.io/controller-runtime/pkg/source"
+
+	configv1alpha1 "github.com/kyma-incubator/kymactl/api/config/v1alpha1"
+	inventoryv1alpha1 "github.com/kyma-incubator/kymactl/api/v1alpha1"
+)
+
+const (
+	defaultRolloutWaveSize         = "25%"
+	defaultRolloutProgressDeadline = 10 * time.Minute
+	rolloutRequeue                 = 10 * time.Second
+)
+
+// RolloutReconciler moves Kymas selected by a Rollout to a release channel in waves
+type RolloutReconciler struct {
+	client.Client
+	Scheme *runtime.Scheme
+	// Concurrency and rate limiter of the controller. If not provided: the default configuration
+	Options controller.Options
+}
+
+//+kubebuilder:rbac:groups=inventory.kyma-project.io,resources=rollouts,verbs=get;list;watch;create;update;patch;delete
+//+kubebuilder:rbac:groups=inventory.kyma-project.io,resources=rollouts/status,verbs=get;update;patch
+//+kubebuilder:rbac:groups=inventory.kyma-project.io,resources=rollouts/finalizers,verbs=update
+
+// Reconcile counts the progress of the started waves and starts the next wave
+// when all Kymas of the previous waves are ready or failed.
+// The rollout halts when the number of failed Kymas exceeds spec.maxFailures.
+// A completed rollout starts new waves for Kymas selected later, a changed spec.channel starts the waves again.
+func (r *RolloutReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	log := log.FromContext(ctx)
+
+	var rollout inventoryv1alpha1.Rollout
+	if err := r.Get(ctx, req.NamespacedName, &rollout); err != nil {
+		return ctrl.Result{}, client.IgnoreNotFound(err)
+	}
+	selector, err := metav1.LabelSelectorAsSelector(&rollout.Spec.Selector)
+	if err != nil {
+		log.Error(err, "invalid Kyma selector")
+		// don't bother requeuing until we get a change to the spec
+		return ctrl.Result{}, nil
+	}
+	var kymas inventoryv1alpha1.KymaList
+	if err := r.List(ctx, &kymas, client.InNamespace(req.Namespace), client.MatchingLabelsSelector{Selector: selector}); err != nil {
+		log.Error(err, "unable to list Kymas")
+		return ctrl.Result{}, err
+	}
+	sort.Slice(kymas.Items, func(i, j int) bool { return kymas.Items[i].Name < kymas.Items[j].Name })
+
+	total := len(kymas.Items)
+	waveSize, err := scaledValue(rollout.Spec.WaveSize, intstr.FromString(defaultRolloutWaveSize), total, true)
+	if err != nil {
+		log.Error(err, "invalid wave size")
+		return ctrl.Result{}, nil
+	}
+	if waveSize < 1 {
+		waveSize = 1
+	}
+	maxFailures, err := scaledValue(rollout.Spec.MaxFailures, intstr.FromInt(0), total, false)
+	if err != nil {
+		log.Error(err, "invalid max failures")
+		return ctrl.Result{}, nil
+	}
+	deadline := defaultRolloutProgressDeadline
+	if rollout.Spec.ProgressDeadline != nil {
+		deadline = rollout.Spec.ProgressDeadline.Duration
+	}
+
+	now := metav1.Now()
+	status := inventoryv1alpha1.RolloutStatus{Total: total, Channel: rollout.Spec.Channel}
+	if rollout.Status.Channel != "" && rollout.Status.Channel != rollout.Spec.Channel {
+		// the Kymas moved to the previous channel are moved again in new waves
+		log.Info("Channel changed, restart waves", "from", rollout.Status.Channel, "to", rollout.Spec.Channel)
+	} else {
+		for _, w := range rollout.Status.Waves {
+			status.Waves = append(status.Waves, inventoryv1alpha1.RolloutWave{Number: w.Number, StartTime: w.StartTime, CompletionTime: w.CompletionTime})
+		}
+	}
+	wave := func(number int) *inventoryv1alpha1.RolloutWave {
+		// waves of Kymas updated before the status was written are started now
+		for len(status.Waves) < number {
+			status.Waves = append(status.Waves, inventoryv1alpha1.RolloutWave{Number: len(status.Waves) + 1, StartTime: now})
+		}
+		return &status.Waves[number-1]
+	}
+
+	progressing := false
+	var pending []*inventoryv1alpha1.Kyma
+	for i := range kymas.Items {
+		kyma := &kymas.Items[i]
+		owner := kyma.Labels[inventoryv1alpha1.RolloutLabel]
+		if owner == rollout.Name && kyma.Spec.Channel != rollout.Spec.Channel {
+			// moved to a previous channel of the rollout
+			pending = append(pending, kyma)
+			continue
+		}
+		if owner != rollout.Name {
+			switch {
+			case kyma.Spec.Channel == rollout.Spec.Channel:
+				// already using the channel
+				status.Updated++
+				if kymaReady(kyma, rollout.Spec.Channel) {
+					status.Succeeded++
+				}
+			case owner == "":
+				pending = append(pending, kyma)
+			}
+			continue
+		}
+		number, err := strconv.Atoi(kyma.Annotations[inventoryv1alpha1.RolloutWaveAnnotation])
+		if err != nil || number < 1 {
+			number = 1
+		}
+		w := wave(number)
+		status.Updated++
+		w.Updated++
+		switch {
+		case kymaReady(kyma, rollout.Spec.Channel):
+			status.Succeeded++
+			w.Succeeded++
+		case w.CompletionTime != nil:
+			// the wave completed, later failures of the Kyma don't halt the rollout
+		case now.Sub(w.StartTime.Time) > deadline:
+			status.Failed++
+			w.Failed++
+		default:
+			progressing = true
+		}
+	}
+	for i := range status.Waves {
+		w := &status.Waves[i]
+		if w.CompletionTime == nil && w.Updated > 0 && w.Succeeded == w.Updated {
+			w.CompletionTime = &now
+		}
+	}
+
+	switch {
+	case status.Failed > maxFailures:
+		status.Phase = inventoryv1alpha1.RolloutHalted
+		log.Info("Rollout halted", "failed", status.Failed, "maxFailures", maxFailures)
+	case len(pending) == 0 && !progressing:
+		status.Phase = inventoryv1alpha1.RolloutCompleted
+		if rollout.Status.Phase != inventoryv1alpha1.RolloutCompleted {
+			log.Info("Rollout completed", "updated", status.Updated)
+		}
+	case rollout.Spec.Paused:
+		status.Phase = inventoryv1alpha1.RolloutPaused
+	case progressing:
+		status.Phase = inventoryv1alpha1.RolloutProgressing
+	default:
+		status.Phase = inventoryv1alpha1.RolloutProgressing
+		if len(pending) > waveSize {
+			pending = pending[:waveSize]
+		}
+		w := wave(len(status.Waves) + 1)
+		log.Info("Start wave", "wave", w.Number, "kymas", len(pending))
+		for _, kyma := range pending {
+			patch := mergeFrom(kyma)
+			if kyma.Labels == nil {
+				kyma.Labels = map[string]string{}
+			}
+			if kyma.Annotations == nil {
+				kyma.Annotations = map[string]string{}
+			}
+			kyma.Labels[inventoryv1alpha1.RolloutLabel] = rollout.Name
+			kyma.Annotations[inventoryv1alpha1.RolloutWaveAnnotation] = strconv.Itoa(w.Number)
+			kyma.Spec.Channel = rollout.Spec.Channel
+			if err := r.Patch(ctx, kyma, patch); err != nil {
+				log.Error(err, "unable to update Kyma", "kyma", kyma.Name)
+				return ctrl.Result{}, err
+			}
+			status.Updated++
+			w.Updated++
+		}
+	}
+
+	if !equality.Semantic.DeepEqual(rollout.Status, status) {
+		rollout.Status = status
+		if err := r.Status().Update(ctx, &rollout); err != nil {
+			return ctrl.Result{}, IgnoreStatusUpdateConflict(err)
+		}
+	}
+	if status.Phase == inventoryv1alpha1.RolloutProgressing || status.Phase == inventoryv1alpha1.RolloutPaused {
+		// Kymas which are not ready fail after the progress deadline
+		return ctrl.Result{RequeueAfter: rolloutRequeue}, nil
+	}
+	return ctrl.Result{}, nil
+}
+
+// kymaReady returns true if the Kyma installed all components using the release channel
+func kymaReady(kyma *inventoryv1alpha1.Kyma, channel string) bool {
+	return kyma.Status.Status == "success" && kyma.Status.Channel == channel
+}
+
+func scaledValue(value *intstr.IntOrString, defaultValue intstr.IntOrString, total int, roundUp bool) (int, error) {
+	if value == nil {
+		value = &defaultValue
+	}
+	return intstr.GetScaledValueFromIntOrPercent(value, total, roundUp)
+}
+
+// rolloutsForKyma returns the rollout which updated the Kyma or, for a Kyma not updated yet, the rollouts selecting it
+func (r *RolloutReconciler) rolloutsForKyma(o client.Object) []reconcile.Request {
+	if name := o.GetLabels()[inventoryv1alpha1.RolloutLabel]; name != "" {
+		return []reconcile.Request{{NamespacedName: types.NamespacedName{Namespace: o.GetNamespace(), Name: name}}}
+	}
+	var rollouts inventoryv1alpha1.RolloutList
+	if err := r.List(context.Background(), &rollouts, client.InNamespace(o.GetNamespace())); err != nil {
+		log.Log.Error(err, "unable to list Rollouts", "namespace", o.GetNamespace())
+		return nil
+	}
+	var requests []reconcile.Request
+	for _, rollout := range rollouts.Items {
+		selector, err := metav1.LabelSelectorAsSelector(&rollout.Spec.Selector)
+		if err != nil || !selector.Matches(labels.Set(o.GetLabels())) {
+			continue
+		}
+		requests = append(requests, reconcile.Request{NamespacedName: types.NamespacedName{Namespace: rollout.Namespace, Name: rollout.Name}})
+	}
+	return requests
+}
+
+// SetupWithManager sets up the controller with the Manager.
+func (r *RolloutReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewControllerManagedBy(mgr).
+		For(&inventoryv1alpha1.Rollout{}).
+		Watches(&source.Kind{Type: &inventoryv1alpha1.Kyma{}}, handler.EnqueueRequestsFromMapFunc(r.rolloutsForKyma)).
+		WithOptions(defaultOptions(r.Options, configv1alpha1.RolloutController)).
+		Complete(r)
+}
@@ -0,0 +1,202 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	inventoryv1alpha1 "github.com/kyma-incubator/kymactl/api/v1alpha1"
+)
+
+// rolloutKey is the Rollout created by rolloutTestObjects
+var rolloutKey = types.NamespacedName{Namespace: "default", Name: "rollout"}
+
+func rolloutTestObjects(kymas int, spec inventoryv1alpha1.RolloutSpec) []client.Object {
+	objs := []client.Object{&inventoryv1alpha1.Rollout{
+		ObjectMeta: metav1.ObjectMeta{Name: "rollout", Namespace: "default"},
+		Spec:       spec,
+	}}
+	for i := 0; i < kymas; i++ {
+		objs = append(objs, &inventoryv1alpha1.Kyma{
+			ObjectMeta: metav1.ObjectMeta{Name: fmt.Sprintf("kyma-%d", i), Namespace: "default", Labels: map[string]string{"region": "europe"}},
+			Status:     inventoryv1alpha1.KymaStatus{Status: "success", Channel: "stable"},
+		})
+	}
+	return objs
+}
+
+// setKymasReady simulates the Kyma controller for all Kymas using the channel
+func setKymasReady(t *testing.T, r *RolloutReconciler, channel string) {
+	var kymas inventoryv1alpha1.KymaList
+	if err := r.List(context.Background(), &kymas); err != nil {
+		t.Fatal(err)
+	}
+	for i := range kymas.Items {
+		kyma := &kymas.Items[i]
+		if kyma.Spec.Channel == channel && kyma.Status.Channel != channel {
+			kyma.Status.Channel = channel
+			if err := r.Status().Update(context.Background(), kyma); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+}
+
+func TestRolloutUpdatesKymasInWaves(t *testing.T) {
+	waveSize := intstr.FromInt(2)
+	r := &RolloutReconciler{Client: newTestClient(t, rolloutTestObjects(3, inventoryv1alpha1.RolloutSpec{
+		Selector: metav1.LabelSelector{MatchLabels: map[string]string{"region": "europe"}},
+		Channel:  "fast",
+		WaveSize: &waveSize,
+	})...)}
+
+	rollout := reconcileAndGet(t, r, rolloutKey, &inventoryv1alpha1.Rollout{})
+	if rollout.Status.Phase != inventoryv1alpha1.RolloutProgressing || rollout.Status.Updated != 2 || len(rollout.Status.Waves) != 1 {
+		t.Fatalf("expected first wave with 2 Kymas, got %+v", rollout.Status)
+	}
+
+	// the next wave waits until the first one is ready
+	rollout = reconcileAndGet(t, r, rolloutKey, &inventoryv1alpha1.Rollout{})
+	if rollout.Status.Updated != 2 || len(rollout.Status.Waves) != 1 {
+		t.Fatalf("expected no new wave, got %+v", rollout.Status)
+	}
+
+	setKymasReady(t, r, "fast")
+	rollout = reconcileAndGet(t, r, rolloutKey, &inventoryv1alpha1.Rollout{})
+	if rollout.Status.Updated != 3 || len(rollout.Status.Waves) != 2 || rollout.Status.Waves[0].CompletionTime == nil {
+		t.Fatalf("expected second wave, got %+v", rollout.Status)
+	}
+
+	setKymasReady(t, r, "fast")
+	rollout = reconcileAndGet(t, r, rolloutKey, &inventoryv1alpha1.Rollout{})
+	if rollout.Status.Phase != inventoryv1alpha1.RolloutCompleted || rollout.Status.Succeeded != 3 {
+		t.Fatalf("expected completed rollout, got %+v", rollout.Status)
+	}
+}
+
+func TestRolloutHaltsOnFailures(t *testing.T) {
+	waveSize := intstr.FromString("50%")
+	r := &RolloutReconciler{Client: newTestClient(t, rolloutTestObjects(4, inventoryv1alpha1.RolloutSpec{
+		Selector:         metav1.LabelSelector{MatchLabels: map[string]string{"region": "europe"}},
+		Channel:          "fast",
+		WaveSize:         &waveSize,
+		ProgressDeadline: &metav1.Duration{Duration: time.Millisecond},
+	})...)}
+
+	reconcileAndGet(t, r, rolloutKey, &inventoryv1alpha1.Rollout{})
+	time.Sleep(10 * time.Millisecond)
+	rollout := reconcileAndGet(t, r, rolloutKey, &inventoryv1alpha1.Rollout{})
+	if rollout.Status.Phase != inventoryv1alpha1.RolloutHalted || rollout.Status.Failed != 2 || rollout.Status.Updated != 2 {
+		t.Fatalf("expected halted rollout, got %+v", rollout.Status)
+	}
+}
+
+func TestRolloutSelectsKymasByRegion(t *testing.T) {
+	objs := rolloutTestObjects(3, inventoryv1alpha1.RolloutSpec{
+		Selector: metav1.LabelSelector{MatchLabels: map[string]string{
+			inventoryv1alpha1.ProviderLabel: "gcp",
+			inventoryv1alpha1.RegionLabel:   "europe-west1",
+		}},
+		Channel: "fast",
+	})
+	objs[1].SetLabels(map[string]string{inventoryv1alpha1.ProviderLabel: "gcp", inventoryv1alpha1.RegionLabel: "europe-west1"})
+	objs[2].SetLabels(map[string]string{inventoryv1alpha1.ProviderLabel: "aws", inventoryv1alpha1.RegionLabel: "eu-central-1"})
+	r := &RolloutReconciler{Client: newTestClient(t, objs...)}
+
+	rollout := reconcileAndGet(t, r, rolloutKey, &inventoryv1alpha1.Rollout{})
+	if rollout.Status.Total != 1 || rollout.Status.Updated != 1 {
+		t.Fatalf("expected only the gcp/europe-west1 Kyma, got %+v", rollout.Status)
+	}
+}
+
+func TestRolloutRestartsWavesOnChannelChange(t *testing.T) {
+	waveSize := intstr.FromInt(2)
+	r := &RolloutReconciler{Client: newTestClient(t, rolloutTestObjects(3, inventoryv1alpha1.RolloutSpec{
+		Selector: metav1.LabelSelector{MatchLabels: map[string]string{"region": "europe"}},
+		Channel:  "fast",
+		WaveSize: &waveSize,
+	})...)}
+
+	rollout := reconcileAndGet(t, r, rolloutKey, &inventoryv1alpha1.Rollout{})
+	if rollout.Status.Channel != "fast" || rollout.Status.Updated != 2 {
+		t.Fatalf("expected first wave to the fast channel, got %+v", rollout.Status)
+	}
+
+	rollout.Spec.Channel = "nightly"
+	if err := r.Update(context.Background(), rollout); err != nil {
+		t.Fatal(err)
+	}
+	rollout = reconcileAndGet(t, r, rolloutKey, &inventoryv1alpha1.Rollout{})
+	if rollout.Status.Channel != "nightly" || rollout.Status.Updated != 2 || len(rollout.Status.Waves) != 1 || rollout.Status.Waves[0].StartTime.IsZero() {
+		t.Fatalf("expected restarted first wave to the nightly channel, got %+v", rollout.Status)
+	}
+	setKymasReady(t, r, "nightly")
+	reconcileAndGet(t, r, rolloutKey, &inventoryv1alpha1.Rollout{})
+	setKymasReady(t, r, "nightly")
+	rollout = reconcileAndGet(t, r, rolloutKey, &inventoryv1alpha1.Rollout{})
+	if rollout.Status.Phase != inventoryv1alpha1.RolloutCompleted || rollout.Status.Succeeded != 3 {
+		t.Fatalf("expected completed rollout, got %+v", rollout.Status)
+	}
+	var kymas inventoryv1alpha1.KymaList
+	if err := r.List(context.Background(), &kymas); err != nil {
+		t.Fatal(err)
+	}
+	for _, kyma := range kymas.Items {
+		if kyma.Spec.Channel != "nightly" {
+			t.Errorf("expected Kyma %s moved to the nightly channel, got %q", kyma.Name, kyma.Spec.Channel)
+		}
+	}
+}
+
+func TestRolloutUpdatesKymasSelectedAfterCompletion(t *testing.T) {
+	r := &RolloutReconciler{Client: newTestClient(t, rolloutTestObjects(1, inventoryv1alpha1.RolloutSpec{
+		Selector: metav1.LabelSelector{MatchLabels: map[string]string{"region": "europe"}},
+		Channel:  "fast",
+	})...)}
+	reconcileAndGet(t, r, rolloutKey, &inventoryv1alpha1.Rollout{})
+	setKymasReady(t, r, "fast")
+	rollout := reconcileAndGet(t, r, rolloutKey, &inventoryv1alpha1.Rollout{})
+	if rollout.Status.Phase != inventoryv1alpha1.RolloutCompleted {
+		t.Fatalf("expected completed rollout, got %+v", rollout.Status)
+	}
+
+	late := &inventoryv1alpha1.Kyma{ObjectMeta: metav1.ObjectMeta{Name: "late", Namespace: "default", Labels: map[string]string{"region": "europe"}}}
+	if err := r.Create(context.Background(), late); err != nil {
+		t.Fatal(err)
+	}
+	if requests := r.rolloutsForKyma(late); len(requests) != 1 || requests[0].Name != "rollout" {
+		t.Fatalf("expected the selecting rollout enqueued, got %v", requests)
+	}
+	rollout = reconcileAndGet(t, r, rolloutKey, &inventoryv1alpha1.Rollout{})
+	if rollout.Status.Phase != inventoryv1alpha1.RolloutProgressing || rollout.Status.Updated != 2 || len(rollout.Status.Waves) != 2 {
+		t.Fatalf("expected new wave for the late Kyma, got %+v", rollout.Status)
+	}
+	if err := r.Get(context.Background(), client.ObjectKeyFromObject(late), late); err != nil {
+		t.Fatal(err)
+	}
+	if late.Spec.Channel != "fast" || late.Labels[inventoryv1alpha1.RolloutLabel] != "rollout" {
+		t.Errorf("expected late Kyma moved to the fast channel, got %+v", late)
+	}
+}
@@ -0,0 +1,210 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/api/equality"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+	"sigs.k8s.io/controller-runtime/pkg/source"
+
+	configv1alpha1 "github.com/kyma-incubator/kymactl/api/config/v1alpha1"
+	inventoryv1alpha1 "github.com/kyma-incubator/kymactl/api/v1alpha1"
+)
+
+// RuntimeReconciler aggregates the Cluster, Network and Kyma of a Runtime into its phase
+type RuntimeReconciler struct {
+	client.Client
+	Scheme *runtime.Scheme
+	// Concurrency and rate limiter of the controller. If not provided: the default configuration
+	Options controller.Options
+}
+
+//+kubebuilder:rbac:groups=inventory.kyma-project.io,resources=runtimes,verbs=get;list;watch;create;update;patch;delete
+//+kubebuilder:rbac:groups=inventory.kyma-project.io,resources=runtimes/status,verbs=get;update;patch
+//+kubebuilder:rbac:groups=inventory.kyma-project.io,resources=runtimes/finalizers,verbs=update
+//+kubebuilder:rbac:groups=inventory.kyma-project.io,resources=clusters,verbs=get;list;watch
+//+kubebuilder:rbac:groups=inventory.kyma-project.io,resources=networks,verbs=get;list;watch
+//+kubebuilder:rbac:groups=inventory.kyma-project.io,resources=kymas,verbs=get;list;watch;delete
+
+// Reconcile sets the phase of the runtime: Provisioning until the Cluster is reachable and the Network is valid,
+// Installing until the Kyma installed all components and Ready afterwards.
+// A deleted runtime is Deprovisioning until its Kyma is deleted.
+func (r *RuntimeReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	log := log.FromContext(ctx)
+
+	var rt inventoryv1alpha1.Runtime
+	if err := r.Get(ctx, req.NamespacedName, &rt); err != nil {
+		return ctrl.Result{}, client.IgnoreNotFound(err)
+	}
+
+	if !rt.DeletionTimestamp.IsZero() {
+		if !controllerutil.ContainsFinalizer(&rt, inventoryv1alpha1.RuntimeFinalizer) {
+			return ctrl.Result{}, nil
+		}
+		deleted, err := r.deleteKyma(ctx, &rt)
+		if err != nil {
+			log.Error(err, "unable to delete Kyma", "kyma", rt.Spec.KymaRef.Name)
+			return ctrl.Result{}, err
+		}
+		if !deleted {
+			status := rt.Status
+			status.Phase = inventoryv1alpha1.RuntimeDeprovisioning
+			status.Message = fmt.Sprintf("Kyma %s is being deleted", rt.Spec.KymaRef.Name)
+			return ctrl.Result{}, r.updateStatus(ctx, &rt, status)
+		}
+		log.Info("Runtime deprovisioned")
+		controllerutil.RemoveFinalizer(&rt, inventoryv1alpha1.RuntimeFinalizer)
+		return ctrl.Result{}, r.Update(ctx, &rt)
+	}
+
+	if !controllerutil.ContainsFinalizer(&rt, inventoryv1alpha1.RuntimeFinalizer) {
+		controllerutil.AddFinalizer(&rt, inventoryv1alpha1.RuntimeFinalizer)
+		if err := r.Update(ctx, &rt); err != nil {
+			return ctrl.Result{}, err
+		}
+	}
+
+	status, err := r.aggregate(ctx, &rt)
+	if err != nil {
+		log.Error(err, "unable to aggregate Runtime status")
+		return ctrl.Result{}, err
+	}
+	if status.Phase != rt.Status.Phase {
+		log.Info("Runtime phase changed", "from", rt.Status.Phase, "to", status.Phase)
+	}
+	return ctrl.Result{}, r.updateStatus(ctx, &rt, status)
+}
+
+// aggregate computes the status of the runtime from the readiness of its Cluster, Network and Kyma
+func (r *RuntimeReconciler) aggregate(ctx context.Context, rt *inventoryv1alpha1.Runtime) (inventoryv1alpha1.RuntimeStatus, error) {
+	status := inventoryv1alpha1.RuntimeStatus{NetworkReady: true}
+	var messages []string
+	deprovisioning := false
+
+	var cluster inventoryv1alpha1.Cluster
+	switch err := r.Get(ctx, types.NamespacedName{Namespace: rt.Namespace, Name: rt.Spec.ClusterRef.Name}, &cluster); {
+	case apierrors.IsNotFound(err):
+		messages = append(messages, fmt.Sprintf("Cluster %s not found", rt.Spec.ClusterRef.Name))
+	case err != nil:
+		return status, err
+	default:
+		deprovisioning = deprovisioning || !cluster.DeletionTimestamp.IsZero()
+		status.ClusterReady = cluster.Status.Reachable
+		if !status.ClusterReady {
+			messages = append(messages, fmt.Sprintf("Cluster %s is not reachable", cluster.Name))
+		}
+	}
+
+	if ref := rt.Spec.NetworkRef; ref != nil {
+		var network inventoryv1alpha1.Network
+		switch err := r.Get(ctx, types.NamespacedName{Namespace: rt.Namespace, Name: ref.Name}, &network); {
+		case apierrors.IsNotFound(err):
+			status.NetworkReady = false
+			messages = append(messages, fmt.Sprintf("Network %s not found", ref.Name))
+		case err != nil:
+			return status, err
+		default:
+			deprovisioning = deprovisioning || !network.DeletionTimestamp.IsZero()
+			status.NetworkReady = network.Status.Valid
+			if !status.NetworkReady {
+				messages = append(messages, fmt.Sprintf("Network %s is not valid", network.Name))
+			}
+		}
+	}
+
+	var kyma inventoryv1alpha1.Kyma
+	switch err := r.Get(ctx, types.NamespacedName{Namespace: rt.Namespace, Name: rt.Spec.KymaRef.Name}, &kyma); {
+	case apierrors.IsNotFound(err):
+		messages = append(messages, fmt.Sprintf("Kyma %s not found", rt.Spec.KymaRef.Name))
+	case err != nil:
+		return status, err
+	default:
+		deprovisioning = deprovisioning || !kyma.DeletionTimestamp.IsZero()
+		status.KymaReady = kyma.Status.Status == "success"
+		if !status.KymaReady && len(kyma.Status.WaitingFor) > 0 {
+			messages = append(messages, fmt.Sprintf("Kyma %s is waiting for %s", kyma.Name, strings.Join(kyma.Status.WaitingFor, ",")))
+		} else if !status.KymaReady {
+			messages = append(messages, fmt.Sprintf("Kyma %s is not installed", kyma.Name))
+		}
+	}
+
+	switch {
+	case deprovisioning:
+		status.Phase = inventoryv1alpha1.RuntimeDeprovisioning
+	case !status.ClusterReady || !status.NetworkReady:
+		status.Phase = inventoryv1alpha1.RuntimeProvisioning
+	case !status.KymaReady:
+		status.Phase = inventoryv1alpha1.RuntimeInstalling
+	default:
+		status.Phase = inventoryv1alpha1.RuntimeReady
+	}
+	status.Message = strings.Join(messages, "; ")
+	return status, nil
+}
+
+// deleteKyma deletes the Kyma of the runtime and returns true when it is gone
+func (r *RuntimeReconciler) deleteKyma(ctx context.Context, rt *inventoryv1alpha1.Runtime) (bool, error) {
+	var kyma inventoryv1alpha1.Kyma
+	if err := r.Get(ctx, types.NamespacedName{Namespace: rt.Namespace, Name: rt.Spec.KymaRef.Name}, &kyma); err != nil {
+		return apierrors.IsNotFound(err), client.IgnoreNotFound(err)
+	}
+	if kyma.DeletionTimestamp.IsZero() {
+		if err := r.Delete(ctx, &kyma); err != nil {
+			return false, client.IgnoreNotFound(err)
+		}
+	}
+	return false, nil
+}
+
+func (r *RuntimeReconciler) updateStatus(ctx context.Context, rt *inventoryv1alpha1.Runtime, status inventoryv1alpha1.RuntimeStatus) error {
+	if equality.Semantic.DeepEqual(rt.Status, status) {
+		return nil
+	}
+	rt.Status = status
+	return IgnoreStatusUpdateConflict(r.Status().Update(ctx, rt))
+}
+
+// SetupWithManager sets up the controller with the Manager.
+func (r *RuntimeReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewControllerManagedBy(mgr).
+		For(&inventoryv1alpha1.Runtime{}, builder.WithPredicates(predicate.GenerationChangedPredicate{})).
+		// status changes of the referenced objects change the phase
+		Watches(&source.Kind{Type: &inventoryv1alpha1.Cluster{}},
+			handler.EnqueueRequestsFromMapFunc(referencing(mgr.GetClient(), &inventoryv1alpha1.RuntimeList{}, clusterRefKey)),
+			builder.WithPredicates(clusterReadinessChanged)).
+		Watches(&source.Kind{Type: &inventoryv1alpha1.Network{}},
+			handler.EnqueueRequestsFromMapFunc(referencing(mgr.GetClient(), &inventoryv1alpha1.RuntimeList{}, networkRefKey)),
+			builder.WithPredicates(networkValidityChanged)).
+		Watches(&source.Kind{Type: &inventoryv1alpha1.Kyma{}},
+			handler.EnqueueRequestsFromMapFunc(referencing(mgr.GetClient(), &inventoryv1alpha1.RuntimeList{}, kymaRefKey))).
+		WithOptions(defaultOptions(r.Options, configv1alpha1.RuntimeController)).
+		Complete(r)
+}
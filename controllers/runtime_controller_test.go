@@ -0,0 +1,96 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"testing"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	inventoryv1alpha1 "github.com/kyma-incubator/kymactl/api/v1alpha1"
+)
+
+// updateRuntimeTestStatus simulates the controller owning the object
+func updateRuntimeTestStatus(t *testing.T, r *RuntimeReconciler, obj client.Object, update func()) {
+	if err := r.Get(context.Background(), client.ObjectKeyFromObject(obj), obj); err != nil {
+		t.Fatal(err)
+	}
+	update()
+	if err := r.Status().Update(context.Background(), obj); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRuntimePhases(t *testing.T) {
+	meta := func(name string) metav1.ObjectMeta { return metav1.ObjectMeta{Namespace: "default", Name: name} }
+	cluster := &inventoryv1alpha1.Cluster{ObjectMeta: meta("cluster")}
+	network := &inventoryv1alpha1.Network{ObjectMeta: meta("network")}
+	kyma := &inventoryv1alpha1.Kyma{ObjectMeta: meta("kyma")}
+	r := &RuntimeReconciler{Client: newTestClient(t, cluster, network, kyma, &inventoryv1alpha1.Runtime{
+		ObjectMeta: meta("runtime"),
+		Spec: inventoryv1alpha1.RuntimeSpec{
+			ClusterRef: inventoryv1alpha1.ClusterReference{Name: "cluster"},
+			NetworkRef: &inventoryv1alpha1.NetworkReference{Name: "network"},
+			KymaRef:    inventoryv1alpha1.KymaReference{Name: "kyma"},
+		},
+	})}
+
+	rt := reconcileAndGet(t, r, testKey("runtime"), &inventoryv1alpha1.Runtime{})
+	if rt.Status.Phase != inventoryv1alpha1.RuntimeProvisioning || rt.Status.Message == "" {
+		t.Errorf("expected provisioning runtime with message, got %+v", rt.Status)
+	}
+
+	updateRuntimeTestStatus(t, r, cluster, func() { cluster.Status.Reachable = true })
+	updateRuntimeTestStatus(t, r, network, func() { network.Status.Valid = true })
+	updateRuntimeTestStatus(t, r, kyma, func() { kyma.Status.Status, kyma.Status.WaitingFor = "reconciling", []string{"istio"} })
+	rt = reconcileAndGet(t, r, testKey("runtime"), &inventoryv1alpha1.Runtime{})
+	if rt.Status.Phase != inventoryv1alpha1.RuntimeInstalling || !rt.Status.ClusterReady || !rt.Status.NetworkReady || rt.Status.Message != "Kyma kyma is waiting for istio" {
+		t.Errorf("expected installing runtime, got %+v", rt.Status)
+	}
+
+	updateRuntimeTestStatus(t, r, kyma, func() { kyma.Status.Status, kyma.Status.WaitingFor = "success", nil })
+	rt = reconcileAndGet(t, r, testKey("runtime"), &inventoryv1alpha1.Runtime{})
+	if rt.Status.Phase != inventoryv1alpha1.RuntimeReady || rt.Status.Message != "" {
+		t.Errorf("expected ready runtime, got %+v", rt.Status)
+	}
+
+	// the runtime deletes its Kyma before it is removed
+	if err := r.Delete(context.Background(), rt); err != nil {
+		t.Fatal(err)
+	}
+	rt = reconcileAndGet(t, r, testKey("runtime"), &inventoryv1alpha1.Runtime{})
+	if rt.Status.Phase != inventoryv1alpha1.RuntimeDeprovisioning {
+		t.Errorf("expected deprovisioning runtime, got %+v", rt.Status)
+	}
+	if err := r.Get(context.Background(), client.ObjectKeyFromObject(kyma), kyma); !apierrors.IsNotFound(err) {
+		t.Errorf("expected deleted Kyma, got %v", err)
+	}
+	if _, err := r.Reconcile(context.Background(), ctrl.Request{NamespacedName: client.ObjectKeyFromObject(rt)}); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Get(context.Background(), client.ObjectKeyFromObject(rt), rt); !apierrors.IsNotFound(err) {
+		t.Errorf("expected deleted runtime, got %v", err)
+	}
+	// the Cluster and the Network are kept
+	if err := r.Get(context.Background(), client.ObjectKeyFromObject(cluster), cluster); err != nil {
+		t.Error(err)
+	}
+}
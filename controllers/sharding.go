@@ -0,0 +1,527 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"sync"
+	"time"
+
+	coordinationv1 "k8s.io/api/coordination/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/utils/pointer"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
+	"sigs.k8s.io/controller-runtime/pkg/cache"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/cluster"
+	"sigs.k8s.io/controller-runtime/pkg/controller"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
+	"sigs.k8s.io/controller-runtime/pkg/runtime/inject"
+	"sigs.k8s.io/controller-runtime/pkg/source"
+
+	configv1alpha1 "github.com/kyma-incubator/kymactl/api/config/v1alpha1"
+	inventoryv1alpha1 "github.com/kyma-incubator/kymactl/api/v1alpha1"
+	"github.com/kyma-incubator/kymactl/pkg/sharding"
+)
+
+const (
+	// DefaultShardLeaseDuration is the time after which a replica which stopped renewing its Lease leaves the shards
+	DefaultShardLeaseDuration = 15 * time.Second
+	shardLeasePrefix          = "kymactl-shard-"
+)
+
+//+kubebuilder:rbac:groups=coordination.k8s.io,resources=leases,verbs=get;list;watch;create;update;delete
+
+// Unelected returns a manager which runs the controllers set up with it on every replica, also when leader election is enabled.
+// The sharded controllers run on every replica and reconcile only the Kymas of their shard.
+func Unelected(mgr manager.Manager) manager.Manager {
+	return unelectedManager{mgr}
+}
+
+type unelectedManager struct {
+	manager.Manager
+}
+
+func (m unelectedManager) Add(r manager.Runnable) error {
+	// the wrapper hides the dependencies of the runnable from the manager
+	if err := m.Manager.SetFields(r); err != nil {
+		return err
+	}
+	return m.Manager.Add(unelectedRunnable{r})
+}
+
+type unelectedRunnable struct {
+	manager.Runnable
+}
+
+func (unelectedRunnable) NeedLeaderElection() bool {
+	return false
+}
+
+// Elected returns a manager which runs the controllers set up with it on the leader only, with the client and the cache
+// of the cluster. The cluster is started on the leader only. With sharding the cache of the manager contains only the
+// Kymas of the shard of the replica, while the Rollout, Runtime and Cluster controllers and the shard assigner need all Kymas.
+func Elected(mgr manager.Manager, c cluster.Cluster) (manager.Manager, error) {
+	if err := mgr.Add(electedRunnable{c}); err != nil {
+		return nil, err
+	}
+	return electedManager{Manager: mgr, cluster: c}, nil
+}
+
+type electedManager struct {
+	manager.Manager
+	cluster cluster.Cluster
+}
+
+func (m electedManager) Add(r manager.Runnable) error {
+	// the wrapper hides the dependencies of the runnable from the manager, which would inject its own cache
+	if err := m.SetFields(r); err != nil {
+		return err
+	}
+	return m.Manager.Add(electedRunnable{r})
+}
+
+func (m electedManager) SetFields(i interface{}) error {
+	if err := m.cluster.SetFields(i); err != nil {
+		return err
+	}
+	if _, err := inject.InjectorInto(m.SetFields, i); err != nil {
+		return err
+	}
+	_, err := inject.LoggerInto(m.GetLogger(), i)
+	return err
+}
+
+func (m electedManager) GetCache() cache.Cache {
+	return m.cluster.GetCache()
+}
+
+func (m electedManager) GetClient() client.Client {
+	return m.cluster.GetClient()
+}
+
+func (m electedManager) GetFieldIndexer() client.FieldIndexer {
+	return m.cluster.GetFieldIndexer()
+}
+
+type electedRunnable struct {
+	manager.Runnable
+}
+
+func (electedRunnable) NeedLeaderElection() bool {
+	return true
+}
+
+// ShardMember announces the replica as shard with a Lease. The Lease is renewed until the replica stops, then it is deleted,
+// so the Kymas of the shard move to the remaining shards without waiting for the Lease to expire.
+type ShardMember struct {
+	Client client.Client
+	// Namespace of the Leases
+	Namespace string
+	// Name of the shard, unique for every replica
+	Name          string
+	LeaseDuration time.Duration
+
+	mu      sync.RWMutex
+	renewed time.Time
+}
+
+// Holds returns true while the Lease renewed last by the replica is not expired
+func (m *ShardMember) Holds(now time.Time) bool {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return !m.renewed.IsZero() && now.Before(m.renewed.Add(m.LeaseDuration))
+}
+
+func (m *ShardMember) setRenewed(renewed time.Time) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.renewed = renewed
+}
+
+// NeedLeaderElection returns false, every replica is a shard
+func (m *ShardMember) NeedLeaderElection() bool {
+	return false
+}
+
+// Start renews the Lease of the shard until the context is done
+func (m *ShardMember) Start(ctx context.Context) error {
+	log := log.FromContext(ctx).WithName("shard-member").WithValues("shard", m.Name)
+	ticker := time.NewTicker(m.LeaseDuration / 3)
+	defer ticker.Stop()
+	for {
+		renewed := time.Now()
+		if err := m.renew(ctx); err != nil {
+			log.Error(err, "unable to renew shard Lease")
+		} else {
+			m.setRenewed(renewed)
+		}
+		select {
+		case <-ctx.Done():
+			// the manager context is done, leave with a new one
+			m.setRenewed(time.Time{})
+			leaveCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			lease := &coordinationv1.Lease{ObjectMeta: metav1.ObjectMeta{Namespace: m.Namespace, Name: shardLeasePrefix + m.Name}}
+			if err := m.Client.Delete(leaveCtx, lease); client.IgnoreNotFound(err) != nil {
+				log.Error(err, "unable to delete shard Lease")
+			}
+			log.Info("Shard left")
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+func (m *ShardMember) renew(ctx context.Context) error {
+	now := metav1.NewMicroTime(time.Now())
+	var lease coordinationv1.Lease
+	err := m.Client.Get(ctx, types.NamespacedName{Namespace: m.Namespace, Name: shardLeasePrefix + m.Name}, &lease)
+	if apierrors.IsNotFound(err) {
+		lease = coordinationv1.Lease{
+			ObjectMeta: metav1.ObjectMeta{
+				Namespace: m.Namespace,
+				Name:      shardLeasePrefix + m.Name,
+				Labels:    map[string]string{inventoryv1alpha1.ShardLabel: m.Name},
+			},
+			Spec: coordinationv1.LeaseSpec{
+				HolderIdentity:       pointer.String(m.Name),
+				LeaseDurationSeconds: pointer.Int32(int32(m.LeaseDuration.Seconds())),
+				AcquireTime:          &now,
+				RenewTime:            &now,
+			},
+		}
+		return m.Client.Create(ctx, &lease)
+	}
+	if err != nil {
+		return err
+	}
+	lease.Spec.RenewTime = &now
+	lease.Spec.LeaseDurationSeconds = pointer.Int32(int32(m.LeaseDuration.Seconds()))
+	return m.Client.Update(ctx, &lease)
+}
+
+// errNotShardOwner is returned for writes to objects the replica may no longer own
+var errNotShardOwner = errors.New("not the owner of the shard")
+
+// IgnoreNotShardOwner returns nil on errors of writes fenced off by ShardFence
+func IgnoreNotShardOwner(err error) error {
+	if errors.Is(err, errNotShardOwner) {
+		return nil
+	}
+	return err
+}
+
+// ShardFence stops the writes of a replica to the objects it may no longer own. After its Lease expired the assigner
+// may have moved the Kymas to the remaining shards, and during a handoff the cache may not have seen the new shard label yet.
+type ShardFence struct {
+	Member *ShardMember
+	// Reader of the current shard labels
+	APIReader client.Reader
+}
+
+// Check returns an error if the Lease of the replica expired or the object is labeled with another shard on the API server.
+// An object which doesn't exist anymore may be written, for example to delete its children.
+// The check of a nil fence always succeeds.
+func (f *ShardFence) Check(ctx context.Context, obj client.Object) error {
+	if f == nil {
+		return nil
+	}
+	if !f.Member.Holds(time.Now()) {
+		return fmt.Errorf("%w %s: Lease expired", errNotShardOwner, f.Member.Name)
+	}
+	current := obj.DeepCopyObject().(client.Object)
+	if err := f.APIReader.Get(ctx, client.ObjectKeyFromObject(obj), current); err != nil {
+		return client.IgnoreNotFound(err)
+	}
+	if shard := current.GetLabels()[inventoryv1alpha1.ShardLabel]; shard != f.Member.Name {
+		return fmt.Errorf("%w %s: moved to shard %q", errNotShardOwner, f.Member.Name, shard)
+	}
+	return nil
+}
+
+// Client returns a client which checks the fence before its first write of the object or of its children.
+// Without fence the client is returned unchanged.
+func (f *ShardFence) Client(c client.Client, obj client.Object) client.Client {
+	if f == nil {
+		return c
+	}
+	return &fencedClient{Client: c, fence: f, obj: obj}
+}
+
+type fencedClient struct {
+	client.Client
+	fence   *ShardFence
+	obj     client.Object
+	checked bool
+}
+
+func (c *fencedClient) check(ctx context.Context) error {
+	if c.checked {
+		return nil
+	}
+	if err := c.fence.Check(ctx, c.obj); err != nil {
+		return err
+	}
+	c.checked = true
+	return nil
+}
+
+func (c *fencedClient) Create(ctx context.Context, obj client.Object, opts ...client.CreateOption) error {
+	if err := c.check(ctx); err != nil {
+		return err
+	}
+	return c.Client.Create(ctx, obj, opts...)
+}
+
+func (c *fencedClient) Update(ctx context.Context, obj client.Object, opts ...client.UpdateOption) error {
+	if err := c.check(ctx); err != nil {
+		return err
+	}
+	return c.Client.Update(ctx, obj, opts...)
+}
+
+func (c *fencedClient) Patch(ctx context.Context, obj client.Object, patch client.Patch, opts ...client.PatchOption) error {
+	if err := c.check(ctx); err != nil {
+		return err
+	}
+	return c.Client.Patch(ctx, obj, patch, opts...)
+}
+
+func (c *fencedClient) Delete(ctx context.Context, obj client.Object, opts ...client.DeleteOption) error {
+	if err := c.check(ctx); err != nil {
+		return err
+	}
+	return c.Client.Delete(ctx, obj, opts...)
+}
+
+func (c *fencedClient) DeleteAllOf(ctx context.Context, obj client.Object, opts ...client.DeleteAllOfOption) error {
+	if err := c.check(ctx); err != nil {
+		return err
+	}
+	return c.Client.DeleteAllOf(ctx, obj, opts...)
+}
+
+func (c *fencedClient) Status() client.StatusWriter {
+	return fencedStatusWriter{StatusWriter: c.Client.Status(), client: c}
+}
+
+type fencedStatusWriter struct {
+	client.StatusWriter
+	client *fencedClient
+}
+
+func (w fencedStatusWriter) Update(ctx context.Context, obj client.Object, opts ...client.UpdateOption) error {
+	if err := w.client.check(ctx); err != nil {
+		return err
+	}
+	return w.StatusWriter.Update(ctx, obj, opts...)
+}
+
+func (w fencedStatusWriter) Patch(ctx context.Context, obj client.Object, patch client.Patch, opts ...client.PatchOption) error {
+	if err := w.client.check(ctx); err != nil {
+		return err
+	}
+	return w.StatusWriter.Patch(ctx, obj, patch, opts...)
+}
+
+// liveShards returns the names of the shards with Leases which are not expired
+func liveShards(leases []coordinationv1.Lease, now time.Time) []string {
+	var shards []string
+	for _, lease := range leases {
+		name := lease.Labels[inventoryv1alpha1.ShardLabel]
+		if name == "" || lease.Spec.RenewTime == nil || lease.Spec.LeaseDurationSeconds == nil {
+			continue
+		}
+		expiry := lease.Spec.RenewTime.Add(time.Duration(*lease.Spec.LeaseDurationSeconds) * time.Second)
+		if expiry.After(now) {
+			shards = append(shards, name)
+		}
+	}
+	sort.Strings(shards)
+	return shards
+}
+
+// ShardAssigner labels every Kyma and its HelmComponents with the shard owning the hash range of the Kyma.
+// It runs on the leader and rebalances the Kymas when shards join or leave.
+type ShardAssigner struct {
+	// Client reading from the cache of the leader, which contains the Kymas and HelmComponents of all shards and
+	// indexes the components by their Kyma owner
+	client.Client
+	// Namespace of the Leases
+	Namespace     string
+	LeaseDuration time.Duration
+	// Concurrency and rate limiter of the controller. If not provided: the default configuration
+	Options controller.Options
+
+	mu        sync.RWMutex
+	ring      *sharding.Ring
+	rebalance chan event.GenericEvent
+}
+
+// Reconcile moves the Kyma to its shard. The components are moved first, so the new shard sees them with the Kyma.
+// The components are also moved when the Kyma is already in its shard: the old shard may have created one after the
+// others were moved, and the components created before the Kyma label were added are only found by their owner.
+func (a *ShardAssigner) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	log := log.FromContext(ctx)
+
+	var kyma inventoryv1alpha1.Kyma
+	if err := a.Get(ctx, req.NamespacedName, &kyma); err != nil {
+		return ctrl.Result{}, client.IgnoreNotFound(err)
+	}
+	owner := a.owner(req.String())
+	if owner == "" {
+		return ctrl.Result{}, nil
+	}
+
+	var components inventoryv1alpha1.HelmComponentList
+	if err := a.List(ctx, &components, client.InNamespace(kyma.Namespace), client.MatchingFields{componentOwnerKey: kyma.Name}); err != nil {
+		log.Error(err, "unable to list HelmComponents")
+		return ctrl.Result{}, err
+	}
+	moved := 0
+	for i := range components.Items {
+		component := &components.Items[i]
+		if component.Labels[inventoryv1alpha1.ShardLabel] == owner {
+			continue
+		}
+		if err := setShardLabel(ctx, a.Client, component, owner); err != nil {
+			log.Error(err, "unable to move HelmComponent", "component", component.Name)
+			return ctrl.Result{}, err
+		}
+		moved++
+	}
+	current := kyma.Labels[inventoryv1alpha1.ShardLabel]
+	if current == owner {
+		if moved > 0 {
+			log.Info("HelmComponents moved to the shard of their Kyma", "shard", owner, "components", moved)
+		}
+		return ctrl.Result{}, nil
+	}
+	if err := setShardLabel(ctx, a.Client, &kyma, owner); err != nil {
+		log.Error(err, "unable to move Kyma")
+		return ctrl.Result{}, err
+	}
+	log.Info("Kyma moved", "from", current, "to", owner, "components", moved)
+	return ctrl.Result{}, nil
+}
+
+func setShardLabel(ctx context.Context, c client.Client, obj client.Object, shard string) error {
+	if obj.GetLabels()[inventoryv1alpha1.ShardLabel] == shard {
+		return nil
+	}
+	patch := client.MergeFrom(obj.DeepCopyObject().(client.Object))
+	labels := obj.GetLabels()
+	if labels == nil {
+		labels = map[string]string{}
+	}
+	labels[inventoryv1alpha1.ShardLabel] = shard
+	obj.SetLabels(labels)
+	return client.IgnoreNotFound(c.Patch(ctx, obj, patch))
+}
+
+func (a *ShardAssigner) owner(key string) string {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	if a.ring == nil {
+		return ""
+	}
+	return a.ring.Owner(key)
+}
+
+// watchShards rebuilds the ring when the live shards change and enqueues all Kymas for rebalancing.
+// Expired Leases don't cause events, so the Leases are checked periodically.
+func (a *ShardAssigner) watchShards(ctx context.Context) error {
+	log := log.FromContext(ctx).WithName("shard-assigner")
+	ticker := time.NewTicker(a.LeaseDuration / 3)
+	defer ticker.Stop()
+	for {
+		var leases coordinationv1.LeaseList
+		if err := a.List(ctx, &leases, client.InNamespace(a.Namespace), client.HasLabels{inventoryv1alpha1.ShardLabel}); err != nil {
+			log.Error(err, "unable to list shard Leases")
+		} else if shards := liveShards(leases.Items, time.Now()); a.setShards(shards) {
+			log.Info("Shards changed", "shards", shards)
+			if err := a.enqueueKymas(ctx); err != nil {
+				log.Error(err, "unable to rebalance Kymas")
+			}
+		}
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// setShards rebuilds the ring and returns true if the shards changed
+func (a *ShardAssigner) setShards(shards []string) bool {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.ring != nil && reflect.DeepEqual(a.ring.Shards(), shards) {
+		return false
+	}
+	a.ring = sharding.NewRing(shards, sharding.DefaultVirtualNodes)
+	return true
+}
+
+func (a *ShardAssigner) enqueueKymas(ctx context.Context) error {
+	var kymas inventoryv1alpha1.KymaList
+	if err := a.List(ctx, &kymas); err != nil {
+		return err
+	}
+	for i := range kymas.Items {
+		select {
+		case a.rebalance <- event.GenericEvent{Object: &kymas.Items[i]}:
+		case <-ctx.Done():
+			return nil
+		}
+	}
+	return nil
+}
+
+// SetupWithManager sets up the assigner with the Manager.
+func (a *ShardAssigner) SetupWithManager(mgr ctrl.Manager) error {
+	if a.LeaseDuration == 0 {
+		a.LeaseDuration = DefaultShardLeaseDuration
+	}
+	a.rebalance = make(chan event.GenericEvent)
+	if err := mgr.Add(manager.RunnableFunc(a.watchShards)); err != nil {
+		return err
+	}
+	return ctrl.NewControllerManagedBy(mgr).
+		Named("shardassigner").
+		For(&inventoryv1alpha1.Kyma{}).
+		// a component created by the old shard during the move has to follow its Kyma
+		Watches(&source.Kind{Type: &inventoryv1alpha1.HelmComponent{}}, &handler.EnqueueRequestForOwner{
+			OwnerType:    &inventoryv1alpha1.Kyma{},
+			IsController: true,
+		}, builder.WithPredicates(predicate.LabelChangedPredicate{})).
+		Watches(&source.Channel{Source: a.rebalance}, &handler.EnqueueRequestForObject{}).
+		WithOptions(defaultOptions(a.Options, configv1alpha1.ShardAssignerController)).
+		Complete(a)
+}
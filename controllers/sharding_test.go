@@ -0,0 +1,290 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	coordinationv1 "k8s.io/api/coordination/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/utils/pointer"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/cache"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/cluster"
+	"sigs.k8s.io/controller-runtime/pkg/runtime/inject"
+
+	inventoryv1alpha1 "github.com/kyma-incubator/kymactl/api/v1alpha1"
+)
+
+func TestLiveShards(t *testing.T) {
+	now := time.Now()
+	lease := func(shard string, renewed time.Duration) coordinationv1.Lease {
+		renewTime := metav1.NewMicroTime(now.Add(-renewed))
+		return coordinationv1.Lease{
+			ObjectMeta: metav1.ObjectMeta{Name: shardLeasePrefix + shard, Labels: map[string]string{inventoryv1alpha1.ShardLabel: shard}},
+			Spec:       coordinationv1.LeaseSpec{RenewTime: &renewTime, LeaseDurationSeconds: pointer.Int32(15)},
+		}
+	}
+	shards := liveShards([]coordinationv1.Lease{lease("b", time.Second), lease("expired", time.Minute), lease("a", 10*time.Second)}, now)
+	if !reflect.DeepEqual(shards, []string{"a", "b"}) {
+		t.Errorf("expected live shards a and b, got %v", shards)
+	}
+}
+
+// shardTestComponent returns a component controlled by the Kyma in the shard
+func shardTestComponent(name, kyma, shard string) *inventoryv1alpha1.HelmComponent {
+	return &inventoryv1alpha1.HelmComponent{ObjectMeta: metav1.ObjectMeta{
+		Namespace:       "default",
+		Name:            name,
+		Labels:          map[string]string{inventoryv1alpha1.ShardLabel: shard},
+		OwnerReferences: []metav1.OwnerReference{{APIVersion: apiGVStr, Kind: "Kyma", Name: kyma, Controller: pointer.Bool(true)}},
+	}}
+}
+
+// expectComponentShards checks the shard labels of the components by name
+func expectComponentShards(t *testing.T, c client.Client, expected map[string]string) {
+	t.Helper()
+	var components inventoryv1alpha1.HelmComponentList
+	if err := c.List(context.Background(), &components); err != nil {
+		t.Fatal(err)
+	}
+	for _, hc := range components.Items {
+		if shard := hc.Labels[inventoryv1alpha1.ShardLabel]; shard != expected[hc.Name] {
+			t.Errorf("expected component %s in shard %s, got %s", hc.Name, expected[hc.Name], shard)
+		}
+	}
+}
+
+func TestShardAssignerMovesKymaWithComponents(t *testing.T) {
+	key := testKey("kyma")
+	c := newIndexedTestClient(t,
+		&inventoryv1alpha1.Kyma{ObjectMeta: metav1.ObjectMeta{Namespace: key.Namespace, Name: key.Name, Labels: map[string]string{inventoryv1alpha1.ShardLabel: "old"}}},
+		shardTestComponent("kyma-istio", "kyma", "old"),
+		shardTestComponent("kyma-serverless", "kyma", "old"),
+		shardTestComponent("other-istio", "other", "old"),
+	)
+	a := &ShardAssigner{Client: c}
+
+	// no shards yet
+	if _, err := a.Reconcile(context.Background(), ctrl.Request{NamespacedName: key}); err != nil {
+		t.Fatal(err)
+	}
+	a.setShards([]string{"shard-a", "shard-b"})
+	owner := a.owner(key.String())
+	if kyma := reconcileAndGet(t, a, key, &inventoryv1alpha1.Kyma{}); kyma.Labels[inventoryv1alpha1.ShardLabel] != owner {
+		t.Errorf("expected Kyma in shard %s, got %v", owner, kyma.Labels)
+	}
+	expectComponentShards(t, c, map[string]string{"kyma-istio": owner, "kyma-serverless": owner, "other-istio": "old"})
+}
+
+// TestShardAssignerMovesComponentsOfKymaInItsShard covers a handoff where the old shard created a component after the
+// others were moved, and a component created before the components were labeled with their Kyma
+func TestShardAssignerMovesComponentsOfKymaInItsShard(t *testing.T) {
+	key := testKey("kyma")
+	a := &ShardAssigner{}
+	a.setShards([]string{"shard-a", "shard-b"})
+	owner := a.owner(key.String())
+	a.Client = newIndexedTestClient(t,
+		&inventoryv1alpha1.Kyma{ObjectMeta: metav1.ObjectMeta{Namespace: key.Namespace, Name: key.Name, Labels: map[string]string{inventoryv1alpha1.ShardLabel: owner}}},
+		shardTestComponent("kyma-istio", "kyma", owner),
+		shardTestComponent("kyma-serverless", "kyma", "old"),
+	)
+
+	if kyma := reconcileAndGet(t, a, key, &inventoryv1alpha1.Kyma{}); kyma.Labels[inventoryv1alpha1.ShardLabel] != owner {
+		t.Errorf("expected Kyma to stay in shard %s, got %v", owner, kyma.Labels)
+	}
+	expectComponentShards(t, a.Client, map[string]string{"kyma-istio": owner, "kyma-serverless": owner})
+}
+
+func TestKymaReconcilesOnlyItsShard(t *testing.T) {
+	labels := map[string]string{inventoryv1alpha1.ShardLabel: "shard-a"}
+	r := newKymaTestReconciler(t,
+		&inventoryv1alpha1.Kyma{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "own", Labels: labels},
+			Spec:       inventoryv1alpha1.KymaSpec{Components: []inventoryv1alpha1.ComponentSpec{{Name: "istio"}}},
+		},
+		&inventoryv1alpha1.Kyma{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "foreign"}},
+		&inventoryv1alpha1.HelmComponent{
+			ObjectMeta: metav1.ObjectMeta{
+				Namespace:       "default",
+				Name:            "own-istio",
+				OwnerReferences: []metav1.OwnerReference{{APIVersion: apiGVStr, Kind: "Kyma", Name: "own", Controller: pointer.Bool(true)}},
+			},
+			Spec: inventoryv1alpha1.HelmComponentSpec{ComponentName: "istio"},
+		})
+	r.Shard = "shard-a"
+	if kyma := reconcileAndGet(t, r, testKey("foreign"), &inventoryv1alpha1.Kyma{}); kyma.Status.Status != "" {
+		t.Errorf("expected Kyma of another shard to be skipped, got %+v", kyma.Status)
+	}
+
+	reconcileAndGet(t, r, testKey("own"), &inventoryv1alpha1.Kyma{})
+	var component inventoryv1alpha1.HelmComponent
+	if err := r.Get(context.Background(), client.ObjectKey{Namespace: "default", Name: "own-istio"}, &component); err != nil {
+		t.Fatal(err)
+	}
+	if component.Labels[inventoryv1alpha1.ShardLabel] != "shard-a" || component.Labels[inventoryv1alpha1.KymaLabel] != "own" {
+		t.Errorf("expected component labeled with the Kyma and its shard, got %v", component.Labels)
+	}
+}
+
+// countingReader counts the reads of the fence
+type countingReader struct {
+	client.Reader
+	gets int
+}
+
+func (r *countingReader) Get(ctx context.Context, key client.ObjectKey, obj client.Object) error {
+	r.gets++
+	return r.Reader.Get(ctx, key, obj)
+}
+
+func TestShardFence(t *testing.T) {
+	kyma := func(name, shard string) *inventoryv1alpha1.Kyma {
+		return &inventoryv1alpha1.Kyma{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: name, Labels: map[string]string{inventoryv1alpha1.ShardLabel: shard}}}
+	}
+	ctx := context.Background()
+	reader := &countingReader{Reader: newTestClient(t, kyma("own", "shard-a"), kyma("moved", "shard-b"))}
+	member := &ShardMember{Name: "shard-a", LeaseDuration: time.Minute}
+	fence := &ShardFence{Member: member, APIReader: reader}
+
+	if err := fence.Check(ctx, kyma("own", "shard-a")); !errors.Is(err, errNotShardOwner) {
+		t.Errorf("expected writes fenced off before the Lease is renewed, got %v", err)
+	}
+	member.setRenewed(time.Now().Add(-2 * time.Minute))
+	if err := fence.Check(ctx, kyma("own", "shard-a")); !errors.Is(err, errNotShardOwner) {
+		t.Errorf("expected writes fenced off after the Lease expired, got %v", err)
+	}
+	member.setRenewed(time.Now())
+	if err := fence.Check(ctx, kyma("own", "shard-a")); err != nil {
+		t.Errorf("expected writes to the own Kyma, got %v", err)
+	}
+	// the cache of the replica didn't see the move yet
+	if err := fence.Check(ctx, kyma("moved", "shard-a")); !errors.Is(err, errNotShardOwner) {
+		t.Errorf("expected writes to the moved Kyma fenced off, got %v", err)
+	}
+	if err := fence.Check(ctx, kyma("deleted", "shard-a")); err != nil {
+		t.Errorf("expected writes for the deleted Kyma, got %v", err)
+	}
+	if err := (*ShardFence)(nil).Check(ctx, kyma("moved", "shard-a")); err != nil {
+		t.Errorf("expected no checks without fence, got %v", err)
+	}
+
+	c := newTestClient(t, kyma("moved", "shard-a"), kyma("own", "shard-a"))
+	moved := kyma("moved", "shard-a")
+	if err := fence.Client(c, moved).Status().Patch(ctx, moved, client.MergeFrom(moved.DeepCopy())); !errors.Is(err, errNotShardOwner) {
+		t.Errorf("expected status patch of the moved Kyma fenced off, got %v", err)
+	}
+	reader.gets = 0
+	own := kyma("own", "shard-a")
+	writer := fence.Client(c, own)
+	for i := 0; i < 3; i++ {
+		if err := writer.Patch(ctx, own, client.MergeFrom(own.DeepCopy())); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if reader.gets != 1 {
+		t.Errorf("expected the fence checked once, got %d checks", reader.gets)
+	}
+}
+
+func TestKymaKeepsComponentsOfMovedKyma(t *testing.T) {
+	component := &inventoryv1alpha1.HelmComponent{ObjectMeta: metav1.ObjectMeta{
+		Namespace:       "default",
+		Name:            "moved-istio",
+		Labels:          map[string]string{inventoryv1alpha1.ShardLabel: "shard-a"},
+		OwnerReferences: []metav1.OwnerReference{{APIVersion: apiGVStr, Kind: "Kyma", Name: "moved", Controller: pointer.Bool(true)}},
+	}}
+	// the cache of shard-a doesn't contain the Kyma moved to shard-b, its component is moved next
+	r := newKymaTestReconciler(t, component)
+	member := &ShardMember{Name: "shard-a", LeaseDuration: time.Minute}
+	member.setRenewed(time.Now())
+	r.Shard = "shard-a"
+	r.Fence = &ShardFence{Member: member, APIReader: newTestClient(t, &inventoryv1alpha1.Kyma{ObjectMeta: metav1.ObjectMeta{
+		Namespace: "default", Name: "moved", Labels: map[string]string{inventoryv1alpha1.ShardLabel: "shard-b"},
+	}})}
+
+	if _, err := r.Reconcile(context.Background(), ctrl.Request{NamespacedName: testKey("moved")}); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Get(context.Background(), client.ObjectKeyFromObject(component), component); err != nil {
+		t.Errorf("expected the component of the moved Kyma kept, got %v", err)
+	}
+
+	// the component of a deleted Kyma is removed
+	r.Fence.APIReader = newTestClient(t)
+	if _, err := r.Reconcile(context.Background(), ctrl.Request{NamespacedName: testKey("moved")}); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Get(context.Background(), client.ObjectKeyFromObject(component), component); !apierrors.IsNotFound(err) {
+		t.Errorf("expected the component of the deleted Kyma removed, got %v", err)
+	}
+}
+
+// cacheRecorder records the injected cache
+type cacheRecorder struct {
+	cache cache.Cache
+}
+
+func (r *cacheRecorder) InjectCache(c cache.Cache) error {
+	r.cache = c
+	return nil
+}
+
+// injectingHandler passes the injection on to its inner object, as the controllers do for their watches
+type injectingHandler struct {
+	inner *cacheRecorder
+}
+
+func (h injectingHandler) InjectFunc(f inject.Func) error {
+	return f(h.inner)
+}
+
+func TestElectedUsesClusterCache(t *testing.T) {
+	config, _ := startRemoteCluster(t)
+	c := newTestClient(t)
+	mgr, err := ctrl.NewManager(config, ctrl.Options{Scheme: c.Scheme(), MetricsBindAddress: "0", HealthProbeBindAddress: "0"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	leaderCluster, err := cluster.New(config, func(o *cluster.Options) { o.Scheme = c.Scheme() })
+	if err != nil {
+		t.Fatal(err)
+	}
+	elected, err := Elected(mgr, leaderCluster)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if elected.GetCache() != leaderCluster.GetCache() || elected.GetClient() != leaderCluster.GetClient() || elected.GetCache() == mgr.GetCache() {
+		t.Error("expected the cache and the client of the leader cluster")
+	}
+	handler := injectingHandler{inner: &cacheRecorder{}}
+	if err := elected.SetFields(handler); err != nil {
+		t.Fatal(err)
+	}
+	if handler.inner.cache != leaderCluster.GetCache() {
+		t.Error("expected the cache of the leader cluster injected into the watches")
+	}
+	if !(electedRunnable{}).NeedLeaderElection() {
+		t.Error("expected the runnables to run on the leader")
+	}
+}
@@ -17,16 +17,28 @@ limitations under the License.
 package controllers
 
 import (
+	"context"
+	"path/filepath"
 	"testing"
+	"time"
 
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
+	"k8s.io/apimachinery/pkg/runtime"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
 	"k8s.io/client-go/rest"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/cache"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/envtest"
 	"sigs.k8s.io/controller-runtime/pkg/envtest/printer"
 	logf "sigs.k8s.io/controller-runtime/pkg/log"
 	"sigs.k8s.io/controller-runtime/pkg/log/zap"
+
+	inventoryv1alpha1 "github.com/kyma-incubator/kymactl/api/v1alpha1"
+	"github.com/kyma-incubator/kymactl/manifests"
+	"github.com/kyma-incubator/kymactl/pkg/helm"
+	"github.com/kyma-incubator/kymactl/pkg/inventory"
 	//+kubebuilder:scaffold:imports
 )
 
@@ -36,8 +48,13 @@ import (
 var cfg *rest.Config
 var k8sClient client.Client
 var testEnv *envtest.Environment
+var ctx context.Context
+var cancel context.CancelFunc
+
+// suiteSimulationStep shortens the simulated installation, a component is installed after 5 steps per character of its name
+const suiteSimulationStep = 10 * time.Millisecond
 
-func NoTestAPIs(t *testing.T) {
+func TestAPIs(t *testing.T) {
 	RegisterFailHandler(Fail)
 
 	RunSpecsWithDefaultAndCustomReporters(t,
@@ -48,29 +65,99 @@ func NoTestAPIs(t *testing.T) {
 var _ = BeforeSuite(func() {
 	logf.SetLogger(zap.New(zap.WriteTo(GinkgoWriter), zap.UseDevMode(true)))
 
-	By("bootstrapping test environment")
-	// testEnv = &envtest.Environment{
-	// 	CRDDirectoryPaths:     []string{filepath.Join("..", "config", "crd", "bases")},
-	// 	ErrorIfCRDPathMissing: true,
-	// }
-
-	// cfg, err := testEnv.Start()
-	// Expect(err).NotTo(HaveOccurred())
-	// Expect(cfg).NotTo(BeNil())
-
-	// err = inventoryv1alpha1.AddToScheme(scheme.Scheme)
-	// Expect(err).NotTo(HaveOccurred())
-
-	// //+kubebuilder:scaffold:scheme
-
-	// k8sClient, err = client.New(cfg, client.Options{Scheme: scheme.Scheme})
-	// Expect(err).NotTo(HaveOccurred())
-	// Expect(k8sClient).NotTo(BeNil())
+	ctx, cancel = context.WithCancel(context.TODO())
 
+	By("bootstrapping test environment")
+	testEnv = &envtest.Environment{
+		CRDDirectoryPaths:     []string{filepath.Join("..", "config", "crd", "bases")},
+		ErrorIfCRDPathMissing: true,
+	}
+
+	var err error
+	cfg, err = testEnv.Start()
+	Expect(err).NotTo(HaveOccurred())
+	Expect(cfg).NotTo(BeNil())
+
+	scheme := runtime.NewScheme()
+	err = clientgoscheme.AddToScheme(scheme)
+	Expect(err).NotTo(HaveOccurred())
+
+	err = inventoryv1alpha1.AddToScheme(scheme)
+	Expect(err).NotTo(HaveOccurred())
+
+	//+kubebuilder:scaffold:scheme
+
+	k8sClient, err = client.New(cfg, client.Options{Scheme: scheme})
+	Expect(err).NotTo(HaveOccurred())
+	Expect(k8sClient).NotTo(BeNil())
+
+	By("starting the controllers")
+	charts, err := helm.NewCatalog(manifests.FS, manifests.ChartsDir)
+	Expect(err).NotTo(HaveOccurred())
+	components, err := helm.LoadComponents(manifests.FS, manifests.ComponentsFile)
+	Expect(err).NotTo(HaveOccurred())
+	regions, err := inventory.LoadRegions(manifests.FS, manifests.RegionsFile)
+	Expect(err).NotTo(HaveOccurred())
+
+	mgr, err := ctrl.NewManager(cfg, ctrl.Options{
+		Scheme:             scheme,
+		LeaderElection:     false,
+		MetricsBindAddress: "0",
+		NewCache:           cache.BuilderWithOptions(CacheOptions()),
+	})
+	Expect(err).NotTo(HaveOccurred())
+
+	err = SetupReferenceIndexes(ctx, mgr.GetFieldIndexer())
+	Expect(err).NotTo(HaveOccurred())
+
+	remoteClusters := &RemoteClusters{}
+	err = (&ClusterReconciler{
+		Client:         mgr.GetClient(),
+		Scheme:         mgr.GetScheme(),
+		RemoteClusters: remoteClusters,
+		Regions:        regions,
+		APIReader:      mgr.GetAPIReader(),
+	}).SetupWithManager(mgr)
+	Expect(err).NotTo(HaveOccurred())
+
+	err = (&HelmComponentReconciler{
+		Client:         mgr.GetClient(),
+		Scheme:         mgr.GetScheme(),
+		Catalog:        charts,
+		RemoteClusters: remoteClusters,
+		APIReader:      mgr.GetAPIReader(),
+		SimulationStep: suiteSimulationStep,
+	}).SetupWithManager(mgr)
+	Expect(err).NotTo(HaveOccurred())
+
+	err = (&NetworkReconciler{
+		Client: mgr.GetClient(),
+		Scheme: mgr.GetScheme(),
+	}).SetupWithManager(mgr)
+	Expect(err).NotTo(HaveOccurred())
+
+	err = (&KymaReconciler{
+		Client: mgr.GetClient(),
+		Scheme: mgr.GetScheme(),
+	}).SetupWithManager(mgr)
+	Expect(err).NotTo(HaveOccurred())
+
+	//+kubebuilder:scaffold:builder
+
+	go func() {
+		defer GinkgoRecover()
+		err := mgr.Start(ctx)
+		Expect(err).NotTo(HaveOccurred())
+	}()
+
+	By("creating the component catalog")
+	catalog := NewComponentCatalog(inventoryv1alpha1.DefaultComponentCatalogName, components, charts)
+	Expect(k8sClient.Create(ctx, catalog)).To(Succeed())
 }, 60)
 
 var _ = AfterSuite(func() {
+	cancel()
 	By("tearing down the test environment")
-	// err := testEnv.Stop()
-	// Expect(err).NotTo(HaveOccurred())
+	err := testEnv.Stop()
+	Expect(err).NotTo(HaveOccurred())
 })
@@ -17,23 +17,38 @@ limitations under the License.
 package main
 
 import (
+	"bytes"
+	"context"
 	"flag"
+	"fmt"
 	"os"
+	"path/filepath"
 	"time"
 
 	// Import all Kubernetes client auth plugins (e.g. Azure, GCP, OIDC, etc.)
 	// to ensure that exec-entrypoint and run can make use of them.
 	_ "k8s.io/client-go/plugin/pkg/client/auth"
 
+	coordinationv1 "k8s.io/api/coordination/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/selection"
 	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
 	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
 	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/cache"
+	"sigs.k8s.io/controller-runtime/pkg/cluster"
+	"sigs.k8s.io/controller-runtime/pkg/controller"
 	"sigs.k8s.io/controller-runtime/pkg/healthz"
 	"sigs.k8s.io/controller-runtime/pkg/log/zap"
 
+	configv1alpha1 "github.com/kyma-incubator/kymactl/api/config/v1alpha1"
 	inventoryv1alpha1 "github.com/kyma-incubator/kymactl/api/v1alpha1"
 	"github.com/kyma-incubator/kymactl/controllers"
+	"github.com/kyma-incubator/kymactl/manifests"
+	"github.com/kyma-incubator/kymactl/pkg/helm"
+	"github.com/kyma-incubator/kymactl/pkg/inventory"
 	//+kubebuilder:scaffold:imports
 )
 
@@ -46,6 +61,7 @@ func init() {
 	utilruntime.Must(clientgoscheme.AddToScheme(scheme))
 
 	utilruntime.Must(inventoryv1alpha1.AddToScheme(scheme))
+	utilruntime.Must(configv1alpha1.AddToScheme(scheme))
 	//+kubebuilder:scaffold:scheme
 }
 
@@ -54,12 +70,36 @@ func main() {
 	var enableLeaderElection bool
 	var probeAddr string
 	var syncPeriod time.Duration
+	var enableWebhooks bool
+	var regionsFile string
+	var renderKeyFile string
+	var reuseSecrets bool
+	var enableSharding bool
+	var shardName, shardNamespace string
+	var shardLeaseDuration time.Duration
+	var configFile string
+	var tuning configFlags
+	flag.StringVar(&configFile, "config", "",
+		"The controller manager configuration file (ProjectConfig). Flags set on the command line override the values of the file.")
 	flag.DurationVar(&syncPeriod, "sync-period", time.Duration(10)*time.Minute, "Time based reconciliation period.")
 	flag.StringVar(&metricsAddr, "metrics-bind-address", ":8080", "The address the metric endpoint binds to.")
 	flag.StringVar(&probeAddr, "health-probe-bind-address", ":8081", "The address the probe endpoint binds to.")
 	flag.BoolVar(&enableLeaderElection, "leader-elect", false,
 		"Enable leader election for controller manager. "+
 			"Enabling this will ensure there is only one active controller manager.")
+	flag.StringVar(&regionsFile, "regions-file", "", "File with the providers and regions of the runtimes. If not provided the embedded region catalog is used.")
+	flag.StringVar(&renderKeyFile, "render-key-file", "",
+		"File with the key of the deterministic rendering. The generated passwords and certificates of the charts are derived "+
+			"from the key, the Kyma and the component. If not provided the charts generate new values on every installation.")
+	flag.BoolVar(&reuseSecrets, "reuse-secrets", false, "Reuse the generated values of the Secrets existing in the target clusters.")
+	flag.BoolVar(&enableWebhooks, "enable-webhooks", true, "Enable admission webhooks. Webhooks require serving certificates.")
+	flag.BoolVar(&enableSharding, "sharding", false,
+		"Shard the Kymas across the replicas. Every replica reconciles the Kymas and HelmComponents of its shard, "+
+			"the leader assigns the Kymas to the shards.")
+	flag.StringVar(&shardName, "shard-name", os.Getenv("POD_NAME"), "Name of the shard, unique for every replica. If not provided: POD_NAME")
+	flag.StringVar(&shardNamespace, "shard-namespace", os.Getenv("POD_NAMESPACE"), "Namespace of the shard Leases. If not provided: POD_NAMESPACE")
+	flag.DurationVar(&shardLeaseDuration, "shard-lease-duration", controllers.DefaultShardLeaseDuration, "Time after which a replica which doesn't renew its shard Lease leaves the shards.")
+	tuning.bind(flag.CommandLine)
 	opts := zap.Options{
 		Development: true,
 	}
@@ -68,56 +108,251 @@ func main() {
 
 	ctrl.SetLogger(zap.New(zap.UseFlagOptions(&opts)))
 
+	options := ctrl.Options{
+		Scheme:           scheme,
+		LeaderElectionID: "0f60298a.kyma-project.io",
+	}
+	var projectConfig configv1alpha1.ProjectConfig
+	if configFile != "" {
+		var err error
+		if options, err = options.AndFrom(ctrl.ConfigFile().AtPath(configFile).OfKind(&projectConfig)); err != nil {
+			setupLog.Error(err, "unable to load the config file")
+			os.Exit(1)
+		}
+	}
+	// the flags set on the command line override the config file, the defaults of the flags apply if neither sets a value
+	setFlags := map[string]bool{}
+	flag.Visit(func(f *flag.Flag) { setFlags[f.Name] = true })
+	if setFlags["metrics-bind-address"] || options.MetricsBindAddress == "" {
+		options.MetricsBindAddress = metricsAddr
+	}
+	if setFlags["health-probe-bind-address"] || options.HealthProbeBindAddress == "" {
+		options.HealthProbeBindAddress = probeAddr
+	}
+	if setFlags["leader-elect"] {
+		options.LeaderElection = enableLeaderElection
+	}
+	if setFlags["sync-period"] || options.SyncPeriod == nil {
+		options.SyncPeriod = &syncPeriod
+	}
+	if options.Port == 0 {
+		options.Port = 9443
+	}
+	if err := tuning.apply(&projectConfig, setFlags); err != nil {
+		setupLog.Error(err, "invalid flags")
+		os.Exit(1)
+	}
+	projectConfig.Default()
+	if err := projectConfig.Validate(); err != nil {
+		setupLog.Error(err, "invalid configuration")
+		os.Exit(1)
+	}
+
 	config := ctrl.GetConfigOrDie()
+	config.QPS = projectConfig.Client.QPS
+	config.Burst = projectConfig.Client.Burst
 
-	// Performance customizations
-	config.QPS = 150
-	config.Burst = 150
-
-	setupLog.Info("Configuration", "QPS", config.QPS, "Burst", config.Burst, "syncPeriod", syncPeriod)
-
-	mgr, err := ctrl.NewManager(config, ctrl.Options{
-		Scheme:                 scheme,
-		MetricsBindAddress:     metricsAddr,
-		Port:                   9443,
-		HealthProbeBindAddress: probeAddr,
-		LeaderElection:         enableLeaderElection,
-		LeaderElectionID:       "0f60298a.kyma-project.io",
-		SyncPeriod:             &syncPeriod,
-	})
+	setupLog.Info("Configuration", "QPS", config.QPS, "Burst", config.Burst, "syncPeriod", *options.SyncPeriod,
+		"metricsBindAddress", options.MetricsBindAddress, "leaderElection", options.LeaderElection)
+	resync := controllers.Resync{Period: projectConfig.Resync.Period.Duration, Jitter: *projectConfig.Resync.Jitter}
+	setupLog.Info("Resync", "period", resync.Period, "jitter", resync.Jitter, "startupWindow", projectConfig.Resync.StartupWindow.Duration)
+	controllerOptions := map[string]controller.Options{}
+	for _, name := range configv1alpha1.Controllers {
+		c := projectConfig.Controllers[name]
+		controllerOptions[name] = controllers.ControllerOptions(c)
+		if c.RateLimiter == nil {
+			setupLog.Info("Controller configuration", "controller", name, "maxConcurrentReconciles", c.MaxConcurrentReconciles, "rateLimiter", "default")
+			continue
+		}
+		setupLog.Info("Controller configuration", "controller", name, "maxConcurrentReconciles", c.MaxConcurrentReconciles,
+			"baseDelay", c.RateLimiter.BaseDelay.Duration, "maxDelay", c.RateLimiter.MaxDelay.Duration,
+			"qps", c.RateLimiter.QPS, "burst", c.RateLimiter.Burst)
+	}
+
+	catalog, err := helm.NewCatalog(manifests.FS, manifests.ChartsDir)
 	if err != nil {
-		setupLog.Error(err, "unable to start manager")
+		setupLog.Error(err, "unable to index charts")
+		os.Exit(1)
+	}
+	components, err := helm.LoadComponents(manifests.FS, manifests.ComponentsFile)
+	if err != nil {
+		setupLog.Error(err, "unable to load components")
+		os.Exit(1)
+	}
+	if err := catalog.Validate(components); err != nil {
+		setupLog.Error(err, "chart catalog is not valid")
+		os.Exit(1)
+	}
+	setupLog.Info("Chart catalog", "charts", len(catalog.Names()))
+
+	regions, err := loadRegions(regionsFile)
+	if err != nil {
+		setupLog.Error(err, "unable to load region catalog")
 		os.Exit(1)
 	}
+	setupLog.Info("Region catalog", "providers", len(regions.Providers))
 
+	renderKey, err := loadRenderKey(renderKeyFile)
+	if err != nil {
+		setupLog.Error(err, "unable to load the render key")
+		os.Exit(1)
+	}
+
+	cacheOptions := controllers.CacheOptions()
+	if enableSharding {
+		if shardName == "" || shardNamespace == "" {
+			setupLog.Error(nil, "sharding requires --shard-name and --shard-namespace")
+			os.Exit(1)
+		}
+		cacheOptions.SelectorsByObject = shardSelectors(shardName, shardNamespace)
+		setupLog.Info("Sharding", "shard", shardName, "leaseNamespace", shardNamespace, "leaseDuration", shardLeaseDuration)
+	} else {
+		shardName = ""
+	}
+	options.NewCache = cache.BuilderWithOptions(cacheOptions)
+
+	mgr, err := ctrl.NewManager(config, options)
+	if err != nil {
+		setupLog.Error(err, "unable to start manager")
+		os.Exit(1)
+	}
+	if err = controllers.SetupReferenceIndexes(context.Background(), mgr.GetFieldIndexer()); err != nil {
+		setupLog.Error(err, "unable to index references")
+		os.Exit(1)
+	}
+	// the sharded controllers run on every replica, the controllers on the leader get their own cache with all Kymas
+	shardedMgr, leaderMgr := mgr, mgr
+	var shardMember *controllers.ShardMember
+	var shardFence *controllers.ShardFence
+	if enableSharding {
+		shardedMgr = controllers.Unelected(mgr)
+		leaderCacheOptions := controllers.CacheOptions()
+		leaderCacheOptions.SelectorsByObject = leaseSelectors(shardNamespace)
+		leaderCluster, err := cluster.New(config, func(o *cluster.Options) {
+			o.Scheme = scheme
+			o.SyncPeriod = options.SyncPeriod
+			o.NewCache = cache.BuilderWithOptions(leaderCacheOptions)
+		})
+		if err != nil {
+			setupLog.Error(err, "unable to create the leader cache")
+			os.Exit(1)
+		}
+		if leaderMgr, err = controllers.Elected(mgr, leaderCluster); err != nil {
+			setupLog.Error(err, "unable to add the leader cache")
+			os.Exit(1)
+		}
+		if err = controllers.SetupReferenceIndexes(context.Background(), leaderMgr.GetFieldIndexer()); err != nil {
+			setupLog.Error(err, "unable to index references")
+			os.Exit(1)
+		}
+		shardMember = &controllers.ShardMember{
+			Client:        mgr.GetClient(),
+			Namespace:     shardNamespace,
+			Name:          shardName,
+			LeaseDuration: shardLeaseDuration,
+		}
+		shardFence = &controllers.ShardFence{Member: shardMember, APIReader: mgr.GetAPIReader()}
+	}
+	remoteClusters := &controllers.RemoteClusters{}
 	if err = (&controllers.ClusterReconciler{
-		Client: mgr.GetClient(),
-		Scheme: mgr.GetScheme(),
-	}).SetupWithManager(mgr); err != nil {
+		Client:         leaderMgr.GetClient(),
+		Scheme:         mgr.GetScheme(),
+		RemoteClusters: remoteClusters,
+		Regions:        regions,
+		APIReader:      mgr.GetAPIReader(),
+		Options:        controllerOptions[configv1alpha1.ClusterController],
+	}).SetupWithManager(leaderMgr); err != nil {
 		setupLog.Error(err, "unable to create controller", "controller", "Cluster")
 		os.Exit(1)
 	}
 	if err = (&controllers.HelmComponentReconciler{
-		Client: mgr.GetClient(),
-		Scheme: mgr.GetScheme(),
-	}).SetupWithManager(mgr); err != nil {
+		Client:         mgr.GetClient(),
+		Scheme:         mgr.GetScheme(),
+		Catalog:        catalog,
+		RemoteClusters: remoteClusters,
+		APIReader:      mgr.GetAPIReader(),
+		Options:        controllerOptions[configv1alpha1.HelmComponentController],
+		Resync:         resync,
+		StartupWindow:  projectConfig.Resync.StartupWindow.Duration,
+		RenderKey:      renderKey,
+		ReuseSecrets:   reuseSecrets,
+		Fence:          shardFence,
+	}).SetupWithManager(shardedMgr); err != nil {
 		setupLog.Error(err, "unable to create controller", "controller", "HelmComponent")
 		os.Exit(1)
 	}
 	if err = (&controllers.NetworkReconciler{
-		Client: mgr.GetClient(),
-		Scheme: mgr.GetScheme(),
+		Client:  mgr.GetClient(),
+		Scheme:  mgr.GetScheme(),
+		Options: controllerOptions[configv1alpha1.NetworkController],
 	}).SetupWithManager(mgr); err != nil {
 		setupLog.Error(err, "unable to create controller", "controller", "Network")
 		os.Exit(1)
 	}
 	if err = (&controllers.KymaReconciler{
-		Client: mgr.GetClient(),
-		Scheme: mgr.GetScheme(),
-	}).SetupWithManager(mgr); err != nil {
+		Client:        mgr.GetClient(),
+		Scheme:        mgr.GetScheme(),
+		Shard:         shardName,
+		Fence:         shardFence,
+		Options:       controllerOptions[configv1alpha1.KymaController],
+		Resync:        resync,
+		StartupWindow: projectConfig.Resync.StartupWindow.Duration,
+	}).SetupWithManager(shardedMgr); err != nil {
 		setupLog.Error(err, "unable to create controller", "controller", "Kyma")
 		os.Exit(1)
 	}
+	if enableSharding {
+		if err = mgr.Add(shardMember); err != nil {
+			setupLog.Error(err, "unable to create shard member")
+			os.Exit(1)
+		}
+		if err = (&controllers.ShardAssigner{
+			Client:        leaderMgr.GetClient(),
+			Namespace:     shardNamespace,
+			LeaseDuration: shardLeaseDuration,
+			Options:       controllerOptions[configv1alpha1.ShardAssignerController],
+		}).SetupWithManager(leaderMgr); err != nil {
+			setupLog.Error(err, "unable to create shard assigner")
+			os.Exit(1)
+		}
+	}
+	if err = (&controllers.RolloutReconciler{
+		Client:  leaderMgr.GetClient(),
+		Scheme:  mgr.GetScheme(),
+		Options: controllerOptions[configv1alpha1.RolloutController],
+	}).SetupWithManager(leaderMgr); err != nil {
+		setupLog.Error(err, "unable to create controller", "controller", "Rollout")
+		os.Exit(1)
+	}
+	if err = (&controllers.RuntimeReconciler{
+		Client:  leaderMgr.GetClient(),
+		Scheme:  mgr.GetScheme(),
+		Options: controllerOptions[configv1alpha1.RuntimeController],
+	}).SetupWithManager(leaderMgr); err != nil {
+		setupLog.Error(err, "unable to create controller", "controller", "Runtime")
+		os.Exit(1)
+	}
+	if err = (&controllers.ComponentCatalogSeeder{
+		Client:     mgr.GetClient(),
+		Components: components,
+		Charts:     catalog,
+	}).SetupWithManager(mgr); err != nil {
+		setupLog.Error(err, "unable to create component catalog seeder")
+		os.Exit(1)
+	}
+	if enableWebhooks {
+		if err = (&inventoryv1alpha1.KymaWebhook{
+			Client:   mgr.GetClient(),
+			Fallback: controllers.NewComponentCatalog(inventoryv1alpha1.DefaultComponentCatalogName, components, catalog),
+		}).SetupWebhookWithManager(mgr); err != nil {
+			setupLog.Error(err, "unable to create webhook", "webhook", "Kyma")
+			os.Exit(1)
+		}
+		if err = (&inventoryv1alpha1.HelmComponentWebhook{}).SetupWebhookWithManager(mgr); err != nil {
+			setupLog.Error(err, "unable to create webhook", "webhook", "HelmComponent")
+			os.Exit(1)
+		}
+	}
 	//+kubebuilder:scaffold:builder
 
 	if err := mgr.AddHealthzCheck("healthz", healthz.Ping); err != nil {
@@ -135,3 +370,46 @@ func main() {
 		os.Exit(1)
 	}
 }
+
+// shardSelectors restrict the cache to the Kymas and the HelmComponents of the shard and to the shard Leases.
+// The Rollout, Runtime and Cluster controllers on the leader need all Kymas, they use the cache of the leader.
+func shardSelectors(shard, leaseNamespace string) cache.SelectorsByObject {
+	selectors := leaseSelectors(leaseNamespace)
+	selectors[&inventoryv1alpha1.Kyma{}] = cache.ObjectSelector{Label: labels.SelectorFromSet(labels.Set{inventoryv1alpha1.ShardLabel: shard})}
+	selectors[&inventoryv1alpha1.HelmComponent{}] = cache.ObjectSelector{Label: labels.SelectorFromSet(labels.Set{inventoryv1alpha1.ShardLabel: shard})}
+	return selectors
+}
+
+// leaseSelectors restrict the cache to the shard Leases
+func leaseSelectors(leaseNamespace string) cache.SelectorsByObject {
+	shardLease, _ := labels.NewRequirement(inventoryv1alpha1.ShardLabel, selection.Exists, nil)
+	return cache.SelectorsByObject{
+		&coordinationv1.Lease{}: {
+			Label: labels.NewSelector().Add(*shardLease),
+			Field: fields.OneTermEqualSelector("metadata.namespace", leaseNamespace),
+		},
+	}
+}
+
+// loadRegions loads the region catalog from the file or the embedded one
+func loadRegions(file string) (*inventory.RegionCatalog, error) {
+	if file == "" {
+		return inventory.LoadRegions(manifests.FS, manifests.RegionsFile)
+	}
+	return inventory.LoadRegions(os.DirFS(filepath.Dir(file)), filepath.Base(file))
+}
+
+// loadRenderKey reads the key of the deterministic rendering, nil if the file is not provided
+func loadRenderKey(file string) ([]byte, error) {
+	if file == "" {
+		return nil, nil
+	}
+	key, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	if len(bytes.TrimSpace(key)) == 0 {
+		return nil, fmt.Errorf("render key file %s is empty", file)
+	}
+	return key, nil
+}
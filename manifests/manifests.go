@@ -4,13 +4,16 @@ import (
 	"embed"
 )
 
-// FS embeds the manifests.
-// TODO: _helpers.tpl files are not taken without specific templates. See: https://github.com/golang/go/issues/43854 resolved in go 1.18.1
+const (
+	// ChartsDir is the folder with the charts of all components.
+	ChartsDir = "charts"
+	// ComponentsFile lists the components which can be installed.
+	ComponentsFile = "components.yaml"
+	// RegionsFile lists the providers and regions of the runtimes.
+	RegionsFile = "regions.yaml"
+)
+
+// FS embeds the manifests. The all: prefix is required to include helm _helpers.tpl files.
 //
-//go:embed charts/* crds components.yaml
-//go:embed charts/*/*/_*
-//go:embed charts/*/*/*/_*
-//go:embed charts/*/*/*/*/_*
-//go:embed charts/*/*/*/*/*/_*
-//go:embed charts/*/*/*/*/*/*/_*
+//go:embed all:charts crds components.yaml regions.yaml
 var FS embed.FS
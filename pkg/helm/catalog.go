@@ -0,0 +1,243 @@
+package helm
+
+import (
+	"fmt"
+	"io/fs"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/Masterminds/semver/v3"
+	"helm.sh/helm/v3/pkg/chart"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+	"sigs.k8s.io/yaml"
+)
+
+const (
+	chartFileName     = "Chart.yaml"
+	subchartsDirName  = "charts"
+	profileFilePrefix = "profile-"
+	profileFileSuffix = ".yaml"
+)
+
+// ChartInfo describes a single chart version indexed by the Catalog.
+type ChartInfo struct {
+	// Name of the component the chart is addressed by (name of the chart folder)
+	Name string
+	// Name declared in Chart.yaml, it can differ from the folder name
+	ChartName string
+	// Chart version from Chart.yaml
+	Version string
+	// Names of the charts bundled in the charts folder
+	Subcharts []string
+	// Names of the available value profiles (profile-<name>.yaml files)
+	Profiles []string
+
+	files fs.FS
+	dir   string
+
+	once  sync.Once
+	chart *chart.Chart
+	err   error
+}
+
+// Load loads the chart files. The chart is loaded only once and shared by all callers.
+func (c *ChartInfo) Load() (*chart.Chart, error) {
+	c.once.Do(func() {
+		c.chart, c.err = loadChart(c.files, c.dir, c.Name)
+	})
+	return c.chart, c.err
+}
+
+// HasProfile returns true if the chart provides values for the given profile.
+func (c *ChartInfo) HasProfile(profile string) bool {
+	for _, p := range c.Profiles {
+		if p == profile {
+			return true
+		}
+	}
+	return false
+}
+
+// Values returns the values of the given profile.
+func (c *ChartInfo) Values(profile string) (string, error) {
+	if !c.HasProfile(profile) {
+		return "", fmt.Errorf("chart %s:%s has no profile %q", c.Name, c.Version, profile)
+	}
+	by, err := fs.ReadFile(c.files, path.Join(c.dir, builtinProfileToFilename(profile)))
+	if err != nil {
+		return "", err
+	}
+	return string(by), nil
+}
+
+// Renderer returns a started renderer for the chart which installs into the given namespace.
+func (c *ChartInfo) Renderer(namespace string) (*Renderer, error) {
+	chrt, err := c.Load()
+	if err != nil {
+		return nil, err
+	}
+	return &Renderer{
+		namespace:     namespace,
+		componentName: c.Name,
+		chart:         chrt,
+		started:       true,
+		files:         c.files,
+		dir:           c.dir,
+	}, nil
+}
+
+// Catalog indexes the charts available for installation by name and version.
+// Charts are expected either directly in the root folder (<root>/<name>/Chart.yaml)
+// or in version folders (<root>/<name>/<version>/Chart.yaml).
+// The catalog is not safe for concurrent modification, all charts should be added during startup.
+type Catalog struct {
+	// charts by name, sorted from the newest to the oldest version
+	charts map[string][]*ChartInfo
+}
+
+// NewCatalog creates a catalog with all charts found in the root folder of files.
+func NewCatalog(files fs.FS, root string) (*Catalog, error) {
+	c := &Catalog{charts: map[string][]*ChartInfo{}}
+	if err := c.Add(files, root); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// Add indexes all charts found in the root folder of files.
+func (c *Catalog) Add(files fs.FS, root string) error {
+	entries, err := fs.ReadDir(files, root)
+	if err != nil {
+		return fmt.Errorf("list charts: %v", err)
+	}
+	for _, e := range entries {
+		if !e.IsDir() {
+			continue
+		}
+		dir := path.Join(root, e.Name())
+		if exists(files, path.Join(dir, chartFileName)) {
+			if err := c.index(files, e.Name(), dir); err != nil {
+				return err
+			}
+			continue
+		}
+		versions, err := fs.ReadDir(files, dir)
+		if err != nil {
+			return fmt.Errorf("list chart versions of %s: %v", e.Name(), err)
+		}
+		for _, v := range versions {
+			if v.IsDir() && exists(files, path.Join(dir, v.Name(), chartFileName)) {
+				if err := c.index(files, e.Name(), path.Join(dir, v.Name())); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
+
+func (c *Catalog) index(files fs.FS, name, dir string) error {
+	by, err := fs.ReadFile(files, path.Join(dir, chartFileName))
+	if err != nil {
+		return fmt.Errorf("read chart %s: %v", name, err)
+	}
+	var metadata chart.Metadata
+	if err := yaml.Unmarshal(by, &metadata); err != nil {
+		return fmt.Errorf("parse %s of chart %s: %v", chartFileName, name, err)
+	}
+	if _, err := semver.NewVersion(metadata.Version); err != nil {
+		return fmt.Errorf("chart %s has invalid version %q: %v", name, metadata.Version, err)
+	}
+	info := &ChartInfo{
+		Name:      name,
+		ChartName: metadata.Name,
+		Version:   metadata.Version,
+		files:     files,
+		dir:       dir,
+	}
+	entries, err := fs.ReadDir(files, dir)
+	if err != nil {
+		return fmt.Errorf("list files of chart %s: %v", name, err)
+	}
+	for _, e := range entries {
+		if !e.IsDir() && strings.HasPrefix(e.Name(), profileFilePrefix) && strings.HasSuffix(e.Name(), profileFileSuffix) {
+			info.Profiles = append(info.Profiles, strings.TrimSuffix(strings.TrimPrefix(e.Name(), profileFilePrefix), profileFileSuffix))
+		}
+	}
+	if subcharts, err := fs.ReadDir(files, path.Join(dir, subchartsDirName)); err == nil {
+		for _, e := range subcharts {
+			info.Subcharts = append(info.Subcharts, strings.TrimSuffix(e.Name(), ".tgz"))
+		}
+	}
+
+	for _, existing := range c.charts[name] {
+		if existing.Version == info.Version {
+			return fmt.Errorf("chart %s:%s is defined more than once", name, info.Version)
+		}
+	}
+	versions := append(c.charts[name], info)
+	sort.Slice(versions, func(i, j int) bool {
+		return semver.MustParse(versions[i].Version).GreaterThan(semver.MustParse(versions[j].Version))
+	})
+	c.charts[name] = versions
+	return nil
+}
+
+// Get returns the chart with the given name and version. If version is empty the newest version is returned.
+func (c *Catalog) Get(name, version string) (*ChartInfo, error) {
+	versions, ok := c.charts[name]
+	if !ok {
+		return nil, fmt.Errorf("chart %q not found in catalog", name)
+	}
+	if version == "" {
+		return versions[0], nil
+	}
+	for _, v := range versions {
+		if v.Version == version {
+			return v, nil
+		}
+	}
+	return nil, fmt.Errorf("chart %q has no version %q", name, version)
+}
+
+// Names returns the sorted names of all charts in the catalog.
+func (c *Catalog) Names() []string {
+	names := make([]string, 0, len(c.charts))
+	for name := range c.charts {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Versions returns all versions of the chart, from the newest to the oldest.
+func (c *Catalog) Versions(name string) []string {
+	var versions []string
+	for _, v := range c.charts[name] {
+		versions = append(versions, v.Version)
+	}
+	return versions
+}
+
+// Validate checks that every component of the list resolves to a chart that can be loaded.
+func (c *Catalog) Validate(components *ComponentList) error {
+	var errs []error
+	for _, component := range components.All() {
+		info, err := c.Get(component.Name, "")
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		if _, err := info.Load(); err != nil {
+			errs = append(errs, fmt.Errorf("chart %s:%s cannot be loaded: %v", info.Name, info.Version, err))
+		}
+	}
+	return utilerrors.NewAggregate(errs)
+}
+
+func exists(files fs.FS, name string) bool {
+	_, err := fs.Stat(files, name)
+	return err == nil
+}
@@ -0,0 +1,130 @@
+package helm
+
+import (
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"github.com/kyma-incubator/kymactl/manifests"
+)
+
+func chartFiles(name, version string) fstest.MapFS {
+	return fstest.MapFS{
+		"Chart.yaml":                 {Data: []byte("apiVersion: v2\nname: " + name + "\nversion: " + version + "\n")},
+		"values.yaml":                {Data: []byte("replicas: 1\n")},
+		"profile-evaluation.yaml":    {Data: []byte("replicas: 1\n")},
+		"templates/_helpers.tpl":     {Data: []byte(`{{- define "name" -}}` + name + `{{- end -}}`)},
+		"templates/config.yaml":      {Data: []byte("kind: ConfigMap\nmetadata:\n  name: {{ template \"name\" . }}\n")},
+		"charts/sub/Chart.yaml":      {Data: []byte("apiVersion: v2\nname: sub\nversion: 0.1.0\n")},
+		"charts/sub/templates/.keep": {Data: []byte{}},
+	}
+}
+
+func withPrefix(prefix string, files fstest.MapFS) fstest.MapFS {
+	res := fstest.MapFS{}
+	for k, v := range files {
+		res[prefix+"/"+k] = v
+	}
+	return res
+}
+
+func merge(all ...fstest.MapFS) fstest.MapFS {
+	res := fstest.MapFS{}
+	for _, files := range all {
+		for k, v := range files {
+			res[k] = v
+		}
+	}
+	return res
+}
+
+func TestCatalogIndexesCharts(t *testing.T) {
+	files := merge(
+		withPrefix("charts/foo", chartFiles("foo", "1.0.0")),
+		withPrefix("charts/bar/1.2.0", chartFiles("bar", "1.2.0")),
+		withPrefix("charts/bar/1.10.0", chartFiles("bar", "1.10.0")),
+	)
+	catalog, err := NewCatalog(files, "charts")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if names := strings.Join(catalog.Names(), ","); names != "bar,foo" {
+		t.Errorf("unexpected charts: %s", names)
+	}
+	if versions := strings.Join(catalog.Versions("bar"), ","); versions != "1.10.0,1.2.0" {
+		t.Errorf("unexpected versions: %s", versions)
+	}
+
+	latest, err := catalog.Get("bar", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if latest.Version != "1.10.0" {
+		t.Errorf("expected latest version 1.10.0, got %s", latest.Version)
+	}
+	if _, err := catalog.Get("bar", "2.0.0"); err == nil {
+		t.Error("expected error for unknown version")
+	}
+	if _, err := catalog.Get("baz", ""); err == nil {
+		t.Error("expected error for unknown chart")
+	}
+
+	foo, err := catalog.Get("foo", "1.0.0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(foo.Subcharts, ",") != "sub" || strings.Join(foo.Profiles, ",") != "evaluation" {
+		t.Errorf("unexpected subcharts %v or profiles %v", foo.Subcharts, foo.Profiles)
+	}
+	if _, err := foo.Values("production"); err == nil {
+		t.Error("expected error for missing profile")
+	}
+	renderer, err := foo.Renderer("default")
+	if err != nil {
+		t.Fatal(err)
+	}
+	manifest, err := renderer.RenderManifest("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(manifest, "name: foo") {
+		t.Errorf("helper template not rendered: %s", manifest)
+	}
+}
+
+func TestCatalogRejectsDuplicateVersions(t *testing.T) {
+	files := merge(
+		withPrefix("charts/foo/a", chartFiles("foo", "1.0.0")),
+		withPrefix("charts/foo/b", chartFiles("foo", "1.0.0")),
+	)
+	if _, err := NewCatalog(files, "charts"); err == nil {
+		t.Error("expected error for duplicate chart version")
+	}
+}
+
+func TestCatalogValidate(t *testing.T) {
+	catalog, err := NewCatalog(withPrefix("charts/foo", chartFiles("foo", "1.0.0")), "charts")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := catalog.Validate(&ComponentList{Components: []Component{{Name: "foo"}}}); err != nil {
+		t.Error(err)
+	}
+	if err := catalog.Validate(&ComponentList{Components: []Component{{Name: "foo"}, {Name: "missing"}}}); err == nil {
+		t.Error("expected error for missing chart")
+	}
+}
+
+func TestEmbeddedComponentsResolveToCharts(t *testing.T) {
+	catalog, err := NewCatalog(manifests.FS, manifests.ChartsDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	components, err := LoadComponents(manifests.FS, manifests.ComponentsFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := catalog.Validate(components); err != nil {
+		t.Error(err)
+	}
+}
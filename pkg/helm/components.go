@@ -0,0 +1,55 @@
+package helm
+
+import (
+	"fmt"
+	"io/fs"
+
+	"gopkg.in/yaml.v2"
+)
+
+// DefaultComponentNamespace is used for components which do not declare a namespace in components.yaml.
+const DefaultComponentNamespace = "kyma-system"
+
+// Component is a single entry of the components.yaml file.
+type Component struct {
+	Name      string `yaml:"name"`
+	Namespace string `yaml:"namespace,omitempty"`
+}
+
+// ComponentList is the content of the components.yaml file.
+type ComponentList struct {
+	DefaultNamespace string      `yaml:"defaultNamespace,omitempty"`
+	Prerequisites    []Component `yaml:"prerequisites,omitempty"`
+	Components       []Component `yaml:"components,omitempty"`
+}
+
+// LoadComponents reads and parses the component list from the given file.
+func LoadComponents(files fs.FS, path string) (*ComponentList, error) {
+	by, err := fs.ReadFile(files, path)
+	if err != nil {
+		return nil, fmt.Errorf("read component list: %v", err)
+	}
+	list := &ComponentList{}
+	if err := yaml.Unmarshal(by, list); err != nil {
+		return nil, fmt.Errorf("parse component list %s: %v", path, err)
+	}
+	return list, nil
+}
+
+// All returns prerequisites followed by the regular components.
+func (l *ComponentList) All() []Component {
+	all := make([]Component, 0, len(l.Prerequisites)+len(l.Components))
+	all = append(all, l.Prerequisites...)
+	return append(all, l.Components...)
+}
+
+// NamespaceOf returns the namespace the component is installed into, falling back to the default namespace.
+func (l *ComponentList) NamespaceOf(c Component) string {
+	if c.Namespace != "" {
+		return c.Namespace
+	}
+	if l.DefaultNamespace != "" {
+		return l.DefaultNamespace
+	}
+	return DefaultComponentNamespace
+}
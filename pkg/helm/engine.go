@@ -0,0 +1,333 @@
+package helm
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+	"text/template"
+
+	"github.com/BurntSushi/toml"
+	"github.com/Masterminds/sprig/v3"
+	"github.com/gobwas/glob"
+	"helm.sh/helm/v3/pkg/chart"
+	"helm.sh/helm/v3/pkg/chartutil"
+	"sigs.k8s.io/yaml"
+)
+
+// engine renders the templates of a chart like the helm engine, with some template functions replaced. The helm
+// engine (https://github.com/helm/helm/blob/v3.9.4/pkg/engine/engine.go) doesn't allow to replace its functions, so
+// the seeded and the Secret lookup renderings execute the templates here. Other renderings use the helm engine.
+type engine struct {
+	// funcs replace the template functions of sprig and helm with the same name
+	funcs template.FuncMap
+	// executing is called with the name of each template before it is executed
+	executing func(name string)
+}
+
+// renderable is a template with the values scoped to its chart
+type renderable struct {
+	tpl      string
+	vals     chartutil.Values
+	basePath string
+}
+
+// recursionMaxNums limits the nesting of include as in helm
+const recursionMaxNums = 1000
+
+// render renders the templates of the chart and its dependencies with the values.
+// The values are scoped to the charts as in helm, see https://pkg.go.dev/helm.sh/helm/v3/pkg/engine#Engine.Render
+func (e engine) render(chrt *chart.Chart, values chartutil.Values) (map[string]string, error) {
+	templates := map[string]renderable{}
+	scopeTemplates(chrt, templates, values)
+	return e.renderWithReferences(templates, templates)
+}
+
+// renderWithReferences renders the templates, which can include the reference templates
+func (e engine) renderWithReferences(tpls, referenceTpls map[string]renderable) (rendered map[string]string, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("rendering template failed: %v", r)
+		}
+	}()
+	t := template.New("gotpl").Option("missingkey=zero")
+	t.Funcs(e.funcMap(t, referenceTpls))
+
+	// the templates of the subcharts are parsed first, so the parent charts can redefine their named templates
+	keys := sortTemplates(tpls)
+	for _, filename := range keys {
+		if _, err := t.New(filename).Parse(tpls[filename].tpl); err != nil {
+			return nil, fmt.Errorf("parse error in (%s): %w", filename, err)
+		}
+	}
+	for _, filename := range sortTemplates(referenceTpls) {
+		if t.Lookup(filename) == nil {
+			if _, err := t.New(filename).Parse(referenceTpls[filename].tpl); err != nil {
+				return nil, fmt.Errorf("parse error in (%s): %w", filename, err)
+			}
+		}
+	}
+
+	rendered = make(map[string]string, len(keys))
+	for _, filename := range keys {
+		// partials are only included by other templates
+		if strings.HasPrefix(path.Base(filename), "_") {
+			continue
+		}
+		if e.executing != nil {
+			e.executing(filename)
+		}
+		vals := tpls[filename].vals
+		vals["Template"] = chartutil.Values{"Name": filename, "BasePath": tpls[filename].basePath}
+		var buf strings.Builder
+		if err := t.ExecuteTemplate(&buf, filename, vals); err != nil {
+			return nil, fmt.Errorf("execution error in (%s): %w", filename, err)
+		}
+		// missingkey=zero still renders "<no value>" for the values of unknown types
+		rendered[filename] = strings.ReplaceAll(buf.String(), "<no value>", "")
+	}
+	return rendered, nil
+}
+
+// funcMap returns the template functions of helm bound to the template, with the functions of the engine replacing them
+func (e engine) funcMap(t *template.Template, referenceTpls map[string]renderable) template.FuncMap {
+	f := sprig.TxtFuncMap()
+	delete(f, "env")
+	delete(f, "expandenv")
+
+	includedNames := map[string]int{}
+	helm := template.FuncMap{
+		"toToml":        toTOML,
+		"toYaml":        toYAML,
+		"fromYaml":      fromYAML,
+		"fromYamlArray": fromYAMLArray,
+		"toJson":        toJSON,
+		"fromJson":      fromJSON,
+		"fromJsonArray": fromJSONArray,
+		"include": func(name string, data interface{}) (string, error) {
+			if includedNames[name] > recursionMaxNums {
+				return "", fmt.Errorf("rendering template has a nested reference name: %s: unable to execute template", name)
+			}
+			includedNames[name]++
+			defer func() { includedNames[name]-- }()
+			var buf strings.Builder
+			err := t.ExecuteTemplate(&buf, name, data)
+			return buf.String(), err
+		},
+		"tpl": func(tpl string, vals chartutil.Values) (string, error) {
+			basePath, err := vals.PathValue("Template.BasePath")
+			if err != nil {
+				return "", fmt.Errorf("cannot retrieve Template.Basepath from values inside tpl function: %s: %w", tpl, err)
+			}
+			name, err := vals.PathValue("Template.Name")
+			if err != nil {
+				return "", fmt.Errorf("cannot retrieve Template.Name from values inside tpl function: %s: %w", tpl, err)
+			}
+			templates := map[string]renderable{
+				name.(string): {tpl: tpl, vals: vals, basePath: basePath.(string)},
+			}
+			result, err := e.renderWithReferences(templates, referenceTpls)
+			if err != nil {
+				return "", fmt.Errorf("error during tpl function execution for %q: %w", tpl, err)
+			}
+			return result[name.(string)], nil
+		},
+		"required": func(warn string, val interface{}) (interface{}, error) {
+			if s, ok := val.(string); val == nil || ok && s == "" {
+				return val, errors.New(warn)
+			}
+			return val, nil
+		},
+		"fail": func(msg string) (string, error) {
+			return "", errors.New(msg)
+		},
+		// lookup finds nothing without a cluster, as in helm template
+		"lookup": func(string, string, string, string) (map[string]interface{}, error) {
+			return map[string]interface{}{}, nil
+		},
+	}
+	for name, fn := range helm {
+		f[name] = fn
+	}
+	for name, fn := range e.funcs {
+		f[name] = fn
+	}
+	return f
+}
+
+// sortTemplates orders the templates by the depth of their path, then by name, descending
+func sortTemplates(tpls map[string]renderable) []string {
+	keys := make([]string, 0, len(tpls))
+	for key := range tpls {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		ci, cj := strings.Count(keys[i], "/"), strings.Count(keys[j], "/")
+		if ci != cj {
+			return ci > cj
+		}
+		return keys[i] > keys[j]
+	})
+	return keys
+}
+
+// scopeTemplates adds the templates of the chart and its dependencies with the values of their chart and returns
+// the values of the chart
+func scopeTemplates(c *chart.Chart, templates map[string]renderable, vals chartutil.Values) map[string]interface{} {
+	subCharts := map[string]interface{}{}
+	next := map[string]interface{}{
+		"Chart": struct {
+			chart.Metadata
+			IsRoot bool
+		}{*c.Metadata, c.IsRoot()},
+		"Files":        newFiles(c.Files),
+		"Release":      vals["Release"],
+		"Capabilities": vals["Capabilities"],
+		"Values":       make(chartutil.Values),
+		"Subcharts":    subCharts,
+	}
+	if c.IsRoot() {
+		next["Values"] = vals["Values"]
+	} else if vs, err := vals.Table("Values." + c.Name()); err == nil {
+		next["Values"] = vs
+	}
+	for _, child := range c.Dependencies() {
+		subCharts[child.Name()] = scopeTemplates(child, templates, next)
+	}
+
+	parent := c.ChartFullPath()
+	for _, t := range c.Templates {
+		// library charts only provide partials
+		if strings.EqualFold(c.Metadata.Type, "library") && !strings.HasPrefix(path.Base(t.Name), "_") {
+			continue
+		}
+		templates[path.Join(parent, t.Name)] = renderable{
+			tpl:      string(t.Data),
+			vals:     next,
+			basePath: path.Join(parent, "templates"),
+		}
+	}
+	return next
+}
+
+func toYAML(v interface{}) string {
+	data, err := yaml.Marshal(v)
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSuffix(string(data), "\n")
+}
+
+func fromYAML(str string) map[string]interface{} {
+	m := map[string]interface{}{}
+	if err := yaml.Unmarshal([]byte(str), &m); err != nil {
+		m["Error"] = err.Error()
+	}
+	return m
+}
+
+func fromYAMLArray(str string) []interface{} {
+	a := []interface{}{}
+	if err := yaml.Unmarshal([]byte(str), &a); err != nil {
+		a = []interface{}{err.Error()}
+	}
+	return a
+}
+
+func toTOML(v interface{}) string {
+	b := bytes.NewBuffer(nil)
+	if err := toml.NewEncoder(b).Encode(v); err != nil {
+		return err.Error()
+	}
+	return b.String()
+}
+
+func toJSON(v interface{}) string {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return ""
+	}
+	return string(data)
+}
+
+func fromJSON(str string) map[string]interface{} {
+	m := map[string]interface{}{}
+	if err := json.Unmarshal([]byte(str), &m); err != nil {
+		m["Error"] = err.Error()
+	}
+	return m
+}
+
+func fromJSONArray(str string) []interface{} {
+	a := []interface{}{}
+	if err := json.Unmarshal([]byte(str), &a); err != nil {
+		a = []interface{}{err.Error()}
+	}
+	return a
+}
+
+// files are the files of a chart as .Files of the templates, with the methods of the helm files
+type files map[string][]byte
+
+func newFiles(from []*chart.File) files {
+	f := files{}
+	for _, file := range from {
+		f[file.Name] = file.Data
+	}
+	return f
+}
+
+// GetBytes returns the content of the file, or nothing if it doesn't exist
+func (f files) GetBytes(name string) []byte {
+	return f[name]
+}
+
+// Get returns the content of the file as a string
+func (f files) Get(name string) string {
+	return string(f[name])
+}
+
+// Glob returns the files matching the pattern
+func (f files) Glob(pattern string) files {
+	g, err := glob.Compile(pattern, '/')
+	if err != nil {
+		g, _ = glob.Compile("**")
+	}
+	matched := files{}
+	for name, content := range f {
+		if g.Match(name) {
+			matched[name] = content
+		}
+	}
+	return matched
+}
+
+// AsConfig returns the files as the data of a ConfigMap, keyed by their base names
+func (f files) AsConfig() string {
+	m := map[string]string{}
+	for name, content := range f {
+		m[path.Base(name)] = string(content)
+	}
+	return toYAML(m)
+}
+
+// AsSecrets returns the base64 encoded files as the data of a Secret, keyed by their base names
+func (f files) AsSecrets() string {
+	m := map[string]string{}
+	for name, content := range f {
+		m[path.Base(name)] = base64.StdEncoding.EncodeToString(content)
+	}
+	return toYAML(m)
+}
+
+// Lines returns the lines of the file
+func (f files) Lines(name string) []string {
+	if f[name] == nil {
+		return []string{}
+	}
+	return strings.Split(string(f[name]), "\n")
+}
@@ -0,0 +1,436 @@
+package helm
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net"
+	"strconv"
+	"text/template"
+	"time"
+)
+
+const (
+	alphaChars   = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ"
+	numericChars = "0123456789"
+	// asciiChars are the printable characters as in sprig randAscii
+	asciiChars = " !\"#$%&'()*+,-./0123456789:;<=>?@ABCDEFGHIJKLMNOPQRSTUVWXYZ[\\]^_`abcdefghijklmnopqrstuvwxyz{|}~"
+)
+
+// ComponentSeed derives the seed of the deterministic rendering of a component of a Kyma from the key
+func ComponentSeed(key []byte, namespace, kyma, component string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(namespace + "/" + kyma + "/" + component))
+	return mac.Sum(nil)
+}
+
+// randomSource provides the random bytes of the template functions of a rendering. With a seed every call of a
+// function reads its own stream, derived from the seed, the executed template and the number of the call in the
+// template, so adding a template to a chart doesn't change the values of the other templates.
+// Without a seed the bytes are read from crypto/rand.
+type randomSource struct {
+	seed []byte
+	// template is the name of the executed template
+	template string
+	calls    map[string]int
+	// generated are the values returned by the random string functions, see reuseSecrets
+	generated []string
+}
+
+func newRandomSource(seed []byte) *randomSource {
+	return &randomSource{seed: seed, calls: map[string]int{}}
+}
+
+// executing is called by the engine before a template is executed
+func (s *randomSource) executing(name string) {
+	s.template = name
+}
+
+// reader returns the random bytes for the next function call
+func (s *randomSource) reader() io.Reader {
+	if s.seed == nil {
+		return rand.Reader
+	}
+	s.calls[s.template]++
+	mac := hmac.New(sha256.New, s.seed)
+	mac.Write([]byte(s.template + "\x00" + strconv.Itoa(s.calls[s.template])))
+	return &stream{key: mac.Sum(nil)}
+}
+
+// stream is an endless HMAC-SHA256 key stream in counter mode
+type stream struct {
+	key     []byte
+	counter uint64
+	block   []byte
+}
+
+func (s *stream) Read(p []byte) (int, error) {
+	n := 0
+	for n < len(p) {
+		if len(s.block) == 0 {
+			mac := hmac.New(sha256.New, s.key)
+			var counter [8]byte
+			binary.BigEndian.PutUint64(counter[:], s.counter)
+			mac.Write(counter[:])
+			s.block = mac.Sum(nil)
+			s.counter++
+		}
+		c := copy(p[n:], s.block)
+		s.block = s.block[c:]
+		n += c
+	}
+	return n, nil
+}
+
+// randomFuncs replaces the sprig functions which generate random strings. The values are recorded in generated
+func (s *randomSource) randomFuncs() template.FuncMap {
+	generate := func(chars string) func(int) (string, error) {
+		return func(count int) (string, error) {
+			value, err := randomString(s.reader(), count, chars)
+			s.record(value)
+			return value, err
+		}
+	}
+	return template.FuncMap{
+		"randAlphaNum": generate(alphaChars + numericChars),
+		"randAlpha":    generate(alphaChars),
+		"randNumeric":  generate(numericChars),
+		"randAscii":    generate(asciiChars),
+		"randBytes": func(count int) (string, error) {
+			buf := make([]byte, count)
+			if _, err := io.ReadFull(s.reader(), buf); err != nil {
+				return "", err
+			}
+			value := base64.StdEncoding.EncodeToString(buf)
+			s.record(value)
+			return value, nil
+		},
+		"uuidv4": func() (string, error) {
+			var b [16]byte
+			if _, err := io.ReadFull(s.reader(), b[:]); err != nil {
+				return "", err
+			}
+			b[6] = b[6]&0x0f | 0x40
+			b[8] = b[8]&0x3f | 0x80
+			value := fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:])
+			s.record(value)
+			return value, nil
+		},
+		"randInt": func(min, max int) (int, error) {
+			if max <= min {
+				return 0, fmt.Errorf("randInt: max %d must be greater than min %d", max, min)
+			}
+			n, err := uniform(s.reader(), uint64(max-min))
+			return min + int(n), err
+		},
+		"shuffle": func(str string) (string, error) {
+			r := s.reader()
+			runes := []rune(str)
+			for i := len(runes) - 1; i > 0; i-- {
+				j, err := uniform(r, uint64(i+1))
+				if err != nil {
+					return "", err
+				}
+				runes[i], runes[j] = runes[j], runes[i]
+			}
+			return string(runes), nil
+		},
+	}
+}
+
+func (s *randomSource) record(value string) {
+	if value != "" {
+		s.generated = append(s.generated, value)
+	}
+}
+
+// cryptoFuncs replaces the sprig functions which generate keys and certificates and the functions depending on the
+// current time. now is the current time of the rendering and the start of the validity of the certificates.
+// The generated certificates have Ed25519 keys instead of the RSA keys of sprig, genPrivateKey only generates
+// Ed25519 keys. Functions whose output can't be derived from the seed fail.
+// The private keys are derived from the seed: anyone knowing the seed, or the render key it is derived from, can
+// derive them.
+func (s *randomSource) cryptoFuncs(now time.Time) template.FuncMap {
+	unsupported := func(name string) func(...interface{}) (string, error) {
+		return func(...interface{}) (string, error) {
+			return "", fmt.Errorf("%s is not supported by the deterministic rendering", name)
+		}
+	}
+	generateKey := func() (crypto.PrivateKey, error) {
+		return generatePrivateKey(s.reader(), "ed25519")
+	}
+	withKey := func(key string) func() (crypto.PrivateKey, error) {
+		return func() (crypto.PrivateKey, error) {
+			return parsePrivateKey(key)
+		}
+	}
+	return template.FuncMap{
+		"now": func() time.Time { return now },
+		"genPrivateKey": func(typ string) (string, error) {
+			key, err := generatePrivateKey(s.reader(), typ)
+			if err != nil {
+				return "", err
+			}
+			block, err := pemBlockForKey(key)
+			if err != nil {
+				return "", err
+			}
+			return string(pem.EncodeToMemory(block)), nil
+		},
+		"buildCustomCert": buildCustomCertificate,
+		"genCA": func(cn string, daysValid int) (certificate, error) {
+			return s.generateCertificate(now, cn, nil, nil, daysValid, true, nil, generateKey)
+		},
+		"genCAWithKey": func(cn string, daysValid int, key string) (certificate, error) {
+			return s.generateCertificate(now, cn, nil, nil, daysValid, true, nil, withKey(key))
+		},
+		"genSelfSignedCert": func(cn string, ips, alternateDNS []interface{}, daysValid int) (certificate, error) {
+			return s.generateCertificate(now, cn, ips, alternateDNS, daysValid, false, nil, generateKey)
+		},
+		"genSelfSignedCertWithKey": func(cn string, ips, alternateDNS []interface{}, daysValid int, key string) (certificate, error) {
+			return s.generateCertificate(now, cn, ips, alternateDNS, daysValid, false, nil, withKey(key))
+		},
+		"genSignedCert": func(cn string, ips, alternateDNS []interface{}, daysValid int, ca certificate) (certificate, error) {
+			return s.generateCertificate(now, cn, ips, alternateDNS, daysValid, false, &ca, generateKey)
+		},
+		"genSignedCertWithKey": func(cn string, ips, alternateDNS []interface{}, daysValid int, ca certificate, key string) (certificate, error) {
+			return s.generateCertificate(now, cn, ips, alternateDNS, daysValid, false, &ca, withKey(key))
+		},
+		// bcrypt salts, AES encryption uses a random IV
+		"bcrypt":     unsupported("bcrypt"),
+		"htpasswd":   unsupported("htpasswd"),
+		"encryptAES": unsupported("encryptAES"),
+	}
+}
+
+// randomString returns count characters chosen uniformly from chars
+func randomString(r io.Reader, count int, chars string) (string, error) {
+	if count <= 0 {
+		return "", nil
+	}
+	// bytes from limit on would prefer the first characters
+	limit := 256 - 256%len(chars)
+	result := make([]byte, 0, count)
+	buf := make([]byte, count)
+	for len(result) < count {
+		if _, err := io.ReadFull(r, buf); err != nil {
+			return "", err
+		}
+		for _, b := range buf {
+			if int(b) < limit && len(result) < count {
+				result = append(result, chars[int(b)%len(chars)])
+			}
+		}
+	}
+	return string(result), nil
+}
+
+// uniform returns a number from [0, n) without modulo bias
+func uniform(r io.Reader, n uint64) (uint64, error) {
+	limit := ^uint64(0) - ^uint64(0)%n
+	var buf [8]byte
+	for {
+		if _, err := io.ReadFull(r, buf[:]); err != nil {
+			return 0, err
+		}
+		if v := binary.BigEndian.Uint64(buf[:]); v < limit {
+			return v % n, nil
+		}
+	}
+}
+
+// certificate has the fields of the certificates of sprig, Cert and Key are PEM encoded
+type certificate struct {
+	Cert string
+	Key  string
+}
+
+// generateCertificate creates a certificate with the key returned by key like sprig, but with the serial number
+// read from the random source and valid from now. Without ca the certificate is self-signed.
+// Signatures with ECDSA keys are randomized, RSA and Ed25519 signatures are deterministic.
+func (s *randomSource) generateCertificate(now time.Time, cn string, ips, alternateDNS []interface{}, daysValid int,
+	isCA bool, ca *certificate, key func() (crypto.PrivateKey, error)) (certificate, error) {
+	ipAddresses, err := netIPs(ips)
+	if err != nil {
+		return certificate{}, err
+	}
+	dnsNames, err := strs(alternateDNS)
+	if err != nil {
+		return certificate{}, err
+	}
+	var serial [16]byte
+	if _, err := io.ReadFull(s.reader(), serial[:]); err != nil {
+		return certificate{}, err
+	}
+	template := &x509.Certificate{
+		SerialNumber: new(big.Int).SetBytes(serial[:]),
+		Subject: pkix.Name{
+			CommonName: cn,
+		},
+		IPAddresses: ipAddresses,
+		DNSNames:    dnsNames,
+		NotBefore:   now,
+		NotAfter:    now.Add(time.Hour * 24 * time.Duration(daysValid)),
+		KeyUsage:    x509.KeyUsageKeyEncipherment | x509.KeyUsageDigitalSignature,
+		ExtKeyUsage: []x509.ExtKeyUsage{
+			x509.ExtKeyUsageServerAuth,
+			x509.ExtKeyUsageClientAuth,
+		},
+		BasicConstraintsValid: true,
+	}
+	if isCA {
+		template.KeyUsage |= x509.KeyUsageCertSign
+		template.IsCA = true
+	}
+	priv, err := key()
+	if err != nil {
+		return certificate{}, err
+	}
+	parent, signer := template, priv
+	if ca != nil {
+		if parent, signer, err = parseCertificate(*ca); err != nil {
+			return certificate{}, err
+		}
+	}
+	pub, ok := priv.(crypto.Signer)
+	if !ok {
+		return certificate{}, fmt.Errorf("unsupported key type %T", priv)
+	}
+	der, err := x509.CreateCertificate(s.reader(), template, parent, pub.Public(), signer)
+	if err != nil {
+		return certificate{}, fmt.Errorf("error creating certificate: %w", err)
+	}
+	block, err := pemBlockForKey(priv)
+	if err != nil {
+		return certificate{}, err
+	}
+	return certificate{
+		Cert: string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})),
+		Key:  string(pem.EncodeToMemory(block)),
+	}, nil
+}
+
+// buildCustomCertificate returns the base64 encoded PEM certificate and key as certificate like sprig buildCustomCert
+func buildCustomCertificate(b64cert, b64key string) (certificate, error) {
+	cert, err := base64.StdEncoding.DecodeString(b64cert)
+	if err != nil {
+		return certificate{}, errors.New("unable to decode base64 certificate")
+	}
+	key, err := base64.StdEncoding.DecodeString(b64key)
+	if err != nil {
+		return certificate{}, errors.New("unable to decode base64 private key")
+	}
+	crt := certificate{Cert: string(cert), Key: string(key)}
+	if _, _, err := parseCertificate(crt); err != nil {
+		return certificate{}, err
+	}
+	return crt, nil
+}
+
+func parseCertificate(crt certificate) (*x509.Certificate, crypto.PrivateKey, error) {
+	block, _ := pem.Decode([]byte(crt.Cert))
+	if block == nil {
+		return nil, nil, errors.New("unable to decode certificate")
+	}
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		return nil, nil, fmt.Errorf("error parsing certificate: %w", err)
+	}
+	key, err := parsePrivateKey(crt.Key)
+	if err != nil {
+		return nil, nil, err
+	}
+	return cert, key, nil
+}
+
+// parsePrivateKey parses the PEM encoded PKCS#1, PKCS#8 or EC private key
+func parsePrivateKey(key string) (crypto.PrivateKey, error) {
+	block, _ := pem.Decode([]byte(key))
+	if block == nil {
+		return nil, errors.New("no PEM data in private key")
+	}
+	switch block.Type {
+	case "PRIVATE KEY":
+		return x509.ParsePKCS8PrivateKey(block.Bytes)
+	case "RSA PRIVATE KEY":
+		return x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "EC PRIVATE KEY":
+		return x509.ParseECPrivateKey(block.Bytes)
+	default:
+		return nil, fmt.Errorf("unsupported private key type %s", block.Type)
+	}
+}
+
+// pemBlockForKey encodes the key in the formats of sprig
+func pemBlockForKey(key crypto.PrivateKey) (*pem.Block, error) {
+	switch k := key.(type) {
+	case *rsa.PrivateKey:
+		return &pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(k)}, nil
+	case *ecdsa.PrivateKey:
+		b, err := x509.MarshalECPrivateKey(k)
+		if err != nil {
+			return nil, err
+		}
+		return &pem.Block{Type: "EC PRIVATE KEY", Bytes: b}, nil
+	default:
+		b, err := x509.MarshalPKCS8PrivateKey(k)
+		if err != nil {
+			return nil, err
+		}
+		return &pem.Block{Type: "PRIVATE KEY", Bytes: b}, nil
+	}
+}
+
+// generatePrivateKey derives an Ed25519 key from the random bytes. The RSA and ECDSA key generation of the standard
+// library doesn't promise the same key for the same random bytes, so only Ed25519 keys can be reproduced.
+func generatePrivateKey(r io.Reader, typ string) (crypto.PrivateKey, error) {
+	if typ != "ed25519" {
+		return nil, fmt.Errorf("%s keys are not supported by the deterministic rendering", typ)
+	}
+	seed := make([]byte, ed25519.SeedSize)
+	if _, err := io.ReadFull(r, seed); err != nil {
+		return nil, err
+	}
+	return ed25519.NewKeyFromSeed(seed), nil
+}
+
+func netIPs(ips []interface{}) ([]net.IP, error) {
+	result := make([]net.IP, 0, len(ips))
+	for _, ip := range ips {
+		s, ok := ip.(string)
+		if !ok {
+			return nil, fmt.Errorf("error parsing ip: %v is not a string", ip)
+		}
+		parsed := net.ParseIP(s)
+		if parsed == nil {
+			return nil, fmt.Errorf("error parsing ip: %s", s)
+		}
+		result = append(result, parsed)
+	}
+	return result, nil
+}
+
+func strs(values []interface{}) ([]string, error) {
+	result := make([]string, 0, len(values))
+	for _, v := range values {
+		s, ok := v.(string)
+		if !ok {
+			return nil, fmt.Errorf("error processing alternate dns name: %v is not a string", v)
+		}
+		result = append(result, s)
+	}
+	return result, nil
+}
@@ -0,0 +1,216 @@
+package helm
+
+import (
+	"crypto/ed25519"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"helm.sh/helm/v3/pkg/chart"
+
+	"github.com/kyma-incubator/kymactl/manifests"
+)
+
+var renderTime = time.Date(2022, 8, 1, 12, 0, 0, 0, time.UTC)
+
+// loadTestChart loads a chart with the templates by file name
+func loadTestChart(t *testing.T, templates map[string]string) *chart.Chart {
+	t.Helper()
+	files := fstest.MapFS{
+		"Chart.yaml": {Data: []byte("apiVersion: v2\nname: test\nversion: 0.1.0\n")},
+	}
+	for name, tpl := range templates {
+		files["templates/"+name] = &fstest.MapFile{Data: []byte(tpl)}
+	}
+	chrt, err := loadChart(withPrefix("test", files), "test", "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return chrt
+}
+
+func renderTestChart(t *testing.T, opts renderOptions, templates map[string]string) string {
+	t.Helper()
+	manifest, err := renderChart("test", "default", "", loadTestChart(t, templates), opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return manifest
+}
+
+// TestSeededRenderingIsDeterministic renders components which generate passwords and certificates. The renderings
+// with the same seed are equal, another seed changes only the lines which differ between random renderings
+func TestSeededRenderingIsDeterministic(t *testing.T) {
+	catalog, err := NewCatalog(manifests.FS, manifests.ChartsDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	components, err := LoadComponents(manifests.FS, manifests.ComponentsFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, component := range components.All() {
+		if component.Name != "kiali" && component.Name != "serverless" {
+			continue
+		}
+		component := component
+		t.Run(component.Name, func(t *testing.T) {
+			chart, err := catalog.Get(component.Name, "")
+			if err != nil {
+				t.Fatal(err)
+			}
+			values, err := chart.Values("evaluation")
+			if err != nil {
+				t.Fatal(err)
+			}
+			renderer, err := chart.Renderer(components.NamespaceOf(component))
+			if err != nil {
+				t.Fatal(err)
+			}
+			render := func(kyma string) string {
+				seed := ComponentSeed([]byte("key"), "default", kyma, component.Name)
+				manifest, err := renderer.WithSeed(seed, renderTime).RenderManifest(values)
+				if err != nil {
+					t.Fatal(err)
+				}
+				return manifest
+			}
+			first, second, other := render("kyma"), render("kyma"), render("other")
+			if first != second {
+				t.Fatal("renderings with the same seed differ")
+			}
+			if first == other {
+				t.Fatal("renderings with different seeds are equal")
+			}
+			manifest, err := normalizeRandomValues(first, other)
+			if err != nil {
+				t.Fatal(err)
+			}
+			compareGolden(t, filepath.Join("testdata", "golden", component.Name, "evaluation.yaml"), manifest)
+		})
+	}
+}
+
+func TestSeededTemplateFunctions(t *testing.T) {
+	seeded := renderOptions{seed: []byte("seed"), now: renderTime}
+	templates := map[string]string{
+		"a.yaml": "a: {{ randAlphaNum 16 }}\nb: {{ randAlphaNum 16 }}\n",
+		"b.yaml": "c: {{ randAlphaNum 16 }}\n",
+	}
+	first := renderTestChart(t, seeded, templates)
+	lines := strings.Split(first, "\n")
+	if strings.TrimPrefix(lines[0], "a: ") == strings.TrimPrefix(lines[1], "b: ") {
+		t.Errorf("expected different values for the calls in a template, got %q", first)
+	}
+
+	// a new template doesn't change the values of the other templates
+	templates["0.yaml"] = "x: {{ randAlphaNum 16 }}\n"
+	if second := renderTestChart(t, seeded, templates); !strings.HasSuffix(second, first) {
+		t.Errorf("expected the values of the other templates to stay, got %q and %q", first, second)
+	}
+
+	manifest := renderTestChart(t, seeded, map[string]string{
+		"values.yaml": "alpha: {{ randAlpha 8 }}\nnumeric: {{ randNumeric 8 }}\nuuid: {{ uuidv4 }}\nint: {{ randInt 10 20 }}\n" +
+			"now: {{ now | date \"2006-01-02T15:04:05Z07:00\" }}\n",
+	})
+	values := parseTestManifest(t, manifest, false)
+	if values["now"] != "2022-08-01T12:00:00Z" {
+		t.Errorf("expected the render time, got %q", values["now"])
+	}
+	if len(values["alpha"]) != 8 || strings.Trim(values["alpha"], alphaChars) != "" {
+		t.Errorf("expected 8 letters, got %q", values["alpha"])
+	}
+	if len(values["numeric"]) != 8 || strings.Trim(values["numeric"], numericChars) != "" {
+		t.Errorf("expected 8 digits, got %q", values["numeric"])
+	}
+	if len(values["uuid"]) != 36 || values["uuid"][14] != '4' {
+		t.Errorf("expected an UUID v4, got %q", values["uuid"])
+	}
+	if n, err := strconv.Atoi(values["int"]); err != nil || n < 10 || n >= 20 {
+		t.Errorf("expected an int in [10, 20), got %q", values["int"])
+	}
+
+	_, err := renderChart("test", "default", "", loadTestChart(t, map[string]string{"bcrypt.yaml": "x: {{ bcrypt \"password\" }}"}), seeded)
+	if err == nil || !strings.Contains(err.Error(), "bcrypt is not supported by the deterministic rendering") {
+		t.Errorf("expected bcrypt to fail, got %v", err)
+	}
+}
+
+func TestSeededCertificates(t *testing.T) {
+	manifest := renderTestChart(t, renderOptions{seed: []byte("seed"), now: renderTime}, map[string]string{
+		"cert.yaml": `{{- $ca := genCA "test-ca" 365 }}
+{{- $cert := genSignedCert "test" (list "10.0.0.1") (list "test.default.svc") 30 $ca }}
+ca: {{ $ca.Cert | b64enc }}
+cert: {{ $cert.Cert | b64enc }}
+key: {{ $cert.Key | b64enc }}
+ed25519: {{ genPrivateKey "ed25519" | b64enc }}
+`,
+	})
+	values := parseTestManifest(t, manifest, true)
+
+	ca, cert := parsePEMCertificate(t, values["ca"]), parsePEMCertificate(t, values["cert"])
+	if !ca.IsCA || ca.Subject.CommonName != "test-ca" {
+		t.Errorf("expected the CA test-ca, got %v", ca.Subject)
+	}
+	roots := x509.NewCertPool()
+	roots.AddCert(ca)
+	if _, err := cert.Verify(x509.VerifyOptions{Roots: roots, DNSName: "test.default.svc", CurrentTime: renderTime.Add(time.Hour)}); err != nil {
+		t.Errorf("certificate not signed by the CA: %v", err)
+	}
+	if !cert.NotBefore.Equal(renderTime) || !cert.NotAfter.Equal(renderTime.Add(30*24*time.Hour)) {
+		t.Errorf("expected the validity to start at the render time, got %v to %v", cert.NotBefore, cert.NotAfter)
+	}
+	if len(cert.IPAddresses) != 1 || cert.IPAddresses[0].String() != "10.0.0.1" {
+		t.Errorf("expected the IP address, got %v", cert.IPAddresses)
+	}
+	for _, key := range []string{"key", "ed25519"} {
+		if k, err := parsePrivateKey(values[key]); err != nil {
+			t.Errorf("invalid %s key: %v", key, err)
+		} else if _, ok := k.(ed25519.PrivateKey); !ok {
+			t.Errorf("expected an Ed25519 %s key, got %T", key, k)
+		}
+	}
+
+	_, err := renderChart("test", "default", "", loadTestChart(t, map[string]string{"rsa.yaml": "x: {{ genPrivateKey \"rsa\" }}"}),
+		renderOptions{seed: []byte("seed"), now: renderTime})
+	if err == nil || !strings.Contains(err.Error(), "rsa keys are not supported by the deterministic rendering") {
+		t.Errorf("expected RSA keys to fail, got %v", err)
+	}
+}
+
+// parseTestManifest returns the values of the `key: value` lines of the manifest
+func parseTestManifest(t *testing.T, manifest string, encoded bool) map[string]string {
+	t.Helper()
+	values := map[string]string{}
+	for _, line := range strings.Split(strings.TrimSuffix(manifest, YAMLSeparator), "\n") {
+		key, value, _ := strings.Cut(line, ": ")
+		if encoded {
+			decoded, err := base64.StdEncoding.DecodeString(value)
+			if err != nil {
+				t.Fatal(err)
+			}
+			value = string(decoded)
+		}
+		values[key] = value
+	}
+	return values
+}
+
+func parsePEMCertificate(t *testing.T, data string) *x509.Certificate {
+	t.Helper()
+	block, _ := pem.Decode([]byte(data))
+	if block == nil {
+		t.Fatalf("no PEM certificate: %q", data)
+	}
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cert
+}
@@ -7,12 +7,13 @@ import (
 	"path/filepath"
 	"sort"
 	"strings"
+	"time"
 
 	"gopkg.in/yaml.v2"
 	"helm.sh/helm/v3/pkg/chart"
 	"helm.sh/helm/v3/pkg/chart/loader"
 	"helm.sh/helm/v3/pkg/chartutil"
-	"helm.sh/helm/v3/pkg/engine"
+	helmengine "helm.sh/helm/v3/pkg/engine"
 
 	"github.com/kyma-incubator/kymactl/manifests"
 )
@@ -46,6 +47,17 @@ type Renderer struct {
 	started       bool
 	files         fs.FS
 	dir           string
+	options       renderOptions
+}
+
+// renderOptions replace the template functions which return different values on every rendering
+type renderOptions struct {
+	// seed of the random values, keys and certificates. If nil: random
+	seed []byte
+	// now is the current time of the seeded rendering
+	now time.Time
+	// secrets are looked up to reuse their generated values. If nil: the generated values are rendered
+	secrets SecretLookup
 }
 
 // NewFileTemplateRenderer creates a TemplateRenderer with the given parameters and returns a pointer to it.
@@ -74,7 +86,27 @@ func (h *Renderer) RenderManifest(values string) (string, error) {
 	if !h.started {
 		return "", fmt.Errorf("fileTemplateRenderer for %s not started in renderChart", h.componentName)
 	}
-	return renderChart(h.componentName, h.namespace, values, h.chart)
+	return renderChart(h.componentName, h.namespace, values, h.chart, h.options)
+}
+
+// WithSeed returns a copy of the renderer which derives the values of the random and crypto template functions
+// (randAlphaNum, uuidv4, genPrivateKey, genCA, genSignedCert, ...) from the seed, so every rendering of the same values
+// returns the same manifest. now is returned by the now function and starts the validity of the generated
+// certificates. bcrypt, htpasswd and encryptAES fail.
+func (h *Renderer) WithSeed(seed []byte, now time.Time) *Renderer {
+	r := *h
+	r.options.seed = seed
+	r.options.now = now
+	return &r
+}
+
+// WithSecretLookup returns a copy of the renderer which reuses the values of the existing Secrets in the target cluster
+// instead of the values generated by the random string functions, and which looks up Secrets with the lookup
+// template function. Generated keys and certificates are not reused.
+func (h *Renderer) WithSecretLookup(secrets SecretLookup) *Renderer {
+	r := *h
+	r.options.secrets = secrets
+	return &r
 }
 
 func GetFilesRecursive(f fs.FS, root string) ([]string, error) {
@@ -94,32 +126,45 @@ func GetFilesRecursive(f fs.FS, root string) ([]string, error) {
 
 // loadChart implements the TemplateRenderer interface.
 func (h *Renderer) loadChart() error {
-	fnames, err := GetFilesRecursive(h.files, h.dir)
+	if h.chart != nil {
+		return nil
+	}
+	chrt, err := loadChart(h.files, h.dir, h.componentName)
+	if err != nil {
+		return err
+	}
+	h.chart = chrt
+	return nil
+}
+
+// loadChart loads all files of the chart in the dir folder.
+func loadChart(files fs.FS, dir, componentName string) (*chart.Chart, error) {
+	fnames, err := GetFilesRecursive(files, dir)
 	if err != nil {
 		if os.IsNotExist(err) {
-			return fmt.Errorf("component %q does not exist", h.componentName)
+			return nil, fmt.Errorf("component %q does not exist", componentName)
 		}
-		return fmt.Errorf("list files: %v", err)
+		return nil, fmt.Errorf("list files: %v", err)
 	}
 	var bfs []*loader.BufferedFile
 	for _, fname := range fnames {
-		b, err := fs.ReadFile(h.files, fname)
+		b, err := fs.ReadFile(files, fname)
 		if err != nil {
-			return fmt.Errorf("read file: %v", err)
+			return nil, fmt.Errorf("read file: %v", err)
 		}
 		// Helm expects unix / separator, but on windows this will be \
-		name := strings.ReplaceAll(stripPrefix(fname, h.dir), string(filepath.Separator), "/")
+		name := strings.ReplaceAll(stripPrefix(fname, dir), string(filepath.Separator), "/")
 		bf := &loader.BufferedFile{
 			Name: name,
 			Data: b,
 		}
 		bfs = append(bfs, bf)
 	}
-	h.chart, err = loader.LoadFiles(bfs)
+	chrt, err := loader.LoadFiles(bfs)
 	if err != nil {
-		return fmt.Errorf("load files: %v", err)
+		return nil, fmt.Errorf("load files: %v", err)
 	}
-	return nil
+	return chrt, nil
 }
 
 func builtinProfileToFilename(name string) string {
@@ -156,7 +201,7 @@ func convertNestedToStringInterfaceMap(input map[interface{}]interface{}, dest m
 }
 
 // renderChart renders the given chart with the given values and returns the resulting YAML manifest string.
-func renderChart(name, namespace, values string, chrt *chart.Chart) (string, error) {
+func renderChart(name, namespace, values string, chrt *chart.Chart, opts renderOptions) (string, error) {
 	options := chartutil.ReleaseOptions{
 		Name:      name,
 		Namespace: namespace,
@@ -172,11 +217,29 @@ func renderChart(name, namespace, values string, chrt *chart.Chart) (string, err
 	caps := *chartutil.DefaultCapabilities
 	vals, err := chartutil.ToRenderValues(chrt, convertedMap, options, &caps)
 	if err != nil {
-		fmt.Printf("Error dupa1: %s", err)
 		return "", err
 	}
 
-	files, err := engine.Render(chrt, vals)
+	// templates may modify the values with set, and the nested maps are shared with the values of the loaded chart
+	vals["Values"] = copyValues(vals["Values"])
+
+	var files map[string]string
+	var source *randomSource
+	if opts.seed == nil && opts.secrets == nil {
+		files, err = helmengine.Render(chrt, vals)
+	} else {
+		source = newRandomSource(opts.seed)
+		e := engine{funcs: source.randomFuncs(), executing: source.executing}
+		if opts.seed != nil {
+			for name, f := range source.cryptoFuncs(opts.now) {
+				e.funcs[name] = f
+			}
+		}
+		if opts.secrets != nil {
+			e.funcs["lookup"] = lookupSecrets(opts.secrets)
+		}
+		files, err = e.render(chrt, vals)
+	}
 	crdFiles := chrt.CRDObjects()
 	if err != nil {
 		return "", err
@@ -221,5 +284,30 @@ func renderChart(name, namespace, values string, chrt *chart.Chart) (string, err
 		}
 	}
 
+	if opts.secrets != nil {
+		return reuseSecrets(sb.String(), namespace, source.generated, opts.secrets)
+	}
 	return sb.String(), nil
 }
+
+// copyValues returns a deep copy of the maps and lists of the values
+func copyValues(value interface{}) interface{} {
+	switch v := value.(type) {
+	case chartutil.Values:
+		return chartutil.Values(copyValues(map[string]interface{}(v)).(map[string]interface{}))
+	case map[string]interface{}:
+		result := make(map[string]interface{}, len(v))
+		for key, val := range v {
+			result[key] = copyValues(val)
+		}
+		return result
+	case []interface{}:
+		result := make([]interface{}, len(v))
+		for i, val := range v {
+			result[i] = copyValues(val)
+		}
+		return result
+	default:
+		return value
+	}
+}
@@ -1,57 +1,180 @@
 package helm
 
 import (
-	"io/fs"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
-	"time"
+	"testing/fstest"
 
 	"github.com/kyma-incubator/kymactl/manifests"
-	"gopkg.in/yaml.v2"
 )
 
-func TestAllChartsCanBeRendered(t *testing.T) {
+var update = flag.Bool("update", false, "update the golden files of the rendered charts in testdata/golden")
+
+// goldenProfiles are rendered for every component. Charts without the profile are rendered with their default values
+var goldenProfiles = []string{"evaluation", "production"}
+
+// randomValue replaces the values which differ between two renderings in the golden files
+const randomValue = "<random>"
 
-	components := map[interface{}]interface{}{}
-	by, err := fs.ReadFile(manifests.FS, "components.yaml")
+// TestAllChartsCanBeRendered renders every component with every profile and compares the manifests with the golden files.
+// After changing a chart or the renderer review the diff of:
+//
+//	go test ./pkg/helm -run TestAllChartsCanBeRendered -update
+func TestAllChartsCanBeRendered(t *testing.T) {
+	catalog, err := NewCatalog(manifests.FS, manifests.ChartsDir)
 	if err != nil {
-		t.Errorf("Cannot read component.yaml: %s", err)
+		t.Fatal(err)
 	}
-	var list []interface{}
-	yaml.Unmarshal(by, &components)
-	for _, c := range components["components"].([]interface{}) {
-		list = append(list, c)
+	components, err := LoadComponents(manifests.FS, manifests.ComponentsFile)
+	if err != nil {
+		t.Fatal(err)
 	}
-	for _, c := range components["prerequisites"].([]interface{}) {
-		list = append(list, c)
+	for _, component := range components.All() {
+		for _, profile := range goldenProfiles {
+			component, profile := component, profile
+			t.Run(component.Name+"/"+profile, func(t *testing.T) {
+				chart, err := catalog.Get(component.Name, "")
+				if err != nil {
+					t.Fatal(err)
+				}
+				values := ""
+				if chart.HasProfile(profile) {
+					if values, err = chart.Values(profile); err != nil {
+						t.Fatal(err)
+					}
+				}
+				renderer, err := chart.Renderer(components.NamespaceOf(component))
+				if err != nil {
+					t.Fatal(err)
+				}
+				// the random values differ between the two renderings
+				first, err := renderer.RenderManifest(values)
+				if err != nil {
+					t.Fatal(err)
+				}
+				second, err := renderer.RenderManifest(values)
+				if err != nil {
+					t.Fatal(err)
+				}
+				manifest, err := normalizeRandomValues(first, second)
+				if err != nil {
+					t.Fatal(err)
+				}
+				compareGolden(t, filepath.Join("testdata", "golden", component.Name, profile+".yaml"), manifest)
+			})
+		}
 	}
+}
 
-	for _, c := range list {
-		var component = c.(map[interface{}]interface{})
-		start := time.Now()
-
-		name := component["name"].(string)
-		namespace := "kyma-system"
-		if component["namespace"] != nil {
-			namespace = component["namespace"].(string)
+// compareGolden compares the manifest with the golden file, or writes it with -update
+func compareGolden(t *testing.T, file, manifest string) {
+	t.Helper()
+	if *update {
+		if err := os.MkdirAll(filepath.Dir(file), 0o755); err != nil {
+			t.Fatal(err)
 		}
+		if err := os.WriteFile(file, []byte(manifest), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+	golden, err := os.ReadFile(file)
+	if err != nil {
+		t.Fatalf("%v, create the golden file with -update", err)
+	}
+	if string(golden) == manifest {
+		return
+	}
+	want, got := strings.Split(string(golden), "\n"), strings.Split(manifest, "\n")
+	for i := 0; i < len(want) || i < len(got); i++ {
+		var w, g string
+		if i < len(want) {
+			w = want[i]
+		}
+		if i < len(got) {
+			g = got[i]
+		}
+		if w != g {
+			t.Fatalf("manifest differs from %s at line %d (%d lines expected, %d rendered):\n  expected: %q\n  rendered: %q\nreview the change and update the golden files with -update",
+				file, i+1, len(want), len(got), w, g)
+		}
+	}
+}
 
-		r := NewGenericRenderer(manifests.FS, "charts/"+name, name, namespace)
-
-		err = r.Run()
-		if err != nil {
-			t.Error(err)
+// normalizeRandomValues replaces the values of the lines which differ between two renderings of the same chart with <random>,
+// e.g. generated passwords and certificates. Other differences like a changed order of the documents are an error
+func normalizeRandomValues(first, second string) (string, error) {
+	a, b := strings.Split(first, "\n"), strings.Split(second, "\n")
+	if len(a) != len(b) {
+		return "", fmt.Errorf("rendering is not deterministic: %d and %d lines", len(a), len(b))
+	}
+	for i := range a {
+		if a[i] == b[i] {
+			continue
 		}
-		evaluation, err := LoadValues("evaluation", "charts/"+name)
-		if err != nil {
-			t.Logf("No evaluation profile for %s", name)
+		key := lineKey(a[i])
+		if key != lineKey(b[i]) {
+			return "", fmt.Errorf("rendering is not deterministic at line %d: %q and %q", i+1, a[i], b[i])
 		}
+		a[i] = key + randomValue
+	}
+	return strings.Join(a, "\n"), nil
+}
+
+// lineKey returns the indentation and the key of a YAML line up to the value, e.g. `  password: ` or `  - `
+func lineKey(line string) string {
+	if i := strings.Index(line, ": "); i >= 0 {
+		return line[:i+2]
+	}
+	trimmed := strings.TrimLeft(line, " ")
+	key := line[:len(line)-len(trimmed)]
+	if strings.HasPrefix(trimmed, "- ") {
+		key += "- "
+	}
+	return key
+}
+
+func TestNormalizeRandomValues(t *testing.T) {
+	first := "kind: Secret\ndata:\n  password: YWJj\n  user: admin\n  - x1\n"
+	second := "kind: Secret\ndata:\n  password: eHl6\n  user: admin\n  - y2\n"
+	manifest, err := normalizeRandomValues(first, second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := "kind: Secret\ndata:\n  password: <random>\n  user: admin\n  - <random>\n"; manifest != expected {
+		t.Errorf("expected %q, got %q", expected, manifest)
+	}
+
+	if _, err := normalizeRandomValues("a: 1\nb: 2\n", "b: 2\na: 1\n"); err == nil {
+		t.Error("expected error for a changed order")
+	}
+	if _, err := normalizeRandomValues("a: 1\n", "a: 1\nb: 2\n"); err == nil {
+		t.Error("expected error for a different number of lines")
+	}
+}
 
-		manifest, err := r.RenderManifest(evaluation)
+func TestRenderDoesNotModifyChartValues(t *testing.T) {
+	files := withPrefix("counter", fstest.MapFS{
+		"Chart.yaml":  {Data: []byte("apiVersion: v2\nname: counter\nversion: 0.1.0\n")},
+		"values.yaml": {Data: []byte("config:\n  count: 0\n")},
+		"templates/config.yaml": {Data: []byte(
+			"{{- $_ := set .Values.config \"count\" (add1 .Values.config.count) }}\ncount: {{ .Values.config.count }}\n")},
+	})
+	chrt, err := loadChart(files, "counter", "counter")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 2; i++ {
+		manifest, err := renderChart("counter", "default", "", chrt, renderOptions{})
 		if err != nil {
-			t.Error(err)
+			t.Fatal(err)
+		}
+		if !strings.HasPrefix(manifest, "count: 1\n") {
+			t.Errorf("expected the values of the chart in render %d, got %q", i+1, manifest)
 		}
-		elapsed := time.Since(start)
-		t.Logf("Rendered manifest %s, size: %d, time: %s", name, len(manifest), &elapsed)
-
 	}
 }
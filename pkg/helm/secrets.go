@@ -0,0 +1,137 @@
+package helm
+
+import (
+	"encoding/base64"
+	"fmt"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+)
+
+// SecretLookup returns the data of the Secret in the target cluster, or nil if it doesn't exist
+type SecretLookup func(namespace, name string) (map[string][]byte, error)
+
+// lookupSecrets implements the helm lookup template function for Secrets. Other kinds and lists find nothing,
+// as in helm template
+func lookupSecrets(secrets SecretLookup) func(apiVersion, kind, namespace, name string) (map[string]interface{}, error) {
+	return func(apiVersion, kind, namespace, name string) (map[string]interface{}, error) {
+		if apiVersion != "v1" || kind != "Secret" || name == "" {
+			return map[string]interface{}{}, nil
+		}
+		data, err := secrets(namespace, name)
+		if err != nil {
+			return nil, fmt.Errorf("lookup of Secret %s/%s failed: %w", namespace, name, err)
+		}
+		if data == nil {
+			return map[string]interface{}{}, nil
+		}
+		encoded := make(map[string]interface{}, len(data))
+		for key, value := range data {
+			encoded[key] = base64.StdEncoding.EncodeToString(value)
+		}
+		return map[string]interface{}{
+			"apiVersion": "v1",
+			"kind":       "Secret",
+			"metadata":   map[string]interface{}{"name": name, "namespace": namespace},
+			"data":       encoded,
+		}, nil
+	}
+}
+
+// reuseSecrets replaces the generated values of the Secrets in the manifest with the values of the existing Secrets.
+// A value is generated if it contains a value of the random string functions (randAlphaNum, uuidv4, ...).
+// Keys and certificates are not replaced: the CA of a webhook certificate is also rendered into its caBundle.
+// Secrets without namespace are looked up in namespace.
+func reuseSecrets(manifest, namespace string, generated []string, secrets SecretLookup) (string, error) {
+	if len(generated) == 0 {
+		return manifest, nil
+	}
+	docs := strings.Split(manifest, YAMLSeparator)
+	for i, doc := range docs {
+		if !strings.Contains(doc, "Secret") {
+			continue
+		}
+		var obj yaml.MapSlice
+		if err := yaml.Unmarshal([]byte(doc), &obj); err != nil {
+			// the manifest is validated when it is applied
+			continue
+		}
+		if field(obj, "kind") != "Secret" {
+			continue
+		}
+		metadata, _ := field(obj, "metadata").(yaml.MapSlice)
+		name, _ := field(metadata, "name").(string)
+		ns, _ := field(metadata, "namespace").(string)
+		if ns == "" {
+			ns = namespace
+		}
+		existing, err := secrets(ns, name)
+		if err != nil {
+			return "", fmt.Errorf("lookup of Secret %s/%s failed: %w", ns, name, err)
+		}
+		if existing == nil {
+			continue
+		}
+		reused := reuseValues(obj, "data", existing, generated, true)
+		if reuseValues(obj, "stringData", existing, generated, false) {
+			reused = true
+		}
+		if !reused {
+			continue
+		}
+		out, err := yaml.Marshal(obj)
+		if err != nil {
+			return "", err
+		}
+		docs[i] = strings.TrimSuffix(string(out), "\n")
+	}
+	return strings.Join(docs, YAMLSeparator), nil
+}
+
+// reuseValues replaces the generated values of the data or stringData section with the existing values
+func reuseValues(obj yaml.MapSlice, section string, existing map[string][]byte, generated []string, encoded bool) bool {
+	values, _ := field(obj, section).(yaml.MapSlice)
+	reused := false
+	for i, item := range values {
+		key, _ := item.Key.(string)
+		value, _ := item.Value.(string)
+		old, ok := existing[key]
+		if !ok || value == "" {
+			continue
+		}
+		plain := value
+		if encoded {
+			if decoded, err := base64.StdEncoding.DecodeString(value); err == nil {
+				plain = string(decoded)
+			}
+		}
+		if !containsAny(plain, generated) && !containsAny(value, generated) {
+			continue
+		}
+		if encoded {
+			values[i].Value = base64.StdEncoding.EncodeToString(old)
+		} else {
+			values[i].Value = string(old)
+		}
+		reused = true
+	}
+	return reused
+}
+
+func field(obj yaml.MapSlice, key string) interface{} {
+	for _, item := range obj {
+		if item.Key == key {
+			return item.Value
+		}
+	}
+	return nil
+}
+
+func containsAny(value string, parts []string) bool {
+	for _, part := range parts {
+		if strings.Contains(value, part) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,123 @@
+package helm
+
+import (
+	"encoding/base64"
+	"errors"
+	"strings"
+	"testing"
+)
+
+const secretsTemplate = `apiVersion: v1
+kind: Secret
+metadata:
+  name: credentials
+data:
+  password: {{ randAlphaNum 16 | b64enc }}
+  url: {{ printf "postgres://admin:%s@db" (randAlphaNum 8) | b64enc }}
+  user: {{ "admin" | b64enc }}
+  token: {{ randAlphaNum 16 | b64enc }}
+stringData:
+  cookie: {{ randAlphaNum 32 }}
+---
+apiVersion: v1
+kind: Secret
+metadata:
+  name: new
+  namespace: other
+data:
+  password: {{ randAlphaNum 16 | b64enc }}
+`
+
+func TestSecretLookupReusesGeneratedValues(t *testing.T) {
+	existing := map[string]map[string][]byte{
+		"default/credentials": {
+			"password": []byte("existing-password"),
+			"url":      []byte("postgres://admin:existing@db"),
+			"user":     []byte("root"),
+			"cookie":   []byte("existing-cookie"),
+		},
+	}
+	var lookups []string
+	secrets := func(namespace, name string) (map[string][]byte, error) {
+		lookups = append(lookups, namespace+"/"+name)
+		return existing[namespace+"/"+name], nil
+	}
+
+	manifest := renderTestChart(t, renderOptions{secrets: secrets}, map[string]string{"secrets.yaml": secretsTemplate})
+
+	if strings.Join(lookups, ",") != "default/credentials,other/new" {
+		t.Errorf("expected the lookup of both Secrets in their namespaces, got %v", lookups)
+	}
+	docs := strings.Split(manifest, YAMLSeparator)
+	credentials := parseSecret(t, docs[0])
+	for key, expected := range map[string]string{
+		"password": "existing-password",
+		"url":      "postgres://admin:existing@db",
+		// not generated
+		"user":   "admin",
+		"cookie": "existing-cookie",
+	} {
+		if credentials[key] != expected {
+			t.Errorf("expected %s %q, got %q", key, expected, credentials[key])
+		}
+	}
+	// not in the existing Secret
+	if token := credentials["token"]; len(token) != 16 {
+		t.Errorf("expected a generated token, got %q", token)
+	}
+	if password := parseSecret(t, docs[1])["password"]; len(password) != 16 {
+		t.Errorf("expected a generated password for the new Secret, got %q", password)
+	}
+}
+
+func TestSecretLookupFunction(t *testing.T) {
+	secrets := func(namespace, name string) (map[string][]byte, error) {
+		if namespace == "default" && name == "existing" {
+			return map[string][]byte{"password": []byte("secret")}, nil
+		}
+		return nil, nil
+	}
+	manifest := renderTestChart(t, renderOptions{secrets: secrets}, map[string]string{"lookup.yaml": `
+{{- $existing := lookup "v1" "Secret" "default" "existing" }}
+existing: {{ index $existing.data "password" | b64dec }}
+missing: {{ empty (lookup "v1" "Secret" "default" "missing") }}
+configmap: {{ empty (lookup "v1" "ConfigMap" "default" "existing") }}
+`})
+	if expected := "existing: secret\nmissing: true\nconfigmap: true\n"; manifest != expected+YAMLSeparator {
+		t.Errorf("expected %q, got %q", expected, manifest)
+	}
+
+	failing := func(namespace, name string) (map[string][]byte, error) {
+		return nil, errors.New("connection refused")
+	}
+	_, err := renderChart("test", "default", "", loadTestChart(t, map[string]string{"secrets.yaml": secretsTemplate}),
+		renderOptions{secrets: failing})
+	if err == nil || !strings.Contains(err.Error(), "connection refused") {
+		t.Errorf("expected the lookup error, got %v", err)
+	}
+}
+
+// parseSecret returns the decoded data and the stringData of the Secret
+func parseSecret(t *testing.T, doc string) map[string]string {
+	t.Helper()
+	values := map[string]string{}
+	section := ""
+	for _, line := range strings.Split(doc, "\n") {
+		if !strings.HasPrefix(line, "  ") {
+			section = strings.TrimSuffix(line, ":")
+			continue
+		}
+		key, value, _ := strings.Cut(strings.TrimSpace(line), ": ")
+		switch section {
+		case "data":
+			decoded, err := base64.StdEncoding.DecodeString(value)
+			if err != nil {
+				t.Fatal(err)
+			}
+			values[key] = string(decoded)
+		case "stringData":
+			values[key] = value
+		}
+	}
+	return values
+}
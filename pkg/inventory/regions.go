@@ -0,0 +1,77 @@
+package inventory
+
+import (
+	"fmt"
+	"io/fs"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+)
+
+// Provider is a single entry of the regions.yaml file.
+type Provider struct {
+	Name    string   `yaml:"name"`
+	Aliases []string `yaml:"aliases,omitempty"`
+	Regions []string `yaml:"regions,omitempty"`
+}
+
+// RegionCatalog is the content of the regions.yaml file.
+type RegionCatalog struct {
+	Providers []Provider `yaml:"providers,omitempty"`
+
+	// provider name by lowercase name or alias
+	names map[string]*Provider
+}
+
+// LoadRegions reads and parses the region catalog from the given file.
+func LoadRegions(files fs.FS, path string) (*RegionCatalog, error) {
+	by, err := fs.ReadFile(files, path)
+	if err != nil {
+		return nil, fmt.Errorf("read region catalog: %v", err)
+	}
+	catalog := &RegionCatalog{}
+	if err := yaml.Unmarshal(by, catalog); err != nil {
+		return nil, fmt.Errorf("parse region catalog %s: %v", path, err)
+	}
+	catalog.names = map[string]*Provider{}
+	for i := range catalog.Providers {
+		p := &catalog.Providers[i]
+		for _, name := range append([]string{p.Name}, p.Aliases...) {
+			key := normalize(name)
+			if other, ok := catalog.names[key]; ok {
+				return nil, fmt.Errorf("parse region catalog %s: %s is used by providers %s and %s", path, name, other.Name, p.Name)
+			}
+			catalog.names[key] = p
+		}
+	}
+	return catalog, nil
+}
+
+// Normalize returns the provider and region names from the catalog.
+// Names are compared case-insensitive and provider aliases are replaced by the provider name.
+func (c *RegionCatalog) Normalize(provider, region string) (string, string, error) {
+	p, ok := c.names[normalize(provider)]
+	if !ok {
+		return "", "", fmt.Errorf("unknown provider %q, expected one of %s", provider, strings.Join(c.providerNames(), ", "))
+	}
+	for _, r := range p.Regions {
+		if normalize(r) == normalize(region) {
+			return p.Name, r, nil
+		}
+	}
+	return "", "", fmt.Errorf("unknown region %q of provider %s", region, p.Name)
+}
+
+func (c *RegionCatalog) providerNames() []string {
+	var names []string
+	for _, p := range c.Providers {
+		names = append(names, p.Name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func normalize(name string) string {
+	return strings.ToLower(strings.TrimSpace(name))
+}
@@ -0,0 +1,59 @@
+package inventory
+
+import (
+	"testing"
+	"testing/fstest"
+
+	"github.com/kyma-incubator/kymactl/manifests"
+)
+
+func TestNormalizeRegions(t *testing.T) {
+	files := fstest.MapFS{"regions.yaml": {Data: []byte(`
+providers:
+  - name: gcp
+    aliases: [Google]
+    regions: [europe-west1]
+  - name: aws
+    regions: [eu-central-1]
+`)}}
+	catalog, err := LoadRegions(files, "regions.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tc := range []struct {
+		provider, region       string
+		expProvider, expRegion string
+		expErr                 bool
+	}{
+		{provider: "gcp", region: "europe-west1", expProvider: "gcp", expRegion: "europe-west1"},
+		{provider: " GOOGLE ", region: "Europe-West1", expProvider: "gcp", expRegion: "europe-west1"},
+		{provider: "aws", region: "europe-west1", expErr: true},
+		{provider: "azure", region: "westeurope", expErr: true},
+	} {
+		provider, region, err := catalog.Normalize(tc.provider, tc.region)
+		if (err != nil) != tc.expErr {
+			t.Errorf("%s/%s: unexpected error %v", tc.provider, tc.region, err)
+		}
+		if provider != tc.expProvider || region != tc.expRegion {
+			t.Errorf("%s/%s: expected %s/%s, got %s/%s", tc.provider, tc.region, tc.expProvider, tc.expRegion, provider, region)
+		}
+	}
+}
+
+func TestRegionCatalogRejectsDuplicatedAliases(t *testing.T) {
+	files := fstest.MapFS{"regions.yaml": {Data: []byte("providers:\n  - name: gcp\n  - name: google\n    aliases: [GCP]\n")}}
+	if _, err := LoadRegions(files, "regions.yaml"); err == nil {
+		t.Error("expected error for duplicated alias")
+	}
+}
+
+func TestEmbeddedRegionsAreValid(t *testing.T) {
+	catalog, err := LoadRegions(manifests.FS, manifests.RegionsFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := catalog.Normalize("gcp", "europe-west1"); err != nil {
+		t.Error(err)
+	}
+}
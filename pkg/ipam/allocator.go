@@ -0,0 +1,58 @@
+package ipam
+
+import (
+	"fmt"
+	"math/big"
+	"net"
+)
+
+// NextFree returns the first block with the prefix length in the supernet which doesn't overlap the used networks
+func NextFree(supernet *net.IPNet, prefixLength int, used []*net.IPNet) (*net.IPNet, error) {
+	ones, bits := supernet.Mask.Size()
+	if prefixLength < ones || prefixLength > bits {
+		return nil, fmt.Errorf("prefix length %d is not within %s", prefixLength, supernet)
+	}
+	blockSize := new(big.Int).Lsh(big.NewInt(1), uint(bits-prefixLength))
+	start := new(big.Int).SetBytes(supernet.IP)
+	end := new(big.Int).Add(start, new(big.Int).Lsh(big.NewInt(1), uint(bits-ones)))
+
+	for candidate := start; new(big.Int).Add(candidate, blockSize).Cmp(end) <= 0; {
+		block := &net.IPNet{IP: toIP(candidate, bits), Mask: net.CIDRMask(prefixLength, bits)}
+		var conflict *net.IPNet
+		for _, u := range used {
+			if Overlap(block, u) {
+				conflict = u
+				break
+			}
+		}
+		if conflict == nil {
+			return block, nil
+		}
+		// continue with the first aligned block after the conflicting network
+		next := new(big.Int).Add(lastAddress(conflict), big.NewInt(1))
+		if rem := new(big.Int).Mod(new(big.Int).Sub(next, start), blockSize); rem.Sign() != 0 {
+			next.Add(next, new(big.Int).Sub(blockSize, rem))
+		}
+		if next.Cmp(candidate) <= 0 {
+			next = new(big.Int).Add(candidate, blockSize)
+		}
+		candidate = next
+	}
+	return nil, fmt.Errorf("no free /%d block in %s", prefixLength, supernet)
+}
+
+func lastAddress(network *net.IPNet) *big.Int {
+	ones, bits := network.Mask.Size()
+	ip := network.IP.To4()
+	if ip == nil || bits != 8*net.IPv4len {
+		ip = network.IP.To16()
+	}
+	size := new(big.Int).Lsh(big.NewInt(1), uint(bits-ones))
+	return new(big.Int).Sub(new(big.Int).Add(new(big.Int).SetBytes(ip), size), big.NewInt(1))
+}
+
+func toIP(value *big.Int, bits int) net.IP {
+	ip := make(net.IP, bits/8)
+	value.FillBytes(ip)
+	return ip
+}
@@ -0,0 +1,53 @@
+package ipam
+
+import (
+	"net"
+	"testing"
+)
+
+func mustParse(t *testing.T, cidrs ...string) []*net.IPNet {
+	var networks []*net.IPNet
+	for _, cidr := range cidrs {
+		network, err := ParseCIDR(cidr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		networks = append(networks, network)
+	}
+	return networks
+}
+
+func TestNextFree(t *testing.T) {
+	for _, tc := range []struct {
+		supernet     string
+		prefixLength int
+		used         []string
+		expected     string
+	}{
+		{supernet: "10.0.0.0/16", prefixLength: 24, expected: "10.0.0.0/24"},
+		{supernet: "10.0.0.0/16", prefixLength: 24, used: []string{"10.0.0.0/24", "10.0.1.0/24"}, expected: "10.0.2.0/24"},
+		{supernet: "10.0.0.0/16", prefixLength: 24, used: []string{"10.0.1.0/24"}, expected: "10.0.0.0/24"},
+		{supernet: "10.0.0.0/16", prefixLength: 22, used: []string{"10.0.0.0/24", "10.0.4.0/23"}, expected: "10.0.8.0/22"},
+		{supernet: "10.0.0.0/16", prefixLength: 24, used: []string{"10.0.0.0/17"}, expected: "10.0.128.0/24"},
+		{supernet: "fd00::/48", prefixLength: 64, used: []string{"fd00::/64"}, expected: "fd00:0:0:1::/64"},
+	} {
+		block, err := NextFree(mustParse(t, tc.supernet)[0], tc.prefixLength, mustParse(t, tc.used...))
+		if err != nil {
+			t.Errorf("%s /%d: %v", tc.supernet, tc.prefixLength, err)
+			continue
+		}
+		if block.String() != tc.expected {
+			t.Errorf("%s /%d: expected %s, got %s", tc.supernet, tc.prefixLength, tc.expected, block)
+		}
+	}
+}
+
+func TestNextFreeExhausted(t *testing.T) {
+	supernet := mustParse(t, "10.0.0.0/23")[0]
+	if _, err := NextFree(supernet, 24, mustParse(t, "10.0.0.0/24", "10.0.1.0/24")); err == nil {
+		t.Error("expected exhausted supernet")
+	}
+	if _, err := NextFree(supernet, 22, nil); err == nil {
+		t.Error("expected error for prefix length larger than the supernet")
+	}
+}
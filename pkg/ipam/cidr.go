@@ -0,0 +1,23 @@
+package ipam
+
+import (
+	"fmt"
+	"net"
+)
+
+// ParseCIDR parses the CIDR notation of a network. The address must be the network address, e.g. 10.0.0.0/16 and not 10.0.0.1/16.
+func ParseCIDR(cidr string) (*net.IPNet, error) {
+	ip, network, err := net.ParseCIDR(cidr)
+	if err != nil {
+		return nil, err
+	}
+	if !ip.Equal(network.IP) {
+		return nil, fmt.Errorf("%s is not a network address, expected %s", cidr, network)
+	}
+	return network, nil
+}
+
+// Overlap returns true if the networks share at least one address
+func Overlap(a, b *net.IPNet) bool {
+	return a.Contains(b.IP) || b.Contains(a.IP)
+}
@@ -0,0 +1,36 @@
+package ipam
+
+import "testing"
+
+func TestParseCIDR(t *testing.T) {
+	for cidr, valid := range map[string]bool{
+		"10.0.0.0/16":   true,
+		"fd00::/64":     true,
+		"10.0.0.1/16":   false,
+		"10.0.0.0":      false,
+		"10.0.0.0/33":   false,
+		"not a network": false,
+	} {
+		if _, err := ParseCIDR(cidr); (err == nil) != valid {
+			t.Errorf("%s: expected valid %v, got %v", cidr, valid, err)
+		}
+	}
+}
+
+func TestOverlap(t *testing.T) {
+	for _, tc := range []struct {
+		a, b    string
+		overlap bool
+	}{
+		{a: "10.0.0.0/16", b: "10.0.1.0/24", overlap: true},
+		{a: "10.0.1.0/24", b: "10.0.0.0/16", overlap: true},
+		{a: "10.0.0.0/16", b: "10.1.0.0/16", overlap: false},
+		{a: "10.0.0.0/8", b: "fd00::/8", overlap: false},
+	} {
+		a, _ := ParseCIDR(tc.a)
+		b, _ := ParseCIDR(tc.b)
+		if Overlap(a, b) != tc.overlap {
+			t.Errorf("%s %s: expected overlap %v", tc.a, tc.b, tc.overlap)
+		}
+	}
+}
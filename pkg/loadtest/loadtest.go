@@ -0,0 +1,393 @@
+package loadtest
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	"golang.org/x/time/rate"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/watch"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	inventoryv1alpha1 "github.com/kyma-incubator/kymactl/api/v1alpha1"
+)
+
+// RunLabel labels the Kymas created by a load test with its prefix
+const RunLabel = "loadtest.kyma-project.io/run"
+
+// Config of a load test
+type Config struct {
+	// Count of the Kymas to create
+	Count int
+	// Namespaces the Kymas are spread over, named <Prefix>-<n>
+	Namespaces int
+	// Prefix of the names of the Kymas and the namespaces
+	Prefix string
+	// Rate of the creations per second
+	Rate float64
+	// Workers creating the Kymas concurrently, so slow requests don't lower the rate
+	Workers int
+	// Mixes of the components of the Kymas
+	Mixes []Mix
+	// Channel of the Kymas. If not provided: the default channel of the catalog
+	Channel string
+	// Timeout of the whole run
+	Timeout time.Duration
+	// ProgressInterval between the progress lines written to Out
+	ProgressInterval time.Duration
+	// Out receives the progress. If not provided: no progress
+	Out io.Writer
+}
+
+func (c *Config) defaults() {
+	if c.Namespaces < 1 {
+		c.Namespaces = 1
+	}
+	if c.Prefix == "" {
+		c.Prefix = "loadtest"
+	}
+	if c.Rate <= 0 {
+		c.Rate = 10
+	}
+	if c.Workers < 1 {
+		c.Workers = 10
+	}
+	if len(c.Mixes) == 0 {
+		c.Mixes = []Mix{{Name: "full", Components: Mixes["full"], Weight: 1}}
+	}
+	if c.Timeout <= 0 {
+		c.Timeout = 30 * time.Minute
+	}
+	if c.ProgressInterval <= 0 {
+		c.ProgressInterval = 10 * time.Second
+	}
+	if c.Out == nil {
+		c.Out = io.Discard
+	}
+}
+
+// Namespace returns the namespace of the i-th Kyma
+func (c *Config) Namespace(i int) string {
+	return fmt.Sprintf("%s-%d", c.Prefix, i%c.Namespaces)
+}
+
+// Run creates the Kymas at the configured rate and waits until all their HelmComponents are installed or the timeout.
+// The HelmComponents are watched from before the first creation, so every installation is observed.
+func Run(ctx context.Context, c client.WithWatch, config Config) (*Report, error) {
+	config.defaults()
+	ctx, cancel := context.WithTimeout(ctx, config.Timeout)
+	defer cancel()
+	t := newTracker(config.Count)
+
+	namespaces := map[string]bool{}
+	for i := 0; i < config.Count && i < config.Namespaces; i++ {
+		namespaces[config.Namespace(i)] = true
+	}
+	for namespace := range namespaces {
+		ns := &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: namespace}}
+		if err := c.Create(ctx, ns); err != nil && !apierrors.IsAlreadyExists(err) {
+			return nil, fmt.Errorf("unable to create namespace %s: %w", namespace, err)
+		}
+	}
+	var watchers sync.WaitGroup
+	watchCtx, stopWatches := context.WithCancel(ctx)
+	for namespace := range namespaces {
+		watchers.Add(1)
+		go func(namespace string) {
+			defer watchers.Done()
+			t.watch(watchCtx, c, namespace)
+		}(namespace)
+	}
+	defer func() {
+		stopWatches()
+		watchers.Wait()
+	}()
+
+	start := time.Now()
+	go t.progress(ctx, config.Out, config.ProgressInterval, start)
+	created := make(chan struct{})
+	go func() {
+		defer close(created)
+		t.create(ctx, c, &config)
+	}()
+
+	select {
+	case <-t.done:
+	case <-ctx.Done():
+	}
+	<-created
+	return t.report(config.Count, start), nil
+}
+
+// Cleanup deletes the Kymas of the load test. Their HelmComponents are deleted by the garbage collector.
+// The namespaces are kept, envtest can't delete them
+func Cleanup(ctx context.Context, c client.Client, config Config) error {
+	config.defaults()
+	for i := 0; i < config.Namespaces; i++ {
+		if err := c.DeleteAllOf(ctx, &inventoryv1alpha1.Kyma{}, client.InNamespace(config.Namespace(i)),
+			client.MatchingLabels{RunLabel: config.Prefix}); err != nil && !apierrors.IsNotFound(err) {
+			return err
+		}
+	}
+	return nil
+}
+
+// kymaState is the progress of a created Kyma
+type kymaState struct {
+	components int
+	installed  map[string]bool
+	created    time.Time
+	ready      time.Time
+}
+
+// tracker records the creation of the Kymas and the installations of their components
+type tracker struct {
+	mu             sync.Mutex
+	count          int
+	kymas          map[string]*kymaState
+	firstCreated   time.Time
+	lastCreated    time.Time
+	createFinished bool
+	ready          int
+	lastReady      time.Time
+	errors         map[string]int
+	done           chan struct{}
+}
+
+func newTracker(count int) *tracker {
+	return &tracker{count: count, kymas: map[string]*kymaState{}, errors: map[string]int{}, done: make(chan struct{})}
+}
+
+func (t *tracker) create(ctx context.Context, c client.Client, config *Config) {
+	limiter := rate.NewLimiter(rate.Limit(config.Rate), 1)
+	indexes := make(chan int)
+	var workers sync.WaitGroup
+	for w := 0; w < config.Workers; w++ {
+		workers.Add(1)
+		go func() {
+			defer workers.Done()
+			for i := range indexes {
+				t.createKyma(ctx, c, config, i)
+			}
+		}()
+	}
+	for i := 0; i < config.Count; i++ {
+		if err := limiter.Wait(ctx); err != nil {
+			break
+		}
+		indexes <- i
+	}
+	close(indexes)
+	workers.Wait()
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.createFinished = true
+	t.checkDone()
+}
+
+func (t *tracker) createKyma(ctx context.Context, c client.Client, config *Config, i int) {
+	mix := mixFor(config.Mixes, i)
+	kyma := &inventoryv1alpha1.Kyma{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: config.Namespace(i),
+			Name:      fmt.Sprintf("%s-%05d", config.Prefix, i),
+			Labels:    map[string]string{RunLabel: config.Prefix},
+		},
+		Spec: inventoryv1alpha1.KymaSpec{Channel: config.Channel},
+	}
+	for _, name := range mix.Components {
+		kyma.Spec.Components = append(kyma.Spec.Components, inventoryv1alpha1.ComponentSpec{Name: name})
+	}
+	// registered before the creation, the components can be installed before the response arrives
+	key := kyma.Namespace + "/" + kyma.Name
+	t.register(key, len(mix.Components))
+	if err := c.Create(ctx, kyma); err != nil {
+		t.unregister(key)
+		if ctx.Err() == nil {
+			t.apiError("create Kyma", err)
+		}
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if now := time.Now(); now.After(t.lastCreated) {
+		t.lastCreated = now
+	}
+}
+
+func (t *tracker) register(key string, components int) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	state := &kymaState{components: components, installed: map[string]bool{}, created: time.Now()}
+	if t.firstCreated.IsZero() {
+		t.firstCreated = state.created
+	}
+	t.kymas[key] = state
+}
+
+func (t *tracker) unregister(key string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if state := t.kymas[key]; state != nil && !state.ready.IsZero() {
+		t.ready--
+	}
+	delete(t.kymas, key)
+}
+
+func (t *tracker) apiError(request string, err error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	reason := apierrors.ReasonForError(err)
+	if reason == metav1.StatusReasonUnknown {
+		// not a response of the API server, e.g. a connection error
+		reason = "Unknown"
+	}
+	t.errors[fmt.Sprintf("%s: %s", request, reason)]++
+}
+
+// watch lists and watches the HelmComponents of the namespace until the context is done
+func (t *tracker) watch(ctx context.Context, c client.WithWatch, namespace string) {
+	for ctx.Err() == nil {
+		var components inventoryv1alpha1.HelmComponentList
+		if err := c.List(ctx, &components, client.InNamespace(namespace)); err != nil {
+			if ctx.Err() == nil {
+				t.apiError("list HelmComponents", err)
+				time.Sleep(time.Second)
+			}
+			continue
+		}
+		for i := range components.Items {
+			t.observe(&components.Items[i], false)
+		}
+		w, err := c.Watch(ctx, &inventoryv1alpha1.HelmComponentList{}, client.InNamespace(namespace),
+			&client.ListOptions{Raw: &metav1.ListOptions{ResourceVersion: components.ResourceVersion}})
+		if err != nil {
+			if ctx.Err() == nil {
+				t.apiError("watch HelmComponents", err)
+				time.Sleep(time.Second)
+			}
+			continue
+		}
+		t.consume(ctx, w)
+	}
+}
+
+// consume observes the events until the watch ends, e.g. when the API server closes it
+func (t *tracker) consume(ctx context.Context, w watch.Interface) {
+	defer w.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case e, ok := <-w.ResultChan():
+			if !ok {
+				return
+			}
+			switch e.Type {
+			case watch.Error:
+				t.apiError("watch HelmComponents", apierrors.FromObject(e.Object))
+				return
+			case watch.Added, watch.Modified, watch.Deleted:
+				if component, ok := e.Object.(*inventoryv1alpha1.HelmComponent); ok {
+					t.observe(component, e.Type == watch.Deleted)
+				}
+			}
+		}
+	}
+}
+
+// observe records the installation of a component. A Kyma is ready when all its components are installed
+func (t *tracker) observe(component *inventoryv1alpha1.HelmComponent, deleted bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	state := t.kymas[component.Namespace+"/"+component.Labels[inventoryv1alpha1.KymaLabel]]
+	if state == nil || !state.ready.IsZero() {
+		return
+	}
+	state.installed[component.Name] = !deleted && component.Status.Status == "success"
+	installed := 0
+	for _, ok := range state.installed {
+		if ok {
+			installed++
+		}
+	}
+	if installed < state.components {
+		return
+	}
+	state.ready = time.Now()
+	t.lastReady = state.ready
+	t.ready++
+	t.checkDone()
+}
+
+// checkDone signals the end of the run when all Kymas are created and ready
+func (t *tracker) checkDone() {
+	if t.createFinished && t.ready == len(t.kymas) {
+		select {
+		case <-t.done:
+		default:
+			close(t.done)
+		}
+	}
+}
+
+func (t *tracker) progress(ctx context.Context, out io.Writer, interval time.Duration, start time.Time) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.done:
+			return
+		case <-ticker.C:
+			t.mu.Lock()
+			fmt.Fprintf(out, "%s: %d/%d Kymas created, %d ready\n", time.Since(start).Round(time.Second), len(t.kymas), t.count, t.ready)
+			t.mu.Unlock()
+		}
+	}
+}
+
+func (t *tracker) report(count int, start time.Time) *Report {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	r := &Report{Kymas: count, Created: len(t.kymas), Ready: t.ready, APIErrors: map[string]int{}}
+	for key, n := range t.errors {
+		r.APIErrors[key] = n
+	}
+	var timesToReady []time.Duration
+	for _, state := range t.kymas {
+		r.Components += state.components
+		for _, ok := range state.installed {
+			if ok {
+				r.InstalledComponents++
+			}
+		}
+		if !state.ready.IsZero() {
+			timesToReady = append(timesToReady, state.ready.Sub(state.created))
+		}
+	}
+	r.TimeToReady = percentiles(timesToReady)
+	if t.firstCreated.IsZero() {
+		return r
+	}
+	r.CreateDuration = t.lastCreated.Sub(t.firstCreated)
+	if r.CreateDuration > 0 {
+		r.CreateRate = float64(r.Created) / r.CreateDuration.Seconds()
+	}
+	r.Duration = time.Since(t.firstCreated)
+	if r.Complete() {
+		r.Duration = t.lastReady.Sub(t.firstCreated)
+	}
+	if r.Duration > 0 {
+		r.ReadyRate = float64(r.Ready) / r.Duration.Seconds()
+		r.ComponentsReadyRate = float64(r.InstalledComponents) / r.Duration.Seconds()
+	}
+	return r
+}
@@ -0,0 +1,163 @@
+package loadtest
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	inventoryv1alpha1 "github.com/kyma-incubator/kymactl/api/v1alpha1"
+)
+
+func TestParseMixes(t *testing.T) {
+	mixes, err := ParseMixes("full=1, minimal=3,istio+logging")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(mixes) != 3 || len(mixes[0].Components) != 18 || mixes[1].Weight != 3 ||
+		strings.Join(mixes[2].Components, ",") != "istio,logging" || mixes[2].Weight != 1 {
+		t.Errorf("unexpected mixes %+v", mixes)
+	}
+
+	counts := map[string]int{}
+	for i := 0; i < 50; i++ {
+		counts[mixFor(mixes, i).Name]++
+	}
+	if counts["full"] != 10 || counts["minimal"] != 30 || counts["istio+logging"] != 10 {
+		t.Errorf("expected the mixes assigned by weight, got %v", counts)
+	}
+
+	for _, invalid := range []string{"", "full=0", "full=x", "Istio", "istio+"} {
+		if _, err := ParseMixes(invalid); err == nil {
+			t.Errorf("expected error for %q", invalid)
+		}
+	}
+}
+
+func TestPercentiles(t *testing.T) {
+	var durations []time.Duration
+	for i := 100; i > 0; i-- {
+		durations = append(durations, time.Duration(i)*time.Second)
+	}
+	p := percentiles(durations)
+	if p.P50 != 50*time.Second || p.P90 != 90*time.Second || p.P99 != 99*time.Second || p.Max != 100*time.Second {
+		t.Errorf("unexpected percentiles %+v", p)
+	}
+	if p := percentiles([]time.Duration{time.Second}); p.P50 != time.Second || p.P99 != time.Second {
+		t.Errorf("unexpected percentiles of one duration %+v", p)
+	}
+}
+
+// installer simulates the Kyma and HelmComponent controllers: it installs the components of all Kymas.
+// The Kymas named in failing are rejected once
+type installer struct {
+	client.WithWatch
+	mu      sync.Mutex
+	failing map[string]bool
+}
+
+func (c *installer) Create(ctx context.Context, obj client.Object, opts ...client.CreateOption) error {
+	c.mu.Lock()
+	failing := false
+	if kyma, ok := obj.(*inventoryv1alpha1.Kyma); ok && c.failing[kyma.Name] {
+		delete(c.failing, kyma.Name)
+		failing = true
+	}
+	c.mu.Unlock()
+	if failing {
+		return apierrors.NewTooManyRequests("slow down", 1)
+	}
+	return c.WithWatch.Create(ctx, obj, opts...)
+}
+
+func (c *installer) install(ctx context.Context, t *testing.T) {
+	installed := map[string]bool{}
+	for ctx.Err() == nil {
+		var kymas inventoryv1alpha1.KymaList
+		if err := c.List(ctx, &kymas); err != nil {
+			t.Error(err)
+			return
+		}
+		for _, kyma := range kymas.Items {
+			for _, component := range kyma.Spec.Components {
+				name := kyma.Name + "-" + component.Name
+				if installed[name] {
+					continue
+				}
+				installed[name] = true
+				if err := c.WithWatch.Create(ctx, &inventoryv1alpha1.HelmComponent{
+					ObjectMeta: metav1.ObjectMeta{Namespace: kyma.Namespace, Name: name,
+						Labels: map[string]string{inventoryv1alpha1.KymaLabel: kyma.Name}},
+					Spec:   inventoryv1alpha1.HelmComponentSpec{ComponentName: component.Name},
+					Status: inventoryv1alpha1.HelmComponentStatus{Status: "success"},
+				}); err != nil {
+					t.Error(err)
+				}
+			}
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestRun(t *testing.T) {
+	scheme := runtime.NewScheme()
+	_ = corev1.AddToScheme(scheme)
+	_ = inventoryv1alpha1.AddToScheme(scheme)
+	c := fake.NewClientBuilder().WithScheme(scheme).Build()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	i := &installer{WithWatch: c, failing: map[string]bool{"loadtest-00003": true}}
+	go i.install(ctx, t)
+
+	mixes, _ := ParseMixes("minimal=1,istio=1")
+	var out bytes.Buffer
+	report, err := Run(ctx, i, Config{Count: 6, Namespaces: 2, Rate: 100, Mixes: mixes, Timeout: 10 * time.Second, ProgressInterval: time.Second, Out: &out})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Kymas != 6 || report.Created != 5 || report.Ready != 5 || report.Complete() {
+		t.Errorf("expected 5 of 6 Kymas ready, got %+v", report)
+	}
+	// minimal for 0, 2 and 4, istio for 1 and 5
+	if report.Components != 11 || report.InstalledComponents != 11 {
+		t.Errorf("expected 11 installed components, got %d of %d", report.InstalledComponents, report.Components)
+	}
+	if report.APIErrors["create Kyma: TooManyRequests"] != 1 || report.APIErrorCount() != 1 {
+		t.Errorf("expected the rejected creation reported, got %v", report.APIErrors)
+	}
+	if report.TimeToReady.Max <= 0 || report.TimeToReady.P50 > report.TimeToReady.Max || report.ReadyRate <= 0 {
+		t.Errorf("unexpected times %+v", report)
+	}
+
+	var namespace corev1.Namespace
+	if err := c.Get(ctx, client.ObjectKey{Name: "loadtest-1"}, &namespace); err != nil {
+		t.Errorf("expected namespace created: %v", err)
+	}
+	var kyma inventoryv1alpha1.Kyma
+	if err := c.Get(ctx, client.ObjectKey{Namespace: "loadtest-1", Name: "loadtest-00005"}, &kyma); err != nil || kyma.Labels[RunLabel] != "loadtest" {
+		t.Errorf("expected labeled Kyma in the second namespace, got %v %v", kyma.Labels, err)
+	}
+
+	var printed bytes.Buffer
+	report.Print(&printed)
+	if !strings.Contains(printed.String(), "5 ready") || !strings.Contains(printed.String(), "create Kyma: TooManyRequests") {
+		t.Errorf("unexpected report:\n%s", printed.String())
+	}
+
+	if err := Cleanup(ctx, c, Config{Namespaces: 2}); err != nil {
+		t.Fatal(err)
+	}
+	var kymas inventoryv1alpha1.KymaList
+	if err := c.List(ctx, &kymas); err != nil || len(kymas.Items) != 0 {
+		t.Errorf("expected the Kymas deleted, got %d %v", len(kymas.Items), err)
+	}
+}
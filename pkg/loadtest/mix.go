@@ -0,0 +1,101 @@
+package loadtest
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Mixes are the predefined component lists
+var Mixes = map[string][]string{
+	// all components of the default catalog
+	"full": {
+		"istio", "cluster-essentials", "certificates", "istio-resources", "logging", "tracing", "kiali", "monitoring",
+		"eventing", "ory", "api-gateway", "service-catalog", "service-catalog-addons", "rafter", "helm-broker",
+		"cluster-users", "serverless", "application-connector",
+	},
+	// the prerequisites of the default catalog
+	"minimal": {"cluster-essentials", "istio", "certificates"},
+}
+
+// Mix is a list of components and the share of the Kymas created with it
+type Mix struct {
+	Name       string
+	Components []string
+	Weight     int
+}
+
+// ParseMixes parses a comma separated list of mixes with their weights, e.g. "full=1,minimal=3".
+// A mix is a predefined mix name or a list of components joined with "+", e.g. "istio+logging=2".
+// The weight is 1 if omitted.
+func ParseMixes(value string) ([]Mix, error) {
+	var mixes []Mix
+	for _, entry := range strings.Split(value, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		name, weight := entry, 1
+		if i := strings.LastIndex(entry, "="); i >= 0 {
+			name = entry[:i]
+			w, err := strconv.Atoi(entry[i+1:])
+			if err != nil || w < 1 {
+				return nil, fmt.Errorf("invalid weight of mix %s: %s", name, entry[i+1:])
+			}
+			weight = w
+		}
+		components, ok := Mixes[name]
+		if !ok {
+			components = strings.Split(name, "+")
+			for _, c := range components {
+				if !isComponentName(c) {
+					return nil, fmt.Errorf("invalid mix %s, expected one of %s or components joined with +", name, strings.Join(mixNames(), ", "))
+				}
+			}
+		}
+		mixes = append(mixes, Mix{Name: name, Components: components, Weight: weight})
+	}
+	if len(mixes) == 0 {
+		return nil, fmt.Errorf("no mix provided")
+	}
+	return mixes, nil
+}
+
+// mixFor returns the mix of the i-th Kyma. The mixes are assigned round robin by weight,
+// so the share of every mix is exact for every multiple of the sum of the weights
+func mixFor(mixes []Mix, i int) Mix {
+	total := 0
+	for _, m := range mixes {
+		total += m.Weight
+	}
+	n := i % total
+	for _, m := range mixes {
+		if n < m.Weight {
+			return m
+		}
+		n -= m.Weight
+	}
+	return mixes[len(mixes)-1]
+}
+
+func isComponentName(name string) bool {
+	if name == "" {
+		return false
+	}
+	for _, r := range name {
+		if !(r >= 'a' && r <= 'z' || r >= '0' && r <= '9' || r == '-') {
+			return false
+		}
+	}
+	return true
+}
+
+func mixNames() []string {
+	var names []string
+	for name := range Mixes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,97 @@
+package loadtest
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Report of a load test run. The durations are marshaled in nanoseconds
+type Report struct {
+	// Kymas requested, created and ready
+	Kymas   int `json:"kymas"`
+	Created int `json:"created"`
+	Ready   int `json:"ready"`
+	// HelmComponents expected for the created Kymas and installed successfully
+	Components          int `json:"components"`
+	InstalledComponents int `json:"installedComponents"`
+	// CreateDuration from the first to the last creation
+	CreateDuration time.Duration `json:"createDuration"`
+	// Duration from the first creation to the last Kyma ready or the timeout
+	Duration time.Duration `json:"duration"`
+	// CreateRate of the Kymas and ReadyRate of the Kymas and their components per second
+	CreateRate          float64 `json:"createRate"`
+	ReadyRate           float64 `json:"readyRate"`
+	ComponentsReadyRate float64 `json:"componentsReadyRate"`
+	// TimeToReady of the ready Kymas from their creation until all their components are installed
+	TimeToReady Percentiles `json:"timeToReady"`
+	// APIErrors by request and reason, e.g. "create Kyma: TooManyRequests"
+	APIErrors map[string]int `json:"apiErrors"`
+}
+
+// Percentiles of durations
+type Percentiles struct {
+	P50 time.Duration `json:"p50"`
+	P90 time.Duration `json:"p90"`
+	P99 time.Duration `json:"p99"`
+	Max time.Duration `json:"max"`
+}
+
+// percentiles returns the nearest rank percentiles of the durations
+func percentiles(durations []time.Duration) Percentiles {
+	if len(durations) == 0 {
+		return Percentiles{}
+	}
+	sorted := append([]time.Duration(nil), durations...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	rank := func(p int) time.Duration {
+		i := (p*len(sorted)+99)/100 - 1
+		if i < 0 {
+			i = 0
+		}
+		return sorted[i]
+	}
+	return Percentiles{P50: rank(50), P90: rank(90), P99: rank(99), Max: sorted[len(sorted)-1]}
+}
+
+// Complete returns true if all requested Kymas were created and are ready
+func (r *Report) Complete() bool {
+	return r.Ready == r.Kymas
+}
+
+// APIErrorCount returns the number of failed API requests
+func (r *Report) APIErrorCount() int {
+	count := 0
+	for _, n := range r.APIErrors {
+		count += n
+	}
+	return count
+}
+
+// Print writes the report in a human readable form
+func (r *Report) Print(w io.Writer) {
+	fmt.Fprintf(w, "Kymas:          %d requested, %d created, %d ready\n", r.Kymas, r.Created, r.Ready)
+	fmt.Fprintf(w, "Components:     %d expected, %d installed\n", r.Components, r.InstalledComponents)
+	fmt.Fprintf(w, "Creation:       %s, %.1f Kymas/s\n", r.CreateDuration.Round(time.Millisecond), r.CreateRate)
+	fmt.Fprintf(w, "Reconciliation: %s, %.1f Kymas/s, %.1f components/s\n", r.Duration.Round(time.Millisecond), r.ReadyRate, r.ComponentsReadyRate)
+	fmt.Fprintf(w, "Time to ready:  p50 %s, p90 %s, p99 %s, max %s\n", r.TimeToReady.P50.Round(time.Millisecond),
+		r.TimeToReady.P90.Round(time.Millisecond), r.TimeToReady.P99.Round(time.Millisecond), r.TimeToReady.Max.Round(time.Millisecond))
+	fmt.Fprintf(w, "API errors:     %d\n", r.APIErrorCount())
+	var keys []string
+	for key := range r.APIErrors {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		fmt.Fprintf(w, "  %s%s%d\n", key, strings.Repeat(" ", max(1, 40-len(key))), r.APIErrors[key])
+	}
+}
+
+func max(a, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
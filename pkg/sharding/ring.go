@@ -0,0 +1,72 @@
+package sharding
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"sort"
+	"strconv"
+)
+
+// DefaultVirtualNodes is the number of hash ranges owned by every shard. More ranges spread the keys more evenly
+const DefaultVirtualNodes = 64
+
+// Ring is a consistent hash ring. Every shard owns the hash ranges ending at its virtual nodes,
+// so a shard joining or leaving moves only the keys of its ranges.
+type Ring struct {
+	shards []string
+	hashes []uint64
+	owners map[uint64]string
+}
+
+// NewRing returns a ring of the shards with the number of virtual nodes per shard
+func NewRing(shards []string, virtualNodes int) *Ring {
+	if virtualNodes < 1 {
+		virtualNodes = DefaultVirtualNodes
+	}
+	r := &Ring{owners: map[uint64]string{}}
+	seen := map[string]bool{}
+	for _, shard := range shards {
+		if seen[shard] {
+			continue
+		}
+		seen[shard] = true
+		r.shards = append(r.shards, shard)
+		for i := 0; i < virtualNodes; i++ {
+			h := hash(shard + "#" + strconv.Itoa(i))
+			// on collisions the smaller shard name wins, so the ring doesn't depend on the order of the shards
+			if owner, ok := r.owners[h]; ok && owner < shard {
+				continue
+			} else if !ok {
+				r.hashes = append(r.hashes, h)
+			}
+			r.owners[h] = shard
+		}
+	}
+	sort.Strings(r.shards)
+	sort.Slice(r.hashes, func(i, j int) bool { return r.hashes[i] < r.hashes[j] })
+	return r
+}
+
+// Shards returns the sorted names of the shards
+func (r *Ring) Shards() []string {
+	return r.shards
+}
+
+// Owner returns the shard owning the key, or an empty string if the ring has no shards
+func (r *Ring) Owner(key string) string {
+	if len(r.hashes) == 0 {
+		return ""
+	}
+	h := hash(key)
+	i := sort.Search(len(r.hashes), func(i int) bool { return r.hashes[i] >= h })
+	if i == len(r.hashes) {
+		i = 0
+	}
+	return r.owners[r.hashes[i]]
+}
+
+// hash spreads similar keys like kyma-1 and kyma-2 uniformly over the ring
+func hash(s string) uint64 {
+	sum := sha256.Sum256([]byte(s))
+	return binary.BigEndian.Uint64(sum[:8])
+}
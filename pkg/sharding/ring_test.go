@@ -0,0 +1,44 @@
+package sharding
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestRingSpreadsKeys(t *testing.T) {
+	ring := NewRing([]string{"shard-a", "shard-b", "shard-c"}, DefaultVirtualNodes)
+	counts := map[string]int{}
+	for i := 0; i < 3000; i++ {
+		counts[ring.Owner(fmt.Sprintf("default/kyma-%d", i))]++
+	}
+	if len(counts) != 3 {
+		t.Fatalf("expected keys on 3 shards, got %v", counts)
+	}
+	for shard, count := range counts {
+		if count < 600 || count > 1400 {
+			t.Errorf("uneven distribution, %s owns %d of 3000 keys", shard, count)
+		}
+	}
+}
+
+func TestRingMovesOnlyKeysOfChangedShards(t *testing.T) {
+	before := NewRing([]string{"shard-a", "shard-b", "shard-c"}, DefaultVirtualNodes)
+	joined := NewRing([]string{"shard-c", "shard-a", "shard-b", "shard-d"}, DefaultVirtualNodes)
+	left := NewRing([]string{"shard-a", "shard-c"}, DefaultVirtualNodes)
+	for i := 0; i < 3000; i++ {
+		key := fmt.Sprintf("default/kyma-%d", i)
+		owner := before.Owner(key)
+		if o := joined.Owner(key); o != owner && o != "shard-d" {
+			t.Fatalf("%s moved from %s to %s, expected only moves to the new shard", key, owner, o)
+		}
+		if o := left.Owner(key); o != owner && owner != "shard-b" {
+			t.Fatalf("%s moved from %s to %s, expected only moves from the removed shard", key, owner, o)
+		}
+	}
+}
+
+func TestEmptyRing(t *testing.T) {
+	if owner := NewRing(nil, 0).Owner("default/kyma"); owner != "" {
+		t.Errorf("expected no owner, got %s", owner)
+	}
+}
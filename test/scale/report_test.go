@@ -0,0 +1,402 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package scale
+
+import (
+	"context"
+	"net/http"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	dto "github.com/prometheus/client_model/go"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+
+	"github.com/kyma-incubator/kymactl/pkg/loadtest"
+)
+
+// Report of a run of BenchmarkScale. The durations are marshaled in nanoseconds, the histograms in seconds
+type Report struct {
+	// Label of the report, e.g. the commit
+	Label     string    `json:"label,omitempty"`
+	Time      time.Time `json:"time"`
+	GoVersion string    `json:"goVersion"`
+	Config    Config    `json:"config"`
+	// Load is the report of the load generator
+	Load *loadtest.Report `json:"load"`
+	// Reconcile durations by controller
+	Reconcile map[string]Histogram `json:"reconcile"`
+	// QueueWait of the priority queues by controller and priority, e.g. "kyma/high"
+	QueueWait map[string]Histogram `json:"queueWait"`
+	// Samples of the queue depths and the heap over time
+	Samples []Sample `json:"samples"`
+	Heap    Heap     `json:"heap"`
+	// APIRequests of the manager by verb and resource, e.g. "patch kymas/status"
+	APIRequests map[string]int `json:"apiRequests"`
+}
+
+// Config of the run
+type Config struct {
+	Kymas int           `json:"kymas"`
+	Rate  float64       `json:"rate"`
+	Mix   string        `json:"mix"`
+	Step  time.Duration `json:"step"`
+}
+
+// Histogram of durations in seconds with cumulative buckets and quantiles interpolated like histogram_quantile
+type Histogram struct {
+	Count   uint64   `json:"count"`
+	Sum     float64  `json:"sum"`
+	P50     float64  `json:"p50"`
+	P90     float64  `json:"p90"`
+	P99     float64  `json:"p99"`
+	Buckets []Bucket `json:"buckets"`
+}
+
+// Bucket of a histogram with the number of observations less or equal to LE
+type Bucket struct {
+	LE    float64 `json:"le"`
+	Count uint64  `json:"count"`
+}
+
+// Sample of the queue depths and the heap
+type Sample struct {
+	Elapsed time.Duration `json:"elapsed"`
+	// WorkQueue depth of the controllers
+	WorkQueue map[string]float64 `json:"workQueue"`
+	// PriorityQueue depth of the controllers, summed over the priorities
+	PriorityQueue map[string]float64 `json:"priorityQueue"`
+	HeapAlloc     uint64             `json:"heapAlloc"`
+	Goroutines    int                `json:"goroutines"`
+}
+
+// Heap of the manager and the load generator, which run in the same process
+type Heap struct {
+	// Peak of the sampled allocated heap
+	Peak uint64 `json:"peak"`
+	// Live heap after a garbage collection at the end of the run
+	Live          uint64 `json:"live"`
+	MaxGoroutines int    `json:"maxGoroutines"`
+}
+
+// MaxQueueDepth returns the maximum sampled number of objects waiting in a queue of a controller
+func (r *Report) MaxQueueDepth() float64 {
+	max := 0.0
+	for _, s := range r.Samples {
+		for controller, depth := range s.WorkQueue {
+			if depth+s.PriorityQueue[controller] > max {
+				max = depth + s.PriorityQueue[controller]
+			}
+		}
+	}
+	return max
+}
+
+// APIRequestCount returns the number of API requests of the manager
+func (r *Report) APIRequestCount() int {
+	count := 0
+	for _, n := range r.APIRequests {
+		count += n
+	}
+	return count
+}
+
+// quantile estimates the q-quantile assuming a linear distribution within a bucket
+func (h Histogram) quantile(q float64) float64 {
+	if h.Count == 0 {
+		return 0
+	}
+	rank := q * float64(h.Count)
+	lower, below := 0.0, uint64(0)
+	for _, b := range h.Buckets {
+		if float64(b.Count) >= rank {
+			if b.Count == below {
+				return b.LE
+			}
+			return lower + (b.LE-lower)*(rank-float64(below))/float64(b.Count-below)
+		}
+		lower, below = b.LE, b.Count
+	}
+	// the quantile is in the +Inf bucket
+	return lower
+}
+
+// histograms by label value
+type histograms map[string]Histogram
+
+// sub returns the observations since before
+func (h histograms) sub(before histograms) map[string]Histogram {
+	result := map[string]Histogram{}
+	for key, after := range h {
+		prev := before[key]
+		delta := Histogram{Count: after.Count - prev.Count, Sum: after.Sum - prev.Sum}
+		for i, b := range after.Buckets {
+			if i < len(prev.Buckets) {
+				b.Count -= prev.Buckets[i].Count
+			}
+			delta.Buckets = append(delta.Buckets, b)
+		}
+		if delta.Count == 0 {
+			continue
+		}
+		delta.P50, delta.P90, delta.P99 = delta.quantile(0.5), delta.quantile(0.9), delta.quantile(0.99)
+		result[key] = delta
+	}
+	return result
+}
+
+type gathered struct {
+	reconcile histograms
+	queueWait histograms
+}
+
+// gatherHistograms reads the reconcile and priority queue wait histograms from the controller-runtime registry
+func gatherHistograms() (gathered, error) {
+	families, err := metrics.Registry.Gather()
+	if err != nil {
+		return gathered{}, err
+	}
+	result := gathered{reconcile: histograms{}, queueWait: histograms{}}
+	for _, family := range families {
+		switch family.GetName() {
+		case "controller_runtime_reconcile_time_seconds":
+			for _, m := range family.Metric {
+				result.reconcile[labelValue(m, "controller")] = histogramOf(m)
+			}
+		case "kymactl_priority_queue_wait_seconds":
+			for _, m := range family.Metric {
+				result.queueWait[labelValue(m, "controller")+"/"+labelValue(m, "priority")] = histogramOf(m)
+			}
+		}
+	}
+	return result, nil
+}
+
+func histogramOf(m *dto.Metric) Histogram {
+	h := Histogram{Count: m.GetHistogram().GetSampleCount(), Sum: m.GetHistogram().GetSampleSum()}
+	for _, b := range m.GetHistogram().GetBucket() {
+		h.Buckets = append(h.Buckets, Bucket{LE: b.GetUpperBound(), Count: b.GetCumulativeCount()})
+	}
+	return h
+}
+
+func labelValue(m *dto.Metric, name string) string {
+	for _, l := range m.Label {
+		if l.GetName() == name {
+			return l.GetValue()
+		}
+	}
+	return ""
+}
+
+// sampler records the queue depths and the heap in an interval
+type sampler struct {
+	interval time.Duration
+	start    time.Time
+	samples  []Sample
+}
+
+func newSampler(interval time.Duration) *sampler {
+	return &sampler{interval: interval, start: time.Now()}
+}
+
+func (s *sampler) run(ctx context.Context) {
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+	for {
+		s.sample()
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (s *sampler) sample() {
+	sample := Sample{
+		Elapsed:       time.Since(s.start),
+		WorkQueue:     map[string]float64{},
+		PriorityQueue: map[string]float64{},
+		Goroutines:    runtime.NumGoroutine(),
+	}
+	var stats runtime.MemStats
+	runtime.ReadMemStats(&stats)
+	sample.HeapAlloc = stats.HeapAlloc
+	families, err := metrics.Registry.Gather()
+	if err == nil {
+		for _, family := range families {
+			switch family.GetName() {
+			case "workqueue_depth":
+				for _, m := range family.Metric {
+					sample.WorkQueue[labelValue(m, "name")] = m.GetGauge().GetValue()
+				}
+			case "kymactl_priority_queue_depth":
+				for _, m := range family.Metric {
+					sample.PriorityQueue[labelValue(m, "controller")] += m.GetGauge().GetValue()
+				}
+			}
+		}
+	}
+	s.samples = append(s.samples, sample)
+}
+
+// heap returns the peak of the samples and the live heap now
+func (s *sampler) heap() Heap {
+	var heap Heap
+	for _, sample := range s.samples {
+		if sample.HeapAlloc > heap.Peak {
+			heap.Peak = sample.HeapAlloc
+		}
+		if sample.Goroutines > heap.MaxGoroutines {
+			heap.MaxGoroutines = sample.Goroutines
+		}
+	}
+	runtime.GC()
+	var stats runtime.MemStats
+	runtime.ReadMemStats(&stats)
+	heap.Live = stats.HeapAlloc
+	return heap
+}
+
+// requestCounter counts the API requests by verb and resource
+type requestCounter struct {
+	mu     sync.Mutex
+	counts map[string]int
+}
+
+func (c *requestCounter) add(key string) {
+	c.mu.Lock()
+	c.counts[key]++
+	c.mu.Unlock()
+}
+
+// reset returns the counts since the last reset
+func (c *requestCounter) reset() map[string]int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	counts := c.counts
+	c.counts = map[string]int{}
+	return counts
+}
+
+// countingTransport counts the requests passing through
+type countingTransport struct {
+	next    http.RoundTripper
+	counter *requestCounter
+}
+
+func (t *countingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	t.counter.add(requestKey(req))
+	return t.next.RoundTrip(req)
+}
+
+// requestKey returns the verb and the resource of an API request like in the audit log, e.g. "list kymas" or "patch kymas/status"
+func requestKey(req *http.Request) string {
+	parts := strings.Split(strings.Trim(req.URL.Path, "/"), "/")
+	switch {
+	case len(parts) >= 2 && parts[0] == "api":
+		parts = parts[2:]
+	case len(parts) >= 3 && parts[0] == "apis":
+		parts = parts[3:]
+	default:
+		return strings.ToLower(req.Method) + " " + req.URL.Path
+	}
+	if len(parts) >= 3 && parts[0] == "namespaces" {
+		parts = parts[2:]
+	}
+	if len(parts) == 0 {
+		return strings.ToLower(req.Method) + " discovery"
+	}
+	resource, named := parts[0], len(parts) > 1
+	if len(parts) > 2 {
+		resource += "/" + parts[2]
+	}
+	verb := strings.ToLower(req.Method)
+	switch {
+	case req.Method == http.MethodGet && !named && req.URL.Query().Get("watch") == "true":
+		verb = "watch"
+	case req.Method == http.MethodGet && !named:
+		verb = "list"
+	case req.Method == http.MethodPost:
+		verb = "create"
+	case req.Method == http.MethodPut:
+		verb = "update"
+	case req.Method == http.MethodDelete && !named:
+		verb = "deletecollection"
+	}
+	return verb + " " + resource
+}
+
+// sortedKeys returns the keys of the counts in order
+func sortedKeys(counts map[string]int) []string {
+	var keys []string
+	for key := range counts {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func TestRequestKey(t *testing.T) {
+	for _, tc := range []struct {
+		method, url, key string
+	}{
+		{http.MethodGet, "/apis/inventory.kyma-project.io/v1alpha1/kymas?limit=500", "list kymas"},
+		{http.MethodGet, "/apis/inventory.kyma-project.io/v1alpha1/kymas?watch=true&resourceVersion=1", "watch kymas"},
+		{http.MethodGet, "/apis/inventory.kyma-project.io/v1alpha1/namespaces/default/kymas/kyma", "get kymas"},
+		{http.MethodPatch, "/apis/inventory.kyma-project.io/v1alpha1/namespaces/default/kymas/kyma/status", "patch kymas/status"},
+		{http.MethodPost, "/apis/inventory.kyma-project.io/v1alpha1/namespaces/default/helmcomponents", "create helmcomponents"},
+		{http.MethodPut, "/apis/inventory.kyma-project.io/v1alpha1/namespaces/default/helmcomponents/c/status", "update helmcomponents/status"},
+		{http.MethodDelete, "/apis/inventory.kyma-project.io/v1alpha1/namespaces/default/helmcomponents", "deletecollection helmcomponents"},
+		{http.MethodGet, "/api/v1/namespaces", "list namespaces"},
+		{http.MethodGet, "/api/v1/namespaces/default", "get namespaces"},
+		{http.MethodGet, "/api/v1/namespaces/default/secrets/kubeconfig", "get secrets"},
+		{http.MethodGet, "/apis", "get /apis"},
+	} {
+		req, err := http.NewRequest(tc.method, "https://127.0.0.1"+tc.url, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if key := requestKey(req); key != tc.key {
+			t.Errorf("%s %s: expected %q, got %q", tc.method, tc.url, tc.key, key)
+		}
+	}
+}
+
+func TestHistogramSub(t *testing.T) {
+	before := histograms{"kyma": {Count: 10, Sum: 1, Buckets: []Bucket{{0.1, 10}, {1, 10}}}}
+	after := histograms{
+		"kyma":          {Count: 110, Sum: 51, Buckets: []Bucket{{0.1, 60}, {1, 110}}},
+		"helmcomponent": {Count: 4, Sum: 8, Buckets: []Bucket{{0.1, 0}, {1, 2}}},
+	}
+	delta := after.sub(before)
+	kyma := delta["kyma"]
+	if kyma.Count != 100 || kyma.Sum != 50 || kyma.Buckets[0].Count != 50 || kyma.Buckets[1].Count != 100 {
+		t.Errorf("unexpected delta %+v", kyma)
+	}
+	if kyma.P50 != 0.1 || kyma.P90 < 0.81 || kyma.P90 > 0.83 {
+		t.Errorf("unexpected quantiles %+v", kyma)
+	}
+	// half of the observations are above the last bucket
+	if component := delta["helmcomponent"]; component.P50 != 1 || component.P99 != 1 {
+		t.Errorf("unexpected quantiles %+v", component)
+	}
+}
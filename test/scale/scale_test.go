@@ -0,0 +1,267 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package scale runs the controllers in-process against envtest and measures how they cope with thousands of Kymas
+package scale
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-logr/logr"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/rest"
+	"k8s.io/klog/v2"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/cache"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/envtest"
+
+	configv1alpha1 "github.com/kyma-incubator/kymactl/api/config/v1alpha1"
+	inventoryv1alpha1 "github.com/kyma-incubator/kymactl/api/v1alpha1"
+	"github.com/kyma-incubator/kymactl/controllers"
+	"github.com/kyma-incubator/kymactl/manifests"
+	"github.com/kyma-incubator/kymactl/pkg/helm"
+	"github.com/kyma-incubator/kymactl/pkg/loadtest"
+)
+
+var (
+	kymas          = flag.Int("scale.kymas", 1000, "Number of Kymas created by BenchmarkScale.")
+	rate           = flag.Float64("scale.rate", 100, "Kymas created per second.")
+	mix            = flag.String("scale.mix", "full=1", "Component mixes of the Kymas, see the --mix flag of cmd/loadtest.")
+	step           = flag.Duration("scale.step", 10*time.Millisecond, "Duration of a step of the simulated installation per character of the component name.")
+	timeout        = flag.Duration("scale.timeout", 30*time.Minute, "Maximum duration of a run.")
+	sampleInterval = flag.Duration("scale.sample-interval", time.Second, "Interval of the queue depth and heap samples.")
+	reportFile     = flag.String("scale.report", "", "File the JSON report is written to. If empty: no report.")
+	label          = flag.String("scale.label", "", "Label of the report, e.g. the commit.")
+)
+
+// BenchmarkScale starts an API server, runs the Kyma and HelmComponent controllers in-process with the simulated
+// installation and creates Kymas with the load generator until all are ready. Run with:
+//
+//	go test ./test/scale -run NONE -bench Scale -benchtime 1x -timeout 0 -scale.kymas 2000 -scale.report scale.json
+//
+// Every iteration creates -scale.kymas Kymas, so run it with -benchtime 1x and compare commits with -count.
+// The controllers use the default configuration, so the client rate limit of the manager bounds the throughput
+func BenchmarkScale(b *testing.B) {
+	mixes, err := loadtest.ParseMixes(*mix)
+	if err != nil {
+		b.Fatal(err)
+	}
+	// the reconcilers log every transition
+	ctrl.SetLogger(logr.Discard())
+	klog.SetLogger(logr.Discard())
+
+	env := &envtest.Environment{
+		CRDDirectoryPaths:     []string{filepath.Join("..", "..", "config", "crd", "bases")},
+		ErrorIfCRDPathMissing: true,
+	}
+	config, err := env.Start()
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer func() {
+		if err := env.Stop(); err != nil {
+			b.Error(err)
+		}
+	}()
+
+	scheme := clientgoscheme.Scheme
+	if err := inventoryv1alpha1.AddToScheme(scheme); err != nil {
+		b.Fatal(err)
+	}
+	// the load generator gets its own client, so it neither shares the rate limit of the manager nor counts as its request
+	loadConfig := rest.CopyConfig(config)
+	loadConfig.QPS, loadConfig.Burst = 1000, 2000
+	c, err := client.NewWithWatch(loadConfig, client.Options{Scheme: scheme})
+	if err != nil {
+		b.Fatal(err)
+	}
+	requests := &requestCounter{counts: map[string]int{}}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	if err := startManager(ctx, rest.CopyConfig(config), requests); err != nil {
+		b.Fatal(err)
+	}
+
+	var report *Report
+	b.ResetTimer()
+	for n := 0; n < b.N; n++ {
+		report = run(ctx, b, c, requests, loadtest.Config{
+			Count:   *kymas,
+			Prefix:  fmt.Sprintf("scale-%d", n),
+			Rate:    *rate,
+			Workers: 20,
+			Mixes:   mixes,
+			Timeout: *timeout,
+		})
+		if !report.Load.Complete() {
+			b.Errorf("%d of %d Kymas ready after %s", report.Load.Ready, report.Load.Kymas, report.Load.Duration)
+		}
+	}
+	b.StopTimer()
+
+	var out strings.Builder
+	report.Load.Print(&out)
+	fmt.Fprintf(&out, "API requests:   %d\n", report.APIRequestCount())
+	for _, key := range sortedKeys(report.APIRequests) {
+		fmt.Fprintf(&out, "  %-40s%d\n", key, report.APIRequests[key])
+	}
+	b.Log("\n" + out.String())
+
+	b.ReportMetric(report.Load.ReadyRate, "kymas/s")
+	b.ReportMetric(report.Load.TimeToReady.P99.Seconds(), "p99-ready-s")
+	b.ReportMetric(report.Reconcile[configv1alpha1.KymaController].P99, "p99-kyma-reconcile-s")
+	b.ReportMetric(report.Reconcile[configv1alpha1.HelmComponentController].P99, "p99-component-reconcile-s")
+	b.ReportMetric(float64(report.MaxQueueDepth()), "max-queue-depth")
+	b.ReportMetric(float64(report.Heap.Peak), "peak-heap-B")
+	b.ReportMetric(float64(report.APIRequestCount())/float64(report.Load.Kymas), "requests/kyma")
+
+	if *reportFile == "" {
+		return
+	}
+	data, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		b.Fatal(err)
+	}
+	if err := os.WriteFile(*reportFile, data, 0o644); err != nil {
+		b.Fatal(err)
+	}
+}
+
+// startManager starts the Kyma and HelmComponent controllers configured like in main.go with the default configuration
+func startManager(ctx context.Context, config *rest.Config, requests *requestCounter) error {
+	var projectConfig configv1alpha1.ProjectConfig
+	projectConfig.Default()
+	config.QPS = projectConfig.Client.QPS
+	config.Burst = projectConfig.Client.Burst
+	config.Wrap(func(rt http.RoundTripper) http.RoundTripper {
+		return &countingTransport{next: rt, counter: requests}
+	})
+
+	catalog, err := helm.NewCatalog(manifests.FS, manifests.ChartsDir)
+	if err != nil {
+		return err
+	}
+	components, err := helm.LoadComponents(manifests.FS, manifests.ComponentsFile)
+	if err != nil {
+		return err
+	}
+	mgr, err := ctrl.NewManager(config, ctrl.Options{
+		Scheme:                 clientgoscheme.Scheme,
+		MetricsBindAddress:     "0",
+		HealthProbeBindAddress: "0",
+		NewCache:               cache.BuilderWithOptions(controllers.CacheOptions()),
+	})
+	if err != nil {
+		return err
+	}
+	if err := controllers.SetupReferenceIndexes(ctx, mgr.GetFieldIndexer()); err != nil {
+		return err
+	}
+	resync := controllers.Resync{Period: projectConfig.Resync.Period.Duration, Jitter: *projectConfig.Resync.Jitter}
+	if err := (&controllers.ComponentCatalogSeeder{
+		Client:     mgr.GetClient(),
+		Components: components,
+		Charts:     catalog,
+	}).SetupWithManager(mgr); err != nil {
+		return err
+	}
+	if err := (&controllers.HelmComponentReconciler{
+		Client:         mgr.GetClient(),
+		Scheme:         mgr.GetScheme(),
+		Catalog:        catalog,
+		RemoteClusters: &controllers.RemoteClusters{},
+		APIReader:      mgr.GetAPIReader(),
+		Options:        controllers.ControllerOptions(projectConfig.Controllers[configv1alpha1.HelmComponentController]),
+		Resync:         resync,
+		SimulationStep: *step,
+	}).SetupWithManager(mgr); err != nil {
+		return err
+	}
+	if err := (&controllers.KymaReconciler{
+		Client:  mgr.GetClient(),
+		Scheme:  mgr.GetScheme(),
+		Options: controllers.ControllerOptions(projectConfig.Controllers[configv1alpha1.KymaController]),
+		Resync:  resync,
+	}).SetupWithManager(mgr); err != nil {
+		return err
+	}
+	go func() {
+		if err := mgr.Start(ctx); err != nil {
+			panic(err)
+		}
+	}()
+	if !mgr.GetCache().WaitForCacheSync(ctx) {
+		return fmt.Errorf("cache not synced")
+	}
+	return nil
+}
+
+// run creates the Kymas of the config and returns the report of the run
+func run(ctx context.Context, b *testing.B, c client.WithWatch, requests *requestCounter, config loadtest.Config) *Report {
+	requests.reset()
+	metricsBefore, err := gatherHistograms()
+	if err != nil {
+		b.Fatal(err)
+	}
+	runtime.GC()
+	sampler := newSampler(*sampleInterval)
+	samplerCtx, stopSampler := context.WithCancel(ctx)
+	done := make(chan struct{})
+	go func() {
+		sampler.run(samplerCtx)
+		close(done)
+	}()
+
+	load, err := loadtest.Run(ctx, c, config)
+	stopSampler()
+	<-done
+	if err != nil {
+		b.Fatal(err)
+	}
+	metricsAfter, err := gatherHistograms()
+	if err != nil {
+		b.Fatal(err)
+	}
+	report := &Report{
+		Label:     *label,
+		Time:      time.Now().UTC(),
+		GoVersion: runtime.Version(),
+		Config: Config{
+			Kymas: config.Count,
+			Rate:  config.Rate,
+			Mix:   *mix,
+			Step:  *step,
+		},
+		Load:        load,
+		Samples:     sampler.samples,
+		APIRequests: requests.reset(),
+	}
+	report.Reconcile = metricsAfter.reconcile.sub(metricsBefore.reconcile)
+	report.QueueWait = metricsAfter.queueWait.sub(metricsBefore.queueWait)
+	report.Heap = sampler.heap()
+	return report
+}